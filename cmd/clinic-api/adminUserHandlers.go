@@ -0,0 +1,379 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/gorilla/mux"
+)
+
+// bootstrapAdmin makes the user with the -admin-email address a super admin, so that there is
+// somebody to manage the other users. The user is created with -admin-password when there is no
+// user with the address yet. Nothing is done once any user can manage users.
+func (app *application) bootstrapAdmin() error {
+	exists, err := app.models.Permissions.AnyUserWith(model.PermissionUsersAdmin)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	email := app.config.admin.email
+
+	user, err := app.models.Users.GetByEmail(email)
+	switch {
+	case errors.Is(err, model.ErrRecordNotFound):
+		user = &model.User{
+			Name:      app.config.admin.name,
+			Email:     email,
+			Activated: true,
+		}
+
+		err = user.Password.Set(app.config.admin.password)
+		if err != nil {
+			return err
+		}
+
+		v := validator.New()
+
+		if model.ValidateUser(v, user); !v.Valid() {
+			return fmt.Errorf("invalid admin user: %v", v.Errors)
+		}
+
+		err = app.models.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !user.Activated:
+		// An admin who can not use the API would not help.
+		user.Activated = true
+
+		err = app.models.Users.Update(user)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = app.models.Roles.AssignToUser(user.ID, model.RoleSuperAdmin)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("bootstrapped the first admin", map[string]string{
+		"user":  strconv.FormatInt(user.ID, 10),
+		"email": user.Email,
+	})
+
+	return nil
+}
+
+// listUsersHandler returns the users whose name and email contain the "name" and "email"
+// queries, optionally only the ones with the "activated" state.
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name      string
+		Email     string
+		Activated *bool
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readStrings(qs, "name", "")
+	input.Email = app.readStrings(qs, "email", "")
+
+	if s := app.readStrings(qs, "activated", ""); s != "" {
+		activated, err := strconv.ParseBool(s)
+		if err != nil {
+			v.AddError("activated", "must be true or false")
+		}
+		input.Activated = &activated
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readStrings(qs, "sort", "id")
+
+	input.Filters.SortSafeList = []string{
+		// ascending sort values
+		"id", "name", "email", "created_at",
+		// descending sort values
+		"-id", "-name", "-email", "-created_at",
+	}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(input.Name, input.Email, input.Activated, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+}
+
+// readUserParam returns the user with the id of the URL. It sends the error response itself,
+// and returns nil then.
+func (app *application) readUserParam(w http.ResponseWriter, r *http.Request) *model.User {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	user, err := app.models.Users.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return user
+}
+
+// writeAdminUser sends the user along with their roles, the permissions granted to them
+// directly, and all the permissions they have.
+func (app *application) writeAdminUser(w http.ResponseWriter, r *http.Request, user *model.User) {
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	granted, err := app.models.Permissions.GetGrantedToUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if permissions == nil {
+		permissions = model.Permissions{}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"user":               user,
+		"roles":              roles,
+		"grantedPermissions": granted,
+		"permissions":        permissions,
+	}, nil)
+}
+
+func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUserParam(w, r)
+	if user == nil {
+		return
+	}
+
+	app.writeAdminUser(w, r, user)
+}
+
+// updateUserActivatedHandler deactivates or reactivates a user. A deactivated user is logged out
+// of every session, and can not use the API until they are reactivated.
+func (app *application) updateUserActivatedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUserParam(w, r)
+	if user == nil {
+		return
+	}
+
+	var input struct {
+		Activated *bool `json:"activated"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Activated != nil, "activated", "must be provided")
+
+	// Otherwise the last admin could lock everybody out.
+	current, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+	v.Check(input.Activated == nil || *input.Activated || current.ID != user.ID, "activated", "you can not deactivate yourself")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.Activated = *input.Activated
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !user.Activated {
+		err = app.models.Tokens.DeleteSessionsForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.writeAdminUser(w, r, user)
+}
+
+// forcePasswordResetHandler makes a user choose a new password. The current password stops
+// working, every session of the user is logged out, and a password reset token is mailed to
+// them.
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUserParam(w, r)
+	if user == nil {
+		return
+	}
+
+	// Nobody knows the new password, so that only the mailed token lets the user in again.
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = user.Password.Set(base64.RawURLEncoding.EncodeToString(randomBytes))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(model.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, passwordResetTTL, model.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		err := app.notifier.Notify(passwordResetMessage(user, token))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user": strconv.FormatInt(user.ID, 10)})
+		}
+	})
+
+	app.writeJSON(w, http.StatusAccepted, envelope{"message": "the user has been logged out and emailed password reset instructions"}, nil)
+}
+
+// grantUserPermissionsHandler grants permission codes to a user directly, on top of the ones of
+// their roles.
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUserParam(w, r)
+	if user == nil {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Permissions) > 0, "permissions", "must contain at least 1 permission code")
+	for _, code := range input.Permissions {
+		v.Check(known.Include(code), "permissions", "must contain only existing permission codes")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Permissions.AddForUser(user.ID, input.Permissions...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeAdminUser(w, r, user)
+}
+
+// revokeUserPermissionHandler revokes a permission code granted to a user directly. The user
+// keeps it if one of their roles has it.
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readUserParam(w, r)
+	if user == nil {
+		return
+	}
+
+	code := mux.Vars(r)["code"]
+
+	err := app.models.Permissions.RemoveForUser(user.ID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeAdminUser(w, r, user)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// appointmentStatusHandler returns a handler which moves the appointment from the URL to the
+// given status. It backs the confirm, check-in, start, complete, cancel and no-show actions, so
+// that every status change goes through the same transition checks and is recorded with the
+// acting user.
+func (app *application) appointmentStatusHandler(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		// Only cancellations take a body, with an optional reason, and the reason of staff for
+		// overriding the cancellation policy of the clinic.
+		var input struct {
+			Reason         string `json:"reason"`
+			OverrideReason string `json:"overrideReason"`
+		}
+
+		if status == model.StatusCancelled && r.ContentLength != 0 {
+			err = app.readJSON(w, r, &input)
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+		}
+
+		user, err := app.contextGetUser(r)
+		if err != nil {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		appointment, err := app.getAccessibleAppointment(r, id)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		// The cancellation policy protects bookings. Once the patient is at the clinic, the
+		// visit is handled there.
+		var violation *model.PolicyViolation
+
+		if status == model.StatusCancelled && (appointment.Status == model.StatusRequested || appointment.Status == model.StatusConfirmed) {
+			v := validator.New()
+			if model.ValidateOverrideReason(v, input.OverrideReason); !v.Valid() {
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+
+			policy, err := app.models.Policies.GetForDoctor(appointment.DoctorId)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			violation = policy.CheckCancel(appointment, time.Now())
+			if !app.enforcePolicy(w, r, violation, input.OverrideReason) {
+				return
+			}
+		}
+
+		err = app.models.Appointments.SetStatus(appointment, status, user.ID, input.Reason)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrInvalidTransition):
+				app.invalidTransitionResponse(w, r, appointment.Status, status)
+			case errors.Is(err, model.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if status == model.StatusCancelled {
+			app.recordOverride(r, appointment.Id, model.PolicyActionCancel, violation, input.OverrideReason)
+			app.offerFreedSlot(appointment)
+		}
+
+		app.writeJSON(w, http.StatusOK, envelope{"appointment": appointment}, nil)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+func (app *application) createAppointmentTypeHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Clinics.Get(clinicID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name                string `json:"name"`
+		DurationMinutes     int    `json:"durationMinutes"`
+		BufferBeforeMinutes int    `json:"bufferBeforeMinutes"`
+		BufferAfterMinutes  int    `json:"bufferAfterMinutes"`
+		Specialty           string `json:"specialty"`
+		Preparation         string `json:"preparation"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	appointmentType := &model.AppointmentType{
+		ClinicID:            int64(clinicID),
+		Name:                input.Name,
+		DurationMinutes:     input.DurationMinutes,
+		BufferBeforeMinutes: input.BufferBeforeMinutes,
+		BufferAfterMinutes:  input.BufferAfterMinutes,
+		Specialty:           input.Specialty,
+		Preparation:         input.Preparation,
+	}
+
+	v := validator.New()
+
+	if model.ValidateAppointmentType(v, appointmentType); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Types.Insert(appointmentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"appointmentType": appointmentType}, nil)
+}
+
+func (app *application) listAppointmentTypesHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	types, err := app.models.Types.GetAllForClinic(int64(clinicID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"appointmentTypes": types}, nil)
+}
+
+// getClinicAppointmentType fetches the appointment type named by the "typeID" route variable,
+// and reports ErrRecordNotFound when it belongs to another clinic than the "id" one.
+func (app *application) getClinicAppointmentType(r *http.Request) (*model.AppointmentType, error) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		return nil, model.ErrRecordNotFound
+	}
+
+	typeID, err := app.readNamedIDParam(r, "typeID")
+	if err != nil {
+		return nil, model.ErrRecordNotFound
+	}
+
+	appointmentType, err := app.models.Types.Get(typeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if appointmentType.ClinicID != int64(clinicID) {
+		return nil, model.ErrRecordNotFound
+	}
+
+	return appointmentType, nil
+}
+
+func (app *application) getAppointmentTypeHandler(w http.ResponseWriter, r *http.Request) {
+	appointmentType, err := app.getClinicAppointmentType(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"appointmentType": appointmentType}, nil)
+}
+
+func (app *application) updateAppointmentTypeHandler(w http.ResponseWriter, r *http.Request) {
+	appointmentType, err := app.getClinicAppointmentType(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name                *string `json:"name"`
+		DurationMinutes     *int    `json:"durationMinutes"`
+		BufferBeforeMinutes *int    `json:"bufferBeforeMinutes"`
+		BufferAfterMinutes  *int    `json:"bufferAfterMinutes"`
+		Specialty           *string `json:"specialty"`
+		Preparation         *string `json:"preparation"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		appointmentType.Name = *input.Name
+	}
+	if input.DurationMinutes != nil {
+		appointmentType.DurationMinutes = *input.DurationMinutes
+	}
+	if input.BufferBeforeMinutes != nil {
+		appointmentType.BufferBeforeMinutes = *input.BufferBeforeMinutes
+	}
+	if input.BufferAfterMinutes != nil {
+		appointmentType.BufferAfterMinutes = *input.BufferAfterMinutes
+	}
+	if input.Specialty != nil {
+		appointmentType.Specialty = *input.Specialty
+	}
+	if input.Preparation != nil {
+		appointmentType.Preparation = *input.Preparation
+	}
+
+	v := validator.New()
+
+	if model.ValidateAppointmentType(v, appointmentType); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Types.Update(appointmentType)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"appointmentType": appointmentType}, nil)
+}
+
+func (app *application) deleteAppointmentTypeHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	typeID, err := app.readNamedIDParam(r, "typeID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Types.Delete(int64(clinicID), typeID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
+
+// applyAppointmentType books the appointment as the type: the end time is computed from the
+// start time and the buffers are copied. The doctor must work at the clinic of the type and have
+// its specialty. Problems with the input are recorded in v, and only unexpected errors returned.
+func (app *application) applyAppointmentType(v *validator.Validator, appointment *model.Appointment, typeID int64) error {
+	appointmentType, err := app.models.Types.Get(typeID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("typeId", "must be an existing appointment type")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	doctorID, err := strconv.Atoi(appointment.DoctorId)
+	if err != nil {
+		v.AddError("doctorId", "must be an existing doctor")
+		return nil
+	}
+
+	doctor, err := app.models.Doctors.Get(doctorID)
+	if err != nil {
+		v.AddError("doctorId", "must be an existing doctor")
+		return nil
+	}
+
+	v.Check(int64(doctor.ClinicID) == appointmentType.ClinicID, "typeId", "must be an appointment type of the doctor's clinic")
+	v.Check(appointmentType.Allows(doctor.Specialty), "doctorId", "must be a doctor with the "+appointmentType.Specialty+" specialty")
+
+	end, ok := appointmentType.EndTime(appointment.StartTime)
+	v.Check(ok, "startTime", "must be a time in HH:MM format which leaves room for the appointment on the same day")
+	v.Check(!ok || appointment.EndTime == "" || appointment.EndTime == end, "endTime", "must be left out or match the duration of the appointment type")
+
+	appointment.EndTime = end
+	appointment.TypeID = &appointmentType.ID
+	appointment.BufferBeforeMinutes = appointmentType.BufferBeforeMinutes
+	appointment.BufferAfterMinutes = appointmentType.BufferAfterMinutes
+
+	return nil
+}
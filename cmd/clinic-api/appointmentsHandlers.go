@@ -2,10 +2,10 @@ package main
 
 import (
 	"errors"
-	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
 	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
@@ -14,12 +14,20 @@ import (
 
 func (app *application) createAppointmentHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		PatientId string `json:"patientId"`
-		DoctorId  string `json:"doctorId"`
-		Date      string `json:"date"`
-		StartTime string `json:"startTime"`
-		EndTime   string `json:"endTime"`
-		Status    string `json:"status"`
+		PatientId   string  `json:"patientId"`
+		DoctorId    string  `json:"doctorId"`
+		TypeID      *int64  `json:"typeId"`
+		Date        string  `json:"date"`
+		StartTime   string  `json:"startTime"`
+		EndTime     string  `json:"endTime"`
+		Status      string  `json:"status"`
+		ResourceIDs []int64 `json:"resourceIds"`
+		// OverrideReason lets staff book beyond the booking horizon of the clinic, or for a
+		// patient who has reached its no-show limit.
+		OverrideReason string `json:"overrideReason"`
+		// HoldID books the slot held by the user. The doctor and the times default to the ones
+		// of the hold.
+		HoldID *int64 `json:"holdId"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -28,40 +36,192 @@ func (app *application) createAppointmentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if input.HoldID != nil {
+		hold, err := app.models.Holds.Get(*input.HoldID)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				app.holdExpiredResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if input.DoctorId == "" {
+			input.DoctorId = strconv.FormatInt(hold.DoctorID, 10)
+		}
+		if input.Date == "" {
+			input.Date = hold.Date
+		}
+		if input.StartTime == "" {
+			input.StartTime = hold.StartTime
+		}
+		if input.EndTime == "" && input.TypeID == nil {
+			input.EndTime = hold.EndTime
+		}
+	}
+
+	// Every appointment starts its lifecycle as requested, later statuses are only reachable
+	// through the status action endpoints.
+	v := validator.New()
+	v.Check(input.Status == "" || input.Status == model.StatusRequested, "status", "new appointments must be requested")
+	v.Check(uniqueIDs(input.ResourceIDs), "resourceIds", "must not contain duplicate values")
+	model.ValidateOverrideReason(v, input.OverrideReason)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Patients may only book for themselves, and doctors only into their own calendar.
+	if !app.contextGetAccessScope(r).CanBook(input.PatientId, input.DoctorId) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	appointment := &model.Appointment{
-		PatientId: input.PatientId,
-		DoctorId:  input.DoctorId,
-		Date:      input.Date,
-		StartTime: input.StartTime,
-		EndTime:   input.EndTime,
-		Status:    input.Status,
+		PatientId:   input.PatientId,
+		DoctorId:    input.DoctorId,
+		Date:        input.Date,
+		StartTime:   input.StartTime,
+		EndTime:     input.EndTime,
+		Status:      model.StatusRequested,
+		ResourceIDs: input.ResourceIDs,
 	}
 
-	err = app.models.Appointments.Insert(appointment)
+	// A type fills in the end time and the buffers, and limits the doctors who may take the
+	// appointment.
+	if input.TypeID != nil {
+		err = app.applyAppointmentType(v, appointment, *input.TypeID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	if model.ValidateAppointment(v, appointment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	violations, ok := app.enforceBookingPolicy(w, r, []*model.Appointment{appointment}, input.OverrideReason)
+	if !ok {
+		return
+	}
+
+	if input.HoldID != nil {
+		user, userErr := app.contextGetUser(r)
+		if userErr != nil {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		err = app.models.Appointments.InsertWithHold(appointment, *input.HoldID, user.ID)
+	} else {
+		err = app.models.Appointments.Insert(appointment)
+	}
 	if err != nil {
-		log.Print(err.Error())
-		app.errorResponse(w, r, http.StatusInternalServerError, "500 Internal Server Error")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.holdExpiredResponse(w, r)
+		case errors.Is(err, model.ErrHoldMismatch):
+			v.AddError("holdId", "must be a hold of the doctor for the date and times of the appointment")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrAppointmentConflict):
+			app.appointmentConflict(w, r, appointment)
+		case errors.Is(err, model.ErrDoctorUnavailable):
+			app.doctorUnavailableResponse(w, r)
+		case errors.Is(err, model.ErrClinicClosed):
+			app.clinicClosedResponse(w, r)
+		case errors.Is(err, model.ErrSlotHeld):
+			app.slotHeldResponse(w, r)
+		case errors.Is(err, model.ErrGroupSession):
+			app.groupSessionConflictResponse(w, r)
+		case errors.Is(err, model.ErrUnknownResource):
+			v.AddError("resourceIds", "must be resources of the doctor's clinic")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
+
+	for _, violation := range violations {
+		app.recordOverride(r, appointment.Id, model.PolicyActionBook, violation, input.OverrideReason)
+	}
+
 	app.writeJSON(w, http.StatusCreated, envelope{"appointment": appointment}, nil)
 }
 
+// appointmentConflict looks up the appointments which overlap with the rejected one and sends
+// them back to the client in a 409 Conflict response.
+func (app *application) appointmentConflict(w http.ResponseWriter, r *http.Request, appointment *model.Appointment) {
+	ids, err := app.models.Appointments.GetConflicts(appointment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.appointmentConflictResponse(w, r, ids)
+}
+
+// uniqueIDs reports whether all IDs in the list are different.
+func uniqueIDs(ids []int64) bool {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+// getAccessibleAppointment fetches the appointment, and reports ErrRecordNotFound when it is
+// outside the access scope of the user, so that other people's appointments look like missing
+// ones.
+func (app *application) getAccessibleAppointment(r *http.Request, id int) (*model.Appointment, error) {
+	appointment, err := app.models.Appointments.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.contextGetAccessScope(r).CanAccessAppointment(appointment) {
+		return nil, model.ErrRecordNotFound
+	}
+
+	return appointment, nil
+}
+
+// SearchAppointmentHandler lists the appointments matching the typed filters of the query
+// string, each with a summary of its doctor and patient.
 func (app *application) SearchAppointmentHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		PatientId string `json:"patientId"`
-		DoctorId  string `json:"doctorId"`
-		Date      string `json:"date"`
-		Status    string `json:"status"`
+		model.AppointmentFilters
 		model.Filters
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.PatientId = app.readStrings(qs, "patientId", "")
-	input.DoctorId = app.readStrings(qs, "doctorId", "")
-	input.Date = app.readStrings(qs, "adte", "")
-	input.Status = app.readStrings(qs, "status", "")
+	input.PatientID = app.readID(qs, "patient_id", app.readID(qs, "patientId", 0, v), v)
+	input.DoctorID = app.readID(qs, "doctor_id", app.readID(qs, "doctorId", 0, v), v)
+	input.ClinicID = app.readID(qs, "clinic_id", 0, v)
+
+	for key, date := range map[string]*string{"date": &input.Date, "date_from": &input.DateFrom, "date_to": &input.DateTo} {
+		if t := app.readDate(qs, key, time.Time{}, v); !t.IsZero() {
+			*date = t.Format(model.DateLayout)
+		}
+	}
+
+	input.Specialty = app.readStrings(qs, "specialty", "")
+	input.PatientName = app.readStrings(qs, "patient_name", "")
+	if s := app.readStrings(qs, "status", ""); s != "" {
+		input.Statuses = strings.Split(s, ",")
+	}
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
@@ -70,19 +230,20 @@ func (app *application) SearchAppointmentHandler(w http.ResponseWriter, r *http.
 
 	input.Filters.SortSafeList = []string{
 		// ascending sort values
-		"id", "patientId", "doctorId", "date", "start_time", "end_time", "status", "created_at", "updated_at",
+		"id", "patient_id", "doctor_id", "date", "start_time", "end_time", "status", "created_at", "updated_at",
 		// descending sort values
-		"-id", "-patientId", "-doctorId", "-date", "-start_time", "-end_time", "-status", "-created_at", "-updated_at",
+		"-id", "-patient_id", "-doctor_id", "-date", "-start_time", "-end_time", "-status", "-created_at", "-updated_at",
 	}
 
+	model.ValidateAppointmentFilters(v, input.AppointmentFilters)
 	if model.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	appointments, metadata, err := app.models.Appointments.GetAll(input.PatientId, input.DoctorId, input.Date, input.Status, input.Filters)
+	scope := app.contextGetAccessScope(r)
+
+	appointments, metadata, err := app.models.Appointments.GetAll(input.AppointmentFilters, input.Filters, scope)
 	if err != nil {
-		fmt.Println("We are in search appointment handler", "\npatientId: ", input.PatientId, "\ndoctorId:", input.DoctorId, "\ndate:", input.Date, "\nStatus:", input.Status, "\n", input.Filters)
-		fmt.Print("\nError: ", err)
 		app.serverErrorResponse(w, r, err)
 		return
 	}
@@ -100,7 +261,7 @@ func (app *application) getAppointmentHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	appointment, err := app.models.Appointments.Get(id)
+	appointment, err := app.getAccessibleAppointment(r, id)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusNotFound, "404 Not Found")
 		return
@@ -118,19 +279,22 @@ func (app *application) updateAppointmentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	appointment, err := app.models.Appointments.Get(id)
+	appointment, err := app.getAccessibleAppointment(r, id)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusNotFound, "404 Not Found")
 		return
 	}
 
 	var input struct {
-		PatientId *string `json:"patientId"`
-		DoctorId  *string `json:"doctorId"`
-		Date      *string `json:"date"`
-		StartTime *string `json:"startTime"`
-		EndTime   *string `json:"endTime"`
-		Status    *string `json:"status"`
+		PatientId   *string  `json:"patientId"`
+		DoctorId    *string  `json:"doctorId"`
+		Date        *string  `json:"date"`
+		StartTime   *string  `json:"startTime"`
+		EndTime     *string  `json:"endTime"`
+		Status      *string  `json:"status"`
+		ResourceIDs *[]int64 `json:"resourceIds"`
+		// OverrideReason lets staff move the appointment against the policy of the clinic.
+		OverrideReason string `json:"overrideReason"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -139,6 +303,8 @@ func (app *application) updateAppointmentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	original := *appointment
+
 	if input.PatientId != nil {
 		appointment.PatientId = *input.PatientId
 	}
@@ -156,15 +322,109 @@ func (app *application) updateAppointmentHandler(w http.ResponseWriter, r *http.
 	if input.EndTime != nil {
 		appointment.EndTime = *input.EndTime
 	}
-	if input.Status != nil {
-		appointment.Status = *input.Status
+	if input.ResourceIDs != nil {
+		appointment.ResourceIDs = *input.ResourceIDs
+	}
+
+	// Moved appointments of a type keep its duration, and can only go to doctors who may take it.
+	// A given end time has to match the duration.
+	if appointment.TypeID != nil && (input.DoctorId != nil || input.StartTime != nil || input.EndTime != nil) {
+		if input.EndTime == nil {
+			appointment.EndTime = ""
+		}
+
+		v := validator.New()
+		err = app.applyAppointmentType(v, appointment, *appointment.TypeID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+	if !app.contextGetAccessScope(r).CanBook(appointment.PatientId, appointment.DoctorId) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	if input.Status != nil && *input.Status != appointment.Status {
+		v := validator.New()
+		v.AddError("status", "must be changed through the confirm, check-in, start, complete, cancel and no-show actions")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !uniqueIDs(appointment.ResourceIDs) {
+		v := validator.New()
+		v.AddError("resourceIds", "must not contain duplicate values")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	v := validator.New()
+	if model.ValidateAppointment(v, appointment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Moving the appointment to another time is a reschedule, and held to the same policy.
+	var violation *model.PolicyViolation
+
+	if appointment.Date != original.Date || appointment.StartTime != original.StartTime {
+		if model.ValidateOverrideReason(v, input.OverrideReason); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		policy, err := app.models.Policies.GetForDoctor(original.DoctorId)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		violation = policy.CheckReschedule(&original, appointment, time.Now())
+		if !app.enforcePolicy(w, r, violation, input.OverrideReason) {
+			return
+		}
+
+		appointment.RescheduleCount++
+	}
+
+	if input.DoctorId != nil || input.Date != nil || input.StartTime != nil || input.EndTime != nil {
+		err = app.models.Appointments.CheckOpeningHours(appointment)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrClinicClosed):
+				app.clinicClosedResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
 	}
 
 	err = app.models.Appointments.Update(appointment)
 	if err != nil {
-		app.errorResponse(w, r, http.StatusInternalServerError, "500 Internal Server Error")
+		switch {
+		case errors.Is(err, model.ErrAppointmentConflict):
+			app.appointmentConflict(w, r, appointment)
+		case errors.Is(err, model.ErrDoctorUnavailable):
+			app.doctorUnavailableResponse(w, r)
+		case errors.Is(err, model.ErrSlotHeld):
+			app.slotHeldResponse(w, r)
+		case errors.Is(err, model.ErrGroupSession):
+			app.groupSessionConflictResponse(w, r)
+		case errors.Is(err, model.ErrUnknownResource):
+			v := validator.New()
+			v.AddError("resourceIds", "must be resources of the doctor's clinic")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
+
+	app.recordOverride(r, appointment.Id, model.PolicyActionReschedule, violation, input.OverrideReason)
+
 	app.writeJSON(w, http.StatusCreated, envelope{"appointment": appointment}, nil)
 }
 
@@ -175,6 +435,42 @@ func (app *application) deleteAppointmentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	appointment, err := app.getAccessibleAppointment(r, id)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Deleting is held to the cancellation policy, and only takes a body with an override reason.
+	var input struct {
+		OverrideReason string `json:"overrideReason"`
+	}
+
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if model.ValidateOverrideReason(v, input.OverrideReason); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	policy, err := app.models.Policies.GetForDoctor(appointment.DoctorId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	violation := policy.CheckCancel(appointment, time.Now())
+	if !app.enforcePolicy(w, r, violation, input.OverrideReason) {
+		return
+	}
+
 	err = app.models.Appointments.Delete(id)
 	if err != nil {
 		switch {
@@ -186,6 +482,13 @@ func (app *application) deleteAppointmentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	app.recordOverride(r, appointment.Id, model.PolicyActionDelete, violation, input.OverrideReason)
+
+	// Deleting a booked appointment frees its slot just like cancelling it does.
+	if appointment.Status == model.StatusRequested || appointment.Status == model.StatusConfirmed {
+		app.offerFreedSlot(appointment)
+	}
+
 	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
 
 }
@@ -200,6 +503,12 @@ func (app *application) getAppointmentsByDoctorIDHandler(w http.ResponseWriter,
         return
     }
 
+    scope := app.contextGetAccessScope(r)
+    if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+        app.notFoundResponse(w, r)
+        return
+    }
+
     appointments, err := app.models.Appointments.GetByDoctorID(doctorID)
     if err != nil {
         app.serverErrorResponse(w, r, err)
@@ -219,6 +528,12 @@ func (app *application) getAppointmentsByPatientIDHandler(w http.ResponseWriter,
         return
     }
 
+    scope := app.contextGetAccessScope(r)
+    if !scope.All && !scope.IsPatient(int64(patientID)) {
+        app.notFoundResponse(w, r)
+        return
+    }
+
     appointments, err := app.models.Appointments.GetByPatientID(patientID)
     if err != nil {
         app.serverErrorResponse(w, r, err)
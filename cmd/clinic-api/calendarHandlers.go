@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/ical"
+)
+
+// feedTokenTTL is how long a calendar feed token is valid. Feeds are meant to be subscribed to
+// once, so tokens live long and are revoked explicitly instead.
+const feedTokenTTL = 5 * 365 * 24 * time.Hour
+
+const calendarProdID = "-//Medical Clinic//Clinic API//EN"
+
+// createFeedTokenHandler creates the calendar feed token of the user, revoking the previous one.
+func (app *application) createFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, feedTokenTTL, model.ScopeCalendarFeed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"feed_token": token}, nil)
+}
+
+// deleteFeedTokenHandler revokes the calendar feed token of the user, so that subscribed
+// calendars stop receiving updates.
+func (app *application) deleteFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "calendar feed token revoked"}, nil)
+}
+
+func (app *application) doctorCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	doctor, err := app.models.Doctors.Get(doctorID)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	appointments, err := app.models.Appointments.GetByDoctorID(doctorID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	patients := make(map[string]string)
+	summary := func(appointment *model.Appointment) string {
+		name, ok := patients[appointment.PatientId]
+		if !ok {
+			id, _ := strconv.Atoi(appointment.PatientId)
+			if patient, err := app.models.Patients.Get(id); err == nil {
+				name = patient.Name
+			}
+			patients[appointment.PatientId] = name
+		}
+		return "Appointment with " + name
+	}
+
+	app.writeCalendar(w, r, "Dr. "+doctor.Name, appointments, summary)
+}
+
+func (app *application) patientCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	patientID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsPatient(int64(patientID)) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	patient, err := app.models.Patients.Get(patientID)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	appointments, err := app.models.Appointments.GetByPatientID(patientID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	doctors := make(map[string]string)
+	summary := func(appointment *model.Appointment) string {
+		name, ok := doctors[appointment.DoctorId]
+		if !ok {
+			id, _ := strconv.Atoi(appointment.DoctorId)
+			if doctor, err := app.models.Doctors.Get(id); err == nil {
+				name = fmt.Sprintf("Dr. %s (%s)", doctor.Name, doctor.Specialty)
+			}
+			doctors[appointment.DoctorId] = name
+		}
+		return "Appointment with " + name
+	}
+
+	app.writeCalendar(w, r, patient.Name, appointments, summary)
+}
+
+// writeCalendar sends the appointments as an iCalendar feed. Every appointment keeps the same
+// UID for its whole life, and its sequence is bumped by the database on every change.
+func (app *application) writeCalendar(w http.ResponseWriter, r *http.Request, name string, appointments []*model.Appointment, summary func(*model.Appointment) string) {
+	calendar := &ical.Calendar{
+		ProdID: calendarProdID,
+		Name:   name,
+	}
+
+	for _, appointment := range appointments {
+		start, end, err := appointment.Interval()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		event := ical.Event{
+			UID:      fmt.Sprintf("appointment-%s@clinic-api", appointment.Id),
+			Sequence: appointment.Sequence,
+			Start:    start,
+			End:      end,
+			Summary:  summary(appointment),
+			Status:   calendarStatus(appointment.Status),
+		}
+		if created, err := time.Parse(time.RFC3339, appointment.CreatedAt); err == nil {
+			event.Created = created
+		}
+		if updated, err := time.Parse(time.RFC3339, appointment.UpdatedAt); err == nil {
+			event.Modified = updated
+		}
+		if appointment.CancellationReason != nil {
+			event.Description = "Cancelled: " + *appointment.CancellationReason
+		}
+
+		calendar.Events = append(calendar.Events, event)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := calendar.WriteTo(w); err != nil {
+		app.logError(r, err)
+	}
+}
+
+// calendarStatus maps the status of an appointment to the STATUS of its calendar event.
+func calendarStatus(status string) string {
+	switch status {
+	case model.StatusRequested:
+		return ical.StatusTentative
+	case model.StatusCancelled, model.StatusNoShow:
+		return ical.StatusCancelled
+	default:
+		return ical.StatusConfirmed
+	}
+}
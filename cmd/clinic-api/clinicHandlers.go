@@ -14,9 +14,10 @@ import (
 
 func (app *application) createClinicHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name    string `json:"name"`
-		City    string `json:"city"`
-		Address string `json:"address"`
+		Name     string `json:"name"`
+		City     string `json:"city"`
+		Address  string `json:"address"`
+		Timezone string `json:"timezone"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -25,10 +26,22 @@ func (app *application) createClinicHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if input.Timezone == "" {
+		input.Timezone = model.DefaultTimezone
+	}
+
 	clinic := &model.Clinic{
-		Name:    input.Name,
-		City:    input.City,
-		Address: input.Address,
+		Name:     input.Name,
+		City:     input.City,
+		Address:  input.Address,
+		Timezone: input.Timezone,
+	}
+
+	v := validator.New()
+
+	if model.ValidateClinic(v, clinic); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
 	err = app.models.Clinics.Insert(clinic)
@@ -117,9 +130,10 @@ func (app *application) updateClinicHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	var input struct {
-		Name    *string `json:"name"`
-		City    *string `json:"city"`
-		Address *string `json:"address"`
+		Name     *string `json:"name"`
+		City     *string `json:"city"`
+		Address  *string `json:"address"`
+		Timezone *string `json:"timezone"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -140,6 +154,17 @@ func (app *application) updateClinicHandler(w http.ResponseWriter, r *http.Reque
 		clinic.Address = *input.Address
 	}
 
+	if input.Timezone != nil {
+		clinic.Timezone = *input.Timezone
+	}
+
+	v := validator.New()
+
+	if model.ValidateClinic(v, clinic); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Clinics.Update(clinic)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusInternalServerError, "500 Internal Server Error")
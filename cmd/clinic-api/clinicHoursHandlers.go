@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// setOpeningHoursHandler replaces the weekly opening hours of a clinic. Bookings outside of
+// them are rejected, unless the list is empty.
+func (app *application) setOpeningHoursHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Clinics.Get(clinicID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Hours []model.OpeningHours `json:"hours"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateOpeningHours(v, input.Hours); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Clinics.SetOpeningHours(int64(clinicID), input.Hours)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	hours, err := app.models.Clinics.GetOpeningHours(int64(clinicID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"hours": hours}, nil)
+}
+
+func (app *application) getOpeningHoursHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	clinic, err := app.models.Clinics.Get(clinicID)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	hours, err := app.models.Clinics.GetOpeningHours(int64(clinicID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"timezone": clinic.Timezone, "hours": hours}, nil)
+}
+
+func (app *application) createHolidayHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Clinics.Get(clinicID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	holiday := &model.ClinicHoliday{
+		ClinicID: int64(clinicID),
+		Date:     input.Date,
+		Name:     input.Name,
+	}
+
+	v := validator.New()
+
+	if model.ValidateHoliday(v, holiday); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Clinics.InsertHoliday(holiday)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateHoliday):
+			v.AddError("date", "the clinic already has a holiday on this date")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"holiday": holiday}, nil)
+}
+
+// listHolidaysHandler returns the holidays of a clinic between the from and to dates, which
+// default to the coming year.
+func (app *application) listHolidaysHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := app.readDate(qs, "from", today, v)
+	to := app.readDate(qs, "to", from.AddDate(1, 0, 0), v)
+
+	v.Check(!to.Before(from), "to", "must not be before from")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	holidays, err := app.models.Clinics.GetHolidays(int64(clinicID), from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"holidays": holidays}, nil)
+}
+
+func (app *application) deleteHolidayHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	holidayID, err := app.readNamedIDParam(r, "holidayID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Clinics.DeleteHoliday(int64(clinicID), holidayID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
@@ -15,6 +15,14 @@ type contextKey string
 // context.
 const userContextKey = contextKey("user")
 
+// scopeContextKey is used as a key for getting and setting the access scope of the user in the
+// request context.
+const scopeContextKey = contextKey("scope")
+
+// tokenContextKey is used as a key for getting and setting the authentication token of the
+// request in the request context.
+const tokenContextKey = contextKey("token")
+
 // contextSetUser returns a new copy of the request with the provided User struct added to the
 // context.
 func (app *application) contextSetUser(r *http.Request, user *model.User) *http.Request {
@@ -29,6 +37,12 @@ func (app *application) contextGetUser(r *http.Request) (*model.User, error) {
 	var err error
 	user, ok := r.Context().Value(userContextKey).(*model.User)
 
+	// Users authenticated by other means than the Authorization header, such as the token of
+	// a calendar feed, are already in the context.
+	if ok && !user.IsAnonymous() {
+		return user, nil
+	}
+
 	log.Print("\n\nIs there user\n\n")
 	authToken := r.Header.Get("Authorization")
 
@@ -51,3 +65,31 @@ func (app *application) contextGetUser(r *http.Request) (*model.User, error) {
 
 	return user, nil
 }
+
+// contextSetAccessScope returns a new copy of the request with the provided AccessScope added
+// to the context.
+func (app *application) contextSetAccessScope(r *http.Request, scope model.AccessScope) *http.Request {
+	ctx := context.WithValue(r.Context(), scopeContextKey, scope)
+	return r.WithContext(ctx)
+}
+
+// contextGetAccessScope retrieves the AccessScope set by requirePermissions. Requests which
+// did not go through requirePermissions get an empty scope, which allows nothing.
+func (app *application) contextGetAccessScope(r *http.Request) model.AccessScope {
+	scope, _ := r.Context().Value(scopeContextKey).(model.AccessScope)
+	return scope
+}
+
+// contextSetToken returns a new copy of the request with the plaintext authentication token the
+// user was authenticated with added to the context.
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken retrieves the plaintext authentication token of the request. It is empty when
+// the user was not authenticated with the Authorization header.
+func (app *application) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
@@ -68,14 +68,8 @@ func (app *application) createDoctorHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID,
-		"doctors:write",
-		"doctors:read",
-		"patients:read",
-		"appointments:read",
-		"appointments:read",
-		"clinics:read",
-	)
+	// What the user may do comes from the role, which can be edited without a deploy.
+	err = app.models.Roles.AssignToUser(user.ID, model.RoleDoctor)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -196,6 +190,13 @@ func (app *application) updateDoctorHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Doctors may only change their own profile.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(id)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Name      *string `json:"name"`
 		Specialty *string `json:"specialty"`
@@ -232,6 +233,13 @@ func (app *application) deleteDoctorHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Doctors may only change their own profile.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(id)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	err = app.models.Doctors.Delete(id)
 	if err != nil {
 		switch {
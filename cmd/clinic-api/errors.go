@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
 )
 
 // logError method is a generic helper for logging an error message in *application, as well
@@ -76,6 +78,114 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// appointmentConflictResponse sends a JSON-formatted error message to the client with a 409
+// Conflict status code, along with the appointments that already take the time slot.
+func (app *application) appointmentConflictResponse(w http.ResponseWriter, r *http.Request, conflicts interface{}) {
+	env := envelope{
+		"error":     "the requested time slot overlaps with an existing appointment",
+		"conflicts": conflicts,
+	}
+
+	err := app.writeJSON(w, http.StatusConflict, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// invalidTransitionResponse sends a JSON-formatted error message to the client with a 409
+// Conflict status code when an appointment can not move from its current status to another.
+func (app *application) invalidTransitionResponse(w http.ResponseWriter, r *http.Request, from, to string) {
+	message := fmt.Sprintf("an appointment in status %q can not be moved to %q", from, to)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// doctorUnavailableResponse sends a JSON-formatted error with a 409 Conflict status code when
+// an appointment falls into a time-off of the doctor.
+func (app *application) doctorUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the doctor is not available at this time"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// clinicClosedResponse sends a JSON-formatted error with a 409 Conflict status code when an
+// appointment falls outside the opening hours of the clinic, or on one of its holidays.
+func (app *application) clinicClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the clinic is closed at this time"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// slotHeldResponse sends a JSON-formatted error with a 409 Conflict status code when the time
+// slot is held for another booking which is still in progress.
+func (app *application) slotHeldResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the time slot is held for another booking"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// groupSessionConflictResponse sends a JSON-formatted error with a 409 Conflict status code when
+// the doctor has a group session at the time.
+func (app *application) groupSessionConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the doctor has a group session at this time"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// sessionClosedResponse sends a JSON-formatted error with a 409 Conflict status code when a
+// group session which was cancelled or has started is joined, left or changed.
+func (app *application) sessionClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the group session was cancelled or has already started"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// tooManyHoldsResponse sends a JSON-formatted error with a 409 Conflict status code when the
+// user already holds as many slots as they may.
+func (app *application) tooManyHoldsResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("you can not hold more than %d slots at the same time, book or release one of them first", model.MaxActiveHolds)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// holdExpiredResponse sends a JSON-formatted error with a 410 Gone status code when an
+// appointment is booked with a hold which has expired, was already used, or belongs to somebody
+// else.
+func (app *application) holdExpiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the slot hold has expired or was already used"
+	app.errorResponse(w, r, http.StatusGone, message)
+}
+
+// builtinRoleResponse sends a JSON-formatted error with a 409 Conflict status code when a
+// built-in role is deleted.
+func (app *application) builtinRoleResponse(w http.ResponseWriter, r *http.Request) {
+	message := "built-in roles can not be deleted"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// resourceInUseResponse sends a JSON-formatted error with a 409 Conflict status code when a
+// resource is deleted while appointments have reserved it.
+func (app *application) resourceInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource is reserved by appointments and can not be deleted"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// policyViolationResponse sends a JSON-formatted error with a 409 Conflict status code when an
+// action breaks the cancellation and rescheduling policy of the clinic, along with the rule.
+func (app *application) policyViolationResponse(w http.ResponseWriter, r *http.Request, violation *model.PolicyViolation) {
+	env := envelope{
+		"error": violation.Message,
+		"rule":  violation.Rule,
+	}
+
+	err := app.writeJSON(w, http.StatusConflict, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// offerExpiredResponse sends a JSON-formatted error with a 410 Gone status code when a waitlist
+// offer is answered after it expired or was already answered.
+func (app *application) offerExpiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this offer has expired or was already answered"
+	app.errorResponse(w, r, http.StatusGone, message)
+}
+
 // invalidCredentialsResponse sends a JSON-formatted error with a 401 Unauthorized status code
 // to the client.
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
@@ -92,6 +202,13 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+// invalidRefreshTokenResponse sends a JSON-formatted error with a 401 Unauthorized status code
+// to the client, which has to log in again.
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid, expired or revoked refresh token, please log in again"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 // authenticationRequiredResponse sends a JSON-formatted error with a 401 Unauthorized status code
 // to the client.
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
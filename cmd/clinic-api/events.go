@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/lib/pq"
+)
+
+// appointmentEventsChannel is the NOTIFY channel the appointments_notify trigger publishes on.
+const appointmentEventsChannel = "appointment_events"
+
+const (
+	// eventBufferSize is how many events a stream may fall behind before it is closed. Clients
+	// reconnect and fetch the current state again, which is better than silently missing events.
+	eventBufferSize = 64
+
+	// eventHeartbeat is how often an idle stream sends a comment, so that proxies keep it open.
+	eventHeartbeat = 30 * time.Second
+)
+
+// appointmentEvent is a change of an appointment. Appointment holds its new state, and is nil
+// for deleted appointments. Resync events carry nothing, and tell clients that events may have
+// been lost while the connection to the database was down.
+type appointmentEvent struct {
+	Event         string             `json:"event"`
+	AppointmentID int64              `json:"appointmentId,omitempty"`
+	ClinicID      int64              `json:"clinicId,omitempty"`
+	DoctorID      int64              `json:"doctorId,omitempty"`
+	PatientID     int64              `json:"patientId,omitempty"`
+	Appointment   *model.Appointment `json:"appointment,omitempty"`
+}
+
+// eventBroker fans the appointment events out to the open streams.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan appointmentEvent]struct{}
+	closed      bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[chan appointmentEvent]struct{})}
+}
+
+// subscribe returns a channel receiving every event from now on, and a function to stop. The
+// channel is closed when the stream falls behind or the broker shuts down.
+func (b *eventBroker) subscribe() (<-chan appointmentEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan appointmentEvent, eventBufferSize)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *eventBroker) publish(event appointmentEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// close ends every stream, and the ones opened later right away.
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.closed = true
+}
+
+// startEventListener listens for the NOTIFYs of the appointments_notify trigger in the
+// background, and publishes them to the event broker until ctx is cancelled.
+func (app *application) startEventListener(ctx context.Context) {
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"listener": appointmentEventsChannel})
+		}
+	})
+
+	err := listener.Listen(appointmentEventsChannel)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"listener": appointmentEventsChannel})
+	}
+
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+		defer app.events.close()
+		defer listener.Close()
+
+		ticker := time.NewTicker(90 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case n := <-listener.Notify:
+				// A nil notification means the connection was lost and re-established.
+				if n == nil {
+					app.events.publish(appointmentEvent{Event: "resync"})
+					continue
+				}
+				app.publishAppointmentEvent(n.Extra)
+
+			case <-ticker.C:
+				// Make sure a silently dropped connection is noticed and re-established.
+				go listener.Ping()
+			}
+		}
+	}()
+}
+
+// publishAppointmentEvent reads the appointment of a notification once for all streams.
+func (app *application) publishAppointmentEvent(payload string) {
+	// Recover any panic, so that a single broken event can neither bring down the server nor
+	// stop the events which follow it.
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+
+	var event appointmentEvent
+
+	err := json.Unmarshal([]byte(payload), &event)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"payload": payload})
+		return
+	}
+
+	if event.Event != "deleted" {
+		appointment, err := app.models.Appointments.Get(int(event.AppointmentID))
+		if err != nil {
+			// The appointment was deleted again in the meantime.
+			if !errors.Is(err, model.ErrRecordNotFound) {
+				app.logger.PrintError(err, map[string]string{"appointment": strconv.FormatInt(event.AppointmentID, 10)})
+			}
+			return
+		}
+		event.Appointment = appointment
+	}
+
+	app.events.publish(event)
+}
+
+// appointmentEventsHandler streams the changes of the appointments the user can access as
+// Server-Sent Events, optionally only the ones of the "clinic_id" or "doctor_id" query.
+func (app *application) appointmentEventsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var clinicID, doctorID int64
+	for key, id := range map[string]*int64{"clinic_id": &clinicID, "doctor_id": &doctorID} {
+		if s := qs.Get(key); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 1 {
+				app.failedValidationResponse(w, r, map[string]string{key: "must be a positive integer"})
+				return
+			}
+			*id = n
+		}
+	}
+
+	scope := app.contextGetAccessScope(r)
+
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+
+	// Streams outlive the write timeout of the server.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if event.Event != "resync" {
+				if clinicID != 0 && event.ClinicID != clinicID || doctorID != 0 && event.DoctorID != doctorID {
+					continue
+				}
+				if !scope.All && !scope.IsPatient(event.PatientID) && !scope.IsDoctor(event.DoctorID) {
+					continue
+				}
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				app.logError(r, err)
+				return
+			}
+
+			id := ""
+			if event.Appointment != nil {
+				id = fmt.Sprintf("id: %d-%d\n", event.AppointmentID, event.Appointment.Sequence)
+			}
+
+			if _, err := fmt.Fprintf(w, "%sevent: %s\ndata: %s\n\n", id, event.Event, data); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
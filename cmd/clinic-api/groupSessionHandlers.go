@@ -0,0 +1,486 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/Zhassulan1/Go_Project/pkg/notify"
+)
+
+// createGroupSessionHandler schedules a session of the doctor with many patients. The time of the
+// session must be free in the calendar of the doctor, like the time of an appointment.
+func (app *application) createGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Doctors.Get(doctorID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Date        string `json:"date"`
+		StartTime   string `json:"startTime"`
+		EndTime     string `json:"endTime"`
+		Capacity    int    `json:"capacity"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session := &model.GroupSession{
+		DoctorID:    int64(doctorID),
+		Title:       input.Title,
+		Description: input.Description,
+		Date:        input.Date,
+		StartTime:   input.StartTime,
+		EndTime:     input.EndTime,
+		Capacity:    input.Capacity,
+	}
+
+	v := validator.New()
+
+	if model.ValidateGroupSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Sessions.Insert(session)
+	if err != nil {
+		app.groupSessionSlotError(w, r, session, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"session": session}, nil)
+}
+
+// groupSessionSlotError sends the response for an error of scheduling a session at a time which
+// is not free.
+func (app *application) groupSessionSlotError(w http.ResponseWriter, r *http.Request, session *model.GroupSession, err error) {
+	switch {
+	case errors.Is(err, model.ErrAppointmentConflict):
+		app.appointmentConflict(w, r, &model.Appointment{
+			DoctorId:  strconv.FormatInt(session.DoctorID, 10),
+			Date:      session.Date,
+			StartTime: session.StartTime,
+			EndTime:   session.EndTime,
+		})
+	case errors.Is(err, model.ErrGroupSession):
+		app.groupSessionConflictResponse(w, r)
+	case errors.Is(err, model.ErrSlotHeld):
+		app.slotHeldResponse(w, r)
+	case errors.Is(err, model.ErrDoctorUnavailable):
+		app.doctorUnavailableResponse(w, r)
+	case errors.Is(err, model.ErrClinicClosed):
+		app.clinicClosedResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listGroupSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	sessions, err := app.models.Sessions.GetAllForDoctor(int64(doctorID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+}
+
+func (app *application) getGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readGroupSession(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+}
+
+// readGroupSession fetches the session of the id parameter. When it fails, the response has
+// been sent already.
+func (app *application) readGroupSession(w http.ResponseWriter, r *http.Request) (*model.GroupSession, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	session, err := app.models.Sessions.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return session, true
+}
+
+// updateGroupSessionHandler changes a session which has not started yet. Waitlisted patients who
+// get a place because the capacity was raised are told so.
+func (app *application) updateGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readGroupSession(w, r)
+	if !ok {
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(session.DoctorID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Date        *string `json:"date"`
+		StartTime   *string `json:"startTime"`
+		EndTime     *string `json:"endTime"`
+		Capacity    *int    `json:"capacity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		session.Title = *input.Title
+	}
+	if input.Description != nil {
+		session.Description = *input.Description
+	}
+	if input.Date != nil {
+		session.Date = *input.Date
+	}
+	if input.StartTime != nil {
+		session.StartTime = *input.StartTime
+	}
+	if input.EndTime != nil {
+		session.EndTime = *input.EndTime
+	}
+	if input.Capacity != nil {
+		session.Capacity = *input.Capacity
+	}
+
+	v := validator.New()
+
+	if model.ValidateGroupSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	promoted, err := app.models.Sessions.Update(session)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrSessionClosed):
+			app.sessionClosedResponse(w, r)
+		case errors.Is(err, model.ErrCapacityTooLow):
+			v.AddError("capacity", "must not be less than the number of registered participants")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.groupSessionSlotError(w, r, session, err)
+		}
+		return
+	}
+
+	if len(promoted) > 0 {
+		app.background(func() {
+			app.notifyGroupSession(session.ID, promoted, promotedMessage)
+		})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+}
+
+// cancelGroupSessionHandler cancels a session which has not started yet and tells its
+// participants. The time of the session becomes free in the calendar of the doctor.
+func (app *application) cancelGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readGroupSession(w, r)
+	if !ok {
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(session.DoctorID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.Sessions.Cancel(session)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrSessionClosed):
+			app.sessionClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		app.notifyGroupSession(session.ID, nil, sessionCancelledMessage)
+	})
+
+	app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+}
+
+// listParticipantsHandler returns the participants of a session. Staff and the doctor of the
+// session see all of them, patients only themselves.
+func (app *application) listParticipantsHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readGroupSession(w, r)
+	if !ok {
+		return
+	}
+
+	participants, err := app.models.Sessions.GetParticipants(session.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(session.DoctorID) {
+		visible := []*model.GroupParticipant{}
+		for _, participant := range participants {
+			if scope.IsPatient(participant.PatientID) {
+				visible = append(visible, participant)
+			}
+		}
+		participants = visible
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"participants": participants}, nil)
+}
+
+// joinGroupSessionHandler adds a patient to a session. Once the session is full, the patient is
+// put on its waitlist instead.
+func (app *application) joinGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readGroupSession(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		PatientID int64 `json:"patientId"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.PatientID > 0, "patientId", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsPatient(input.PatientID) && !scope.IsDoctor(session.DoctorID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Patients.Get(int(input.PatientID)); err != nil {
+		v.AddError("patientId", "must be an existing patient")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	participant, err := app.models.Sessions.Join(session.ID, input.PatientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrSessionClosed):
+			app.sessionClosedResponse(w, r)
+		case errors.Is(err, model.ErrAlreadyParticipant):
+			v.AddError("patientId", "is already registered or waitlisted for this session")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"participant": participant}, nil)
+}
+
+// leaveGroupSessionHandler takes a patient off a session. A place freed by a registered patient
+// goes to the first waitlisted one, who is told about it.
+func (app *application) leaveGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readGroupSession(w, r)
+	if !ok {
+		return
+	}
+
+	patientID, err := app.readNamedIDParam(r, "patientID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsPatient(patientID) && !scope.IsDoctor(session.DoctorID) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	promoted, err := app.models.Sessions.Leave(session.ID, patientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrSessionClosed):
+			app.sessionClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if len(promoted) > 0 {
+		app.background(func() {
+			app.notifyGroupSession(session.ID, promoted, promotedMessage)
+		})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
+
+// setAttendanceHandler records whether a registered participant turned up, once the session
+// has started. Only staff and the doctor of the session can record it.
+func (app *application) setAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readGroupSession(w, r)
+	if !ok {
+		return
+	}
+
+	patientID, err := app.readNamedIDParam(r, "patientID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(session.DoctorID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Attendance string `json:"attendance"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateAttendance(v, input.Attendance); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	participant, err := app.models.Sessions.SetAttendance(session, patientID, input.Attendance)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrSessionClosed):
+			app.sessionClosedResponse(w, r)
+		case errors.Is(err, model.ErrSessionNotStarted):
+			app.errorResponse(w, r, http.StatusConflict, "attendance can only be recorded once the session has started")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"participant": participant}, nil)
+}
+
+// notifyGroupSession sends the message to the given participants of the session, or to all of
+// them when no patient IDs are given.
+func (app *application) notifyGroupSession(sessionID int64, patientIDs []int64, message func(*model.GroupSessionNotice) notify.Message) {
+	notices, err := app.models.Sessions.GetNotices(sessionID, patientIDs)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	for _, notice := range notices {
+		err := app.notifier.Notify(message(notice))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"session": strconv.FormatInt(sessionID, 10),
+				"patient": strconv.FormatInt(notice.PatientID, 10),
+			})
+		}
+	}
+}
+
+func promotedMessage(notice *model.GroupSessionNotice) notify.Message {
+	body := fmt.Sprintf(
+		"Hello %s,\n\na place has become free in %s with %s on %s at %s, and it is now yours.\n\n"+
+			"If you can not come, please leave the session so that the next patient on the waitlist can take the place.",
+		notice.PatientName, notice.Title, notice.DoctorName, notice.Date, notice.StartTime,
+	)
+
+	return notify.Message{
+		To:      notice.Email,
+		Subject: fmt.Sprintf("You have a place in %s on %s", notice.Title, notice.Date),
+		Body:    body,
+	}
+}
+
+func sessionCancelledMessage(notice *model.GroupSessionNotice) notify.Message {
+	body := fmt.Sprintf(
+		"Hello %s,\n\nwe are sorry, but %s with %s on %s at %s has been cancelled.",
+		notice.PatientName, notice.Title, notice.DoctorName, notice.Date, notice.StartTime,
+	)
+
+	return notify.Message{
+		To:      notice.Email,
+		Subject: fmt.Sprintf("%s on %s has been cancelled", notice.Title, notice.Date),
+		Body:    body,
+	}
+}
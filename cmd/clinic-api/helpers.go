@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
 	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
 	"github.com/gorilla/mux"
 )
@@ -31,6 +34,19 @@ func (app *application) readIDParam(r *http.Request) (int, error) {
 	return id, nil
 }
 
+// readNamedIDParam works like readIDParam, but reads the interpolated parameter with the given
+// name. It is used by nested routes such as /doctors/{id}/schedule/{scheduleID}.
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
+	param := mux.Vars(r)[name]
+
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return id, nil
+}
+
 // writeJSON marshals data structure to encoded JSON response. It returns an error if there are
 // any issues, else error is nil.
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope,
@@ -201,3 +217,91 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	// Otherwise, return the converted integer value.
 	return i
 }
+
+// readDate reads a YYYY-MM-DD date from the URL query string. If no matching key is found then
+// it returns the provided default value. If the value couldn't be parsed, then we record an error
+// message in the provided Validator instance, and return the default value.
+func (app *application) readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(model.DateLayout, s)
+	if err != nil {
+		v.AddError(key, "must be a date in YYYY-MM-DD format")
+		return defaultValue
+	}
+
+	return t
+}
+
+// readID reads a positive ID from the URL query string. If no matching key is found then it
+// returns the provided default value. If the value couldn't be parsed, then we record an error
+// message in the provided Validator instance, and return the default value.
+func (app *application) readID(qs url.Values, key string, defaultValue int64, v *validator.Validator) int64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		v.AddError(key, "must be a positive integer")
+		return defaultValue
+	}
+
+	return id
+}
+
+// readIDs reads a comma-separated list of IDs, such as "1,4,7", from the URL query string. If no
+// matching key is found then it returns nil. If one of the IDs couldn't be parsed, then we
+// record an error message in the provided Validator instance, and return nil.
+func (app *application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	var ids []int64
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id < 1 {
+			v.AddError(key, "must be a comma-separated list of IDs")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// background runs fn in a goroutine tracked by app.wg, so that serve() waits for it to finish
+// before the application exits. A panic in fn is logged instead of bringing down the server.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// clientIP returns the IP address of the client the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// startHoldSweeper launches the background goroutine which releases expired slot holds. Expired
+// holds never block a booking, so the sweeper only keeps the table small. It also hands the slots
+// of waitlist offers which ran out unanswered to the next patients. It is tracked by app.wg, so
+// that serve() waits for it to stop once ctx is cancelled.
+func (app *application) startHoldSweeper(ctx context.Context) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.holds.sweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			app.sweepHolds()
+			app.sweepOffers()
+		}
+	}()
+}
+
+// sweepHolds releases the expired slot holds once.
+func (app *application) sweepHolds() {
+	// Recover any panic, so that a failing sweep can neither bring down the server nor stop the
+	// following sweeps.
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+
+	released, err := app.models.Holds.DeleteExpired()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if released > 0 {
+		app.logger.PrintInfo("released expired slot holds", map[string]string{
+			"count": strconv.FormatInt(released, 10),
+		})
+	}
+}
+
+// createHoldHandler holds a free slot of the doctor for the user while they fill in the rest of
+// the booking. Nobody else can book or hold the slot until the hold is used, released or
+// expires.
+func (app *application) createHoldHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Doctors.Get(doctorID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Only people who could book the slot afterwards may hold it.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && scope.PatientID == nil && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Date      string `json:"date"`
+		StartTime string `json:"startTime"`
+		EndTime   string `json:"endTime"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	hold := &model.SlotHold{
+		DoctorID:  int64(doctorID),
+		UserID:    user.ID,
+		Date:      input.Date,
+		StartTime: input.StartTime,
+		EndTime:   input.EndTime,
+	}
+
+	v := validator.New()
+
+	if model.ValidateSlotHold(v, hold); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Holds.Insert(hold, app.config.holds.ttl)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAppointmentConflict):
+			app.appointmentConflict(w, r, &model.Appointment{
+				DoctorId:  strconv.Itoa(doctorID),
+				Date:      hold.Date,
+				StartTime: hold.StartTime,
+				EndTime:   hold.EndTime,
+			})
+		case errors.Is(err, model.ErrSlotHeld):
+			app.slotHeldResponse(w, r)
+		case errors.Is(err, model.ErrTooManyHolds):
+			app.tooManyHoldsResponse(w, r)
+		case errors.Is(err, model.ErrGroupSession):
+			app.groupSessionConflictResponse(w, r)
+		case errors.Is(err, model.ErrDoctorUnavailable):
+			app.doctorUnavailableResponse(w, r)
+		case errors.Is(err, model.ErrClinicClosed):
+			app.clinicClosedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"hold": hold}, nil)
+}
+
+// deleteHoldHandler releases a hold before it expires. Only the user who holds the slot and
+// staff can release it.
+func (app *application) deleteHoldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	hold, err := app.models.Holds.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	if hold.UserID != user.ID && !app.contextGetAccessScope(r).All {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Holds.Delete(hold.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
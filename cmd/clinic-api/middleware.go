@@ -65,8 +65,16 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Keep the last use of the token up to date for the list of sessions of the user. The
+		// request goes on when this fails.
+		err = app.models.Tokens.Touch(token, clientIP(r), r.UserAgent())
+		if err != nil {
+			app.logError(r, err)
+		}
+
 		// Call the contextSetUser healer to add the user information to the request context.
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 
 		// Call next handler in chain
 		next.ServeHTTP(w, r)
@@ -139,9 +147,51 @@ func (app *application) requirePermissions(code string, next http.HandlerFunc) h
 			return
 		}
 
+		// Resolve which patients and appointments the user may see, so that the handlers can
+		// limit their results to the user's own records.
+		scope, err := app.models.Permissions.GetAccessScope(user.ID, permissions)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		r = app.contextSetAccessScope(r, scope)
+
 		// Otherwise, they have the required permission so we call the next handler in the chain.
 		next.ServeHTTP(w, r)
 	})
 	// Wrap this with the requireActivatedUser middleware before returning
 	return app.requireActivatedUser(fn)
 }
+
+// authenticateFeed authenticates the request with the calendar feed token in the "token" query
+// string parameter, if there is one. Calendar clients can't send an Authorization header, so
+// this is the only way they can authenticate.
+func (app *application) authenticateFeed(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+
+		if model.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(model.ScopeCalendarFeed, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, app.contextSetUser(r, user))
+	})
+}
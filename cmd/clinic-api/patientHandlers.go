@@ -65,14 +65,8 @@ func (app *application) createPatientHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID,
-		"patients:write",
-		"patients:read",
-		"doctors:read",
-		"appointments:write",
-		"appointments:read",
-		"clinics:read",
-	)
+	// What the user may do comes from the role, which can be edited without a deploy.
+	err = app.models.Roles.AssignToUser(user.ID, model.RolePatient)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -145,7 +139,9 @@ func (app *application) SearchPatientHandler(w http.ResponseWriter, r *http.Requ
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	patients, metadata, err := app.models.Patients.GetAll(input.Name, input.Gender, input.Filters)
+	scope := app.contextGetAccessScope(r)
+
+	patients, metadata, err := app.models.Patients.GetAll(input.Name, input.Gender, input.Filters, scope)
 	if err != nil {
 		fmt.Println("We are in search patient handler", "\nname: ", input.Name, "\nbirthdate: ", input.Gender, "\n", input.Filters)
 		fmt.Print("\nError: ", err)
@@ -166,6 +162,16 @@ func (app *application) getPatientHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	ok, err := app.models.Patients.CanAccess(id, app.contextGetAccessScope(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, "404 Not Found")
+		return
+	}
+
 	patient, err := app.models.Patients.Get(id)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusNotFound, "404 Not Found")
@@ -185,6 +191,11 @@ func (app *application) updatePatientHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if !app.canWritePatient(r, id) {
+		app.errorResponse(w, r, http.StatusNotFound, "404 Not Found")
+		return
+	}
+
 	patient, err := app.models.Patients.Get(id)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusNotFound, "404 Not Found")
@@ -230,6 +241,11 @@ func (app *application) deletePatientHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if !app.canWritePatient(r, id) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
 	err = app.models.Patients.Delete(id)
 	if err != nil {
 		switch {
@@ -242,3 +258,39 @@ func (app *application) deletePatientHandler(w http.ResponseWriter, r *http.Requ
 	}
 	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
 }
+
+// canWritePatient reports whether the user of the request may change the patient record. Unlike
+// reading, this is limited to the patient themselves and to staff, not their doctors.
+func (app *application) canWritePatient(r *http.Request, id int) bool {
+	scope := app.contextGetAccessScope(r)
+	return scope.All || scope.IsPatient(int64(id))
+}
+
+// clearNoShowsHandler lifts the booking restriction of a patient who has reached the no-show
+// limit of a clinic. The no-shows themselves are kept, and still count towards the rate.
+func (app *application) clearNoShowsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	patient, err := app.models.Patients.Get(id)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Patients.ClearNoShows(patient)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"patient": patient}, nil)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+func (app *application) getClinicPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	policy, err := app.models.Policies.Get(int64(clinicID))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"policy": policy}, nil)
+}
+
+// setClinicPolicyHandler replaces the cancellation and rescheduling policy of a clinic. Limits
+// which are left out or null are lifted, and the no-show window defaults to 90 days.
+func (app *application) setClinicPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Clinics.Get(clinicID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		CancellationNoticeMinutes int  `json:"cancellationNoticeMinutes"`
+		RescheduleNoticeMinutes   int  `json:"rescheduleNoticeMinutes"`
+		MaxReschedules            *int `json:"maxReschedules"`
+		BookingHorizonDays        *int `json:"bookingHorizonDays"`
+		NoShowLimit               *int `json:"noShowLimit"`
+		NoShowWindowDays          *int `json:"noShowWindowDays"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	policy := &model.ClinicPolicy{
+		ClinicID:                  int64(clinicID),
+		CancellationNoticeMinutes: input.CancellationNoticeMinutes,
+		RescheduleNoticeMinutes:   input.RescheduleNoticeMinutes,
+		MaxReschedules:            input.MaxReschedules,
+		BookingHorizonDays:        input.BookingHorizonDays,
+		NoShowLimit:               input.NoShowLimit,
+		NoShowWindowDays:          model.DefaultNoShowWindowDays,
+	}
+	if input.NoShowWindowDays != nil {
+		policy.NoShowWindowDays = *input.NoShowWindowDays
+	}
+
+	v := validator.New()
+
+	if model.ValidateClinicPolicy(v, policy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Policies.Set(policy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"policy": policy}, nil)
+}
+
+// enforcePolicy reports whether an action which may break a rule of the clinic policy can go
+// ahead. Staff can break the rule by giving a reason for the override. Everybody else, and staff
+// without a reason, get a policy violation response.
+func (app *application) enforcePolicy(w http.ResponseWriter, r *http.Request, violation *model.PolicyViolation, overrideReason string) bool {
+	if violation == nil {
+		return true
+	}
+
+	if app.contextGetAccessScope(r).All && strings.TrimSpace(overrideReason) != "" {
+		return true
+	}
+
+	app.policyViolationResponse(w, r, violation)
+	return false
+}
+
+// enforceBookingPolicy checks new appointments, all of the same patient with the same doctor,
+// against the booking horizon and the no-show limit of the clinic policy, like enforcePolicy. It returns the
+// rules broken with an override, which are to be recorded once the appointments are booked.
+func (app *application) enforceBookingPolicy(w http.ResponseWriter, r *http.Request, appointments []*model.Appointment, overrideReason string) ([]*model.PolicyViolation, bool) {
+	if len(appointments) == 0 {
+		return nil, true
+	}
+
+	policy, err := app.models.Policies.GetForDoctor(appointments[0].DoctorId)
+	if err != nil {
+		// Unknown doctors are rejected when the appointments are inserted.
+		if errors.Is(err, model.ErrRecordNotFound) {
+			return nil, true
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	// Patients who often do not turn up need staff to book for them.
+	noShows, err := app.models.Policies.CheckNoShows(policy, appointments[0].PatientId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	// A series breaks the booking horizon as soon as one of its occurrences is beyond it.
+	now := time.Now()
+	var horizon *model.PolicyViolation
+	for _, appointment := range appointments {
+		if horizon = policy.CheckBooking(appointment, now); horizon != nil {
+			break
+		}
+	}
+
+	var violations []*model.PolicyViolation
+	for _, violation := range []*model.PolicyViolation{horizon, noShows} {
+		if !app.enforcePolicy(w, r, violation, overrideReason) {
+			return nil, false
+		}
+		if violation != nil {
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations, true
+}
+
+// recordOverride records that the user broke the rule of the violation, if there was one. The
+// action has already happened by then, so a failure is only logged.
+func (app *application) recordOverride(r *http.Request, appointmentID, action string, violation *model.PolicyViolation, reason string) {
+	if violation == nil {
+		return
+	}
+
+	id, _ := strconv.ParseInt(appointmentID, 10, 64)
+
+	override := &model.PolicyOverride{
+		AppointmentID: id,
+		Action:        action,
+		Rule:          violation.Rule,
+		Reason:        strings.TrimSpace(reason),
+	}
+	if user, err := app.contextGetUser(r); err == nil {
+		override.UserID = &user.ID
+	}
+
+	err := app.models.Policies.InsertOverride(override)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// rescheduleAppointmentHandler moves an appointment to another time, and optionally another
+// doctor. The original is cancelled and the new appointment links back to it.
+func (app *application) rescheduleAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	original, err := app.getAccessibleAppointment(r, id)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		DoctorID       *string `json:"doctorId"`
+		Date           string  `json:"date"`
+		StartTime      string  `json:"startTime"`
+		EndTime        string  `json:"endTime"`
+		OverrideReason string  `json:"overrideReason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	replacement := &model.Appointment{
+		PatientId:           original.PatientId,
+		DoctorId:            original.DoctorId,
+		Date:                input.Date,
+		StartTime:           input.StartTime,
+		EndTime:             input.EndTime,
+		TypeID:              original.TypeID,
+		BufferBeforeMinutes: original.BufferBeforeMinutes,
+		BufferAfterMinutes:  original.BufferAfterMinutes,
+		ResourceIDs:         original.ResourceIDs,
+	}
+	if input.DoctorID != nil {
+		replacement.DoctorId = *input.DoctorID
+	}
+
+	v := validator.New()
+
+	model.ValidateOverrideReason(v, input.OverrideReason)
+
+	// Appointments of a type keep its duration, unless the end time is given.
+	if replacement.TypeID != nil && (input.DoctorID != nil || input.EndTime == "") {
+		err = app.applyAppointmentType(v, replacement, *replacement.TypeID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		v.Check(input.EndTime != "", "endTime", "must be provided")
+	}
+	if model.ValidateAppointment(v, replacement); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.contextGetAccessScope(r).CanBook(replacement.PatientId, replacement.DoctorId) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	policy, err := app.models.Policies.GetForDoctor(original.DoctorId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	violation := policy.CheckReschedule(original, replacement, time.Now())
+	if !app.enforcePolicy(w, r, violation, input.OverrideReason) {
+		return
+	}
+
+	from := original.Status
+
+	err = app.models.Appointments.Reschedule(original, replacement, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, from, model.StatusCancelled)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrAppointmentConflict):
+			app.appointmentConflict(w, r, replacement)
+		case errors.Is(err, model.ErrDoctorUnavailable):
+			app.doctorUnavailableResponse(w, r)
+		case errors.Is(err, model.ErrClinicClosed):
+			app.clinicClosedResponse(w, r)
+		case errors.Is(err, model.ErrSlotHeld):
+			app.slotHeldResponse(w, r)
+		case errors.Is(err, model.ErrGroupSession):
+			app.groupSessionConflictResponse(w, r)
+		case errors.Is(err, model.ErrUnknownResource):
+			v.AddError("doctorId", "must be a doctor of the clinic which has the reserved resources")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.recordOverride(r, original.Id, model.PolicyActionReschedule, violation, input.OverrideReason)
+	app.offerFreedSlot(original)
+
+	app.writeJSON(w, http.StatusCreated, envelope{"appointment": replacement, "rescheduled": original}, nil)
+}
+
+// appointmentHistoryHandler returns the appointments the given one replaced through
+// reschedules, and the policy overrides staff made for any of them.
+func (app *application) appointmentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	appointment, err := app.getAccessibleAppointment(r, id)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reschedules, err := app.models.Appointments.GetRescheduleHistory(appointment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ids := []int64{int64(id)}
+	for _, previous := range reschedules {
+		previousID, _ := strconv.ParseInt(previous.Id, 10, 64)
+		ids = append(ids, previousID)
+	}
+
+	overrides, err := app.models.Policies.GetOverrides(ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"reschedules": reschedules, "overrides": overrides}, nil)
+}
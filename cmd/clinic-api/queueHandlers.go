@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// clinicNow returns the current wall clock time of the clinic, with the UTC location like the
+// dates read by readDate and the slots of the schedules.
+func clinicNow(clinic *model.Clinic) time.Time {
+	now := time.Now().UTC()
+	if loc, err := model.LoadLocation(clinic.Timezone); err == nil {
+		now = now.In(loc)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(), 0, time.UTC)
+}
+
+// clinicToday returns the current date in the time zone of the clinic, as a UTC midnight like
+// the dates read by readDate.
+func clinicToday(clinic *model.Clinic) time.Time {
+	return clinicNow(clinic).Truncate(24 * time.Hour)
+}
+
+// getQueueHandler returns the waiting room of a clinic on the "date" query day, which defaults
+// to today: the checked-in patients and the ones being seen, by doctor and queue number. Doctors
+// only get their own queue.
+func (app *application) getQueueHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	clinic, err := app.models.Clinics.Get(clinicID)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Doctors only see their own waiting patients.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && scope.DoctorID == nil {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	date := app.readDate(r.URL.Query(), "date", clinicToday(clinic), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	queue, err := app.models.Appointments.GetQueue(int64(clinicID), date, scope)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"date": date.Format(model.DateLayout), "queue": queue}, nil)
+}
+
+// callNextHandler starts the visit of the patient with the lowest queue number among the ones
+// waiting for the doctor today. Only staff and the doctor themselves can call their patients.
+func (app *application) callNextHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	doctorID, err := app.readNamedIDParam(r, "doctorID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	clinic, err := app.models.Clinics.Get(clinicID)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	doctor, err := app.models.Doctors.Get(int(doctorID))
+	if err != nil || doctor.ClinicID != clinicID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(doctorID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	appointment, err := app.models.Appointments.NextInQueue(doctorID, clinicToday(clinic))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, "no patients are waiting for the doctor")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Appointments.SetStatus(appointment, model.StatusInProgress, user.ID, "")
+	if err != nil {
+		switch {
+		// Somebody else called the same patient in the meantime.
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"appointment": appointment}, nil)
+}
+
+// markSeenHandler completes the visit of a patient from the queue of the clinic.
+func (app *application) markSeenHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	appointmentID, err := app.readNamedIDParam(r, "appointmentID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	appointment, err := app.getAccessibleAppointment(r, int(appointmentID))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	doctorID, _ := strconv.Atoi(appointment.DoctorId)
+	doctor, err := app.models.Doctors.Get(doctorID)
+	if err != nil || doctor.ClinicID != clinicID || appointment.QueueNumber == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	from := appointment.Status
+
+	err = app.models.Appointments.SetStatus(appointment, model.StatusCompleted, user.ID, "")
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, from, model.StatusCompleted)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"appointment": appointment}, nil)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/Zhassulan1/Go_Project/pkg/notify"
+)
+
+// reassignAppointmentsHandler moves the upcoming appointments of a doctor between two dates to
+// a colleague at the same clinic, or to any free doctor of the same specialty there when no
+// toDoctorId is given. The report lists the moved and the unmovable appointments, and the
+// patients of the moved ones are told about their new doctor.
+func (app *application) reassignAppointmentsHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	doctor, err := app.models.Doctors.Get(doctorID)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Doctors can only hand over their own appointments; moving anybody else's is for staff.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		DateFrom   string `json:"dateFrom"`
+		DateTo     string `json:"dateTo"`
+		ToDoctorID int64  `json:"toDoctorId"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	reassignment := &model.Reassignment{
+		FromDoctorID: int64(doctorID),
+		ToDoctorID:   input.ToDoctorID,
+		DateFrom:     input.DateFrom,
+		DateTo:       input.DateTo,
+	}
+
+	v := validator.New()
+
+	model.ValidateReassignment(v, reassignment)
+	if input.ToDoctorID != 0 {
+		target, err := app.models.Doctors.Get(int(input.ToDoctorID))
+		v.Check(err == nil && target.ClinicID == doctor.ClinicID, "toDoctorId", "must be a doctor of the same clinic")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	report, err := app.models.Appointments.Reassign(reassignment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(report.Moved) > 0 {
+		ids := make([]int64, len(report.Moved))
+		for i, moved := range report.Moved {
+			ids[i] = moved.AppointmentID
+		}
+
+		app.background(func() {
+			app.notifyReassigned(ids, doctor.Name)
+		})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+}
+
+// notifyReassigned tells the patients of the reassigned appointments who their new doctor is.
+func (app *application) notifyReassigned(ids []int64, previousDoctor string) {
+	notices, err := app.models.Reminders.GetForAppointments(ids)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	for _, notice := range notices {
+		err := app.notifier.Notify(reassignedMessage(notice, previousDoctor))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"appointment": strconv.FormatInt(notice.AppointmentID, 10),
+			})
+		}
+	}
+}
+
+func reassignedMessage(notice *model.Reminder, previousDoctor string) notify.Message {
+	body := fmt.Sprintf(
+		"Hello %s,\n\n%s is not available for your appointment on %s at %s, so it has been moved to %s (%s). "+
+			"The date and time stay the same.\n\n"+
+			"If this does not suit you, please cancel the appointment and book another one.",
+		notice.PatientName, previousDoctor, notice.Date, notice.StartTime, notice.DoctorName, notice.Specialty,
+	)
+
+	return notify.Message{
+		To:      notice.Email,
+		Subject: fmt.Sprintf("Your appointment on %s at %s has a new doctor", notice.Date, notice.StartTime),
+		Body:    body,
+	}
+}
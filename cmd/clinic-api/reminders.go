@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/notify"
+)
+
+// startReminders launches the background goroutine which reminds patients of their upcoming
+// appointments. It is tracked by app.wg, so that serve() waits for it to finish the reminders
+// it is sending once ctx is cancelled.
+func (app *application) startReminders(ctx context.Context) {
+	if len(app.config.reminders.leads) == 0 {
+		return
+	}
+
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.reminders.interval)
+		defer ticker.Stop()
+
+		for {
+			// Recover any panic, so that a single broken reminder can neither bring down the
+			// server nor stop the reminders of the following ticks.
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						app.logger.PrintError(fmt.Errorf("%s", err), nil)
+					}
+				}()
+
+				app.sendReminders(ctx)
+			}()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sendReminders sends every reminder which is due now. The leads are sorted from the shortest to
+// the longest, and each lead only covers the appointments the shorter one doesn't.
+func (app *application) sendReminders(ctx context.Context) {
+	var after time.Duration
+
+	for _, lead := range app.config.reminders.leads {
+		reminders, err := app.models.Reminders.GetDue(lead, after)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"lead": lead.String()})
+			return
+		}
+
+		for _, reminder := range reminders {
+			if ctx.Err() != nil {
+				return
+			}
+
+			properties := map[string]string{
+				"appointment": strconv.FormatInt(reminder.AppointmentID, 10),
+				"lead":        lead.String(),
+			}
+
+			// Another instance of the API may be sending the same reminder.
+			claimed, err := app.models.Reminders.Claim(reminder)
+			if err != nil {
+				app.logger.PrintError(err, properties)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+
+			err = app.notifier.Notify(reminderMessage(reminder))
+			if err != nil {
+				app.logger.PrintError(err, properties)
+
+				err = app.models.Reminders.Release(reminder)
+				if err != nil {
+					app.logger.PrintError(err, properties)
+				}
+			}
+		}
+
+		after = lead
+	}
+}
+
+func reminderMessage(reminder *model.Reminder) notify.Message {
+	body := fmt.Sprintf(
+		"Hello %s,\n\nthis is a reminder of your appointment with %s (%s) on %s at %s.\n\n",
+		reminder.PatientName, reminder.DoctorName, reminder.Specialty, reminder.Date, reminder.StartTime,
+	)
+	if reminder.Preparation != "" {
+		body += "How to prepare:\n" + reminder.Preparation + "\n\n"
+	}
+	body += "If you can not come, please cancel the appointment so that another patient can take the slot."
+
+	return notify.Message{
+		To:      reminder.Email,
+		Subject: fmt.Sprintf("Reminder: your appointment on %s at %s", reminder.Date, reminder.StartTime),
+		Body:    body,
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+func (app *application) createResourceHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Clinics.Get(clinicID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        string `json:"name"`
+		Kind        string `json:"kind"`
+		Description string `json:"description"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	resource := &model.Resource{
+		ClinicID:    int64(clinicID),
+		Name:        input.Name,
+		Kind:        input.Kind,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+
+	if model.ValidateResource(v, resource); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Resources.Insert(resource)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"resource": resource}, nil)
+}
+
+// listResourcesHandler returns the resources of a clinic, optionally only the ones of the kind
+// given in the "kind" query.
+func (app *application) listResourcesHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	kind := app.readStrings(r.URL.Query(), "kind", "")
+
+	v := validator.New()
+	v.Check(kind == "" || validator.In(kind, model.ResourceRoom, model.ResourceEquipment), "kind", "must be room or equipment")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	resources, err := app.models.Resources.GetAllForClinic(int64(clinicID), kind)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"resources": resources}, nil)
+}
+
+func (app *application) getResourceHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	resourceID, err := app.readNamedIDParam(r, "resourceID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	resource, err := app.models.Resources.Get(int64(clinicID), resourceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"resource": resource}, nil)
+}
+
+func (app *application) updateResourceHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	resourceID, err := app.readNamedIDParam(r, "resourceID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	resource, err := app.models.Resources.Get(int64(clinicID), resourceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Kind        *string `json:"kind"`
+		Description *string `json:"description"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		resource.Name = *input.Name
+	}
+	if input.Kind != nil {
+		resource.Kind = *input.Kind
+	}
+	if input.Description != nil {
+		resource.Description = *input.Description
+	}
+
+	v := validator.New()
+
+	if model.ValidateResource(v, resource); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Resources.Update(resource)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"resource": resource}, nil)
+}
+
+func (app *application) deleteResourceHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	resourceID, err := app.readNamedIDParam(r, "resourceID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Resources.Delete(int64(clinicID), resourceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrResourceInUse):
+			app.resourceInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
+
+// utilisationHandler shows for the rooms of a clinic (or the resources of the kind given in the
+// "kind" query) the appointments reserving them on the "date" query day, which defaults to today,
+// and the share of the opening hours they take.
+func (app *application) utilisationHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Clinics.Get(clinicID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	date := app.readDate(qs, "date", time.Now().UTC().Truncate(24*time.Hour), v)
+	kind := app.readStrings(qs, "kind", model.ResourceRoom)
+
+	v.Check(validator.In(kind, model.ResourceRoom, model.ResourceEquipment), "kind", "must be room or equipment")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	utilisation, err := app.models.Resources.GetUtilisation(int64(clinicID), date, kind)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"date": date.Format(model.DateLayout), "utilisation": utilisation}
+	app.writeJSON(w, http.StatusOK, env, nil)
+}
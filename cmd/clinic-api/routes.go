@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
 	"github.com/gorilla/mux"
 )
 
@@ -23,7 +24,7 @@ func (app *application) routes() http.Handler {
 
 	// CLinic Singleton
 	// Create a new appointment
-	v1.HandleFunc("/appointments", app.createAppointmentHandler).Methods("POST")
+	v1.HandleFunc("/appointments", app.requirePermissions("appointments:write", app.createAppointmentHandler)).Methods("POST")
 	// Get a doctors list by pagination and filters
 	v1.HandleFunc("/appointments", app.requirePermissions("appointments:read", app.SearchAppointmentHandler)).Methods("GET")
 	// Get a specific appointment
@@ -32,6 +33,29 @@ func (app *application) routes() http.Handler {
 	v1.HandleFunc("/appointments/{id:[0-9]+}", app.requirePermissions("appointments:write", app.updateAppointmentHandler)).Methods("PUT")
 	// Delete a specific appointment
 	v1.HandleFunc("/appointments/{id:[0-9]+}", app.requirePermissions("appointments:write", app.deleteAppointmentHandler)).Methods("DELETE")
+	// Move an appointment through its lifecycle
+	v1.HandleFunc("/appointments/{id:[0-9]+}/confirm", app.requirePermissions("appointments:manage", app.appointmentStatusHandler(model.StatusConfirmed))).Methods("POST")
+	v1.HandleFunc("/appointments/{id:[0-9]+}/check-in", app.requirePermissions("appointments:manage", app.appointmentStatusHandler(model.StatusCheckedIn))).Methods("POST")
+	v1.HandleFunc("/appointments/{id:[0-9]+}/start", app.requirePermissions("appointments:manage", app.appointmentStatusHandler(model.StatusInProgress))).Methods("POST")
+	v1.HandleFunc("/appointments/{id:[0-9]+}/complete", app.requirePermissions("appointments:manage", app.appointmentStatusHandler(model.StatusCompleted))).Methods("POST")
+	v1.HandleFunc("/appointments/{id:[0-9]+}/no-show", app.requirePermissions("appointments:manage", app.appointmentStatusHandler(model.StatusNoShow))).Methods("POST")
+	v1.HandleFunc("/appointments/{id:[0-9]+}/cancel", app.requirePermissions("appointments:write", app.appointmentStatusHandler(model.StatusCancelled))).Methods("POST")
+	// Move an appointment to another time, keeping a link to the original
+	v1.HandleFunc("/appointments/{id:[0-9]+}/reschedule", app.requirePermissions("appointments:write", app.rescheduleAppointmentHandler)).Methods("POST")
+	// Get the appointments an appointment replaced and the policy overrides made for them
+	v1.HandleFunc("/appointments/{id:[0-9]+}/history", app.requirePermissions("appointments:read", app.appointmentHistoryHandler)).Methods("GET")
+
+	// Stream the changes of appointments as Server-Sent Events
+	v1.HandleFunc("/events/appointments", app.requirePermissions("appointments:read", app.appointmentEventsHandler)).Methods("GET")
+
+	// Create a recurring appointment series
+	v1.HandleFunc("/appointment-series", app.requirePermissions("appointments:write", app.createSeriesHandler)).Methods("POST")
+	// Get a series with all of its occurrences
+	v1.HandleFunc("/appointment-series/{id:[0-9]+}", app.requirePermissions("appointments:read", app.getSeriesHandler)).Methods("GET")
+	// Move one, the following or all occurrences of a series
+	v1.HandleFunc("/appointment-series/{id:[0-9]+}", app.requirePermissions("appointments:write", app.updateSeriesHandler)).Methods("PUT")
+	// Cancel one, the following or all occurrences of a series
+	v1.HandleFunc("/appointment-series/{id:[0-9]+}/cancel", app.requirePermissions("appointments:write", app.cancelSeriesHandler)).Methods("POST")
 
 	// Create a new doctor
 	v1.HandleFunc("/doctors", app.createDoctorHandler).Methods("POST")
@@ -44,6 +68,55 @@ func (app *application) routes() http.Handler {
 	// Delete a specific doctor
 	v1.HandleFunc("/doctors/{id:[0-9]+}", app.requirePermissions("doctors:write", app.deleteDoctorHandler)).Methods("DELETE")
 
+	// Create a weekly schedule entry for a doctor
+	v1.HandleFunc("/doctors/{id:[0-9]+}/schedule", app.requirePermissions("doctors:write", app.createScheduleHandler)).Methods("POST")
+	// Get the weekly schedule of a doctor
+	v1.HandleFunc("/doctors/{id:[0-9]+}/schedule", app.requirePermissions("doctors:read", app.listSchedulesHandler)).Methods("GET")
+	// Update a specific schedule entry
+	v1.HandleFunc("/doctors/{id:[0-9]+}/schedule/{scheduleID:[0-9]+}", app.requirePermissions("doctors:write", app.updateScheduleHandler)).Methods("PUT")
+	// Delete a specific schedule entry
+	v1.HandleFunc("/doctors/{id:[0-9]+}/schedule/{scheduleID:[0-9]+}", app.requirePermissions("doctors:write", app.deleteScheduleHandler)).Methods("DELETE")
+	// Get the free slots of a doctor between two dates
+	v1.HandleFunc("/doctors/{id:[0-9]+}/slots", app.requirePermissions("doctors:read", app.listSlotsHandler)).Methods("GET")
+
+	// Block a range of a doctor's calendar for a vacation, conference or sick leave
+	v1.HandleFunc("/doctors/{id:[0-9]+}/time-off", app.requirePermissions("doctors:write", app.createTimeOffHandler)).Methods("POST")
+	// Get the upcoming time-offs of a doctor
+	v1.HandleFunc("/doctors/{id:[0-9]+}/time-off", app.requirePermissions("doctors:read", app.listTimeOffHandler)).Methods("GET")
+	// Delete a specific time-off
+	v1.HandleFunc("/doctors/{id:[0-9]+}/time-off/{timeOffID:[0-9]+}", app.requirePermissions("doctors:write", app.deleteTimeOffHandler)).Methods("DELETE")
+
+	// Move the upcoming appointments of a doctor to colleagues in bulk
+	v1.HandleFunc("/doctors/{id:[0-9]+}/reassign", app.requirePermissions("appointments:manage", app.reassignAppointmentsHandler)).Methods("POST")
+
+	// Hold a free slot of a doctor while a booking is filled in
+	v1.HandleFunc("/doctors/{id:[0-9]+}/holds", app.requirePermissions("appointments:write", app.createHoldHandler)).Methods("POST")
+	// Release a slot hold
+	v1.HandleFunc("/holds/{id:[0-9]+}", app.requirePermissions("appointments:write", app.deleteHoldHandler)).Methods("DELETE")
+
+	// Schedule or list the group sessions of a doctor
+	v1.HandleFunc("/doctors/{id:[0-9]+}/group-sessions", app.requirePermissions("doctors:write", app.createGroupSessionHandler)).Methods("POST")
+	v1.HandleFunc("/doctors/{id:[0-9]+}/group-sessions", app.requirePermissions("appointments:read", app.listGroupSessionsHandler)).Methods("GET")
+	// Get, change or cancel a specific group session
+	v1.HandleFunc("/group-sessions/{id:[0-9]+}", app.requirePermissions("appointments:read", app.getGroupSessionHandler)).Methods("GET")
+	v1.HandleFunc("/group-sessions/{id:[0-9]+}", app.requirePermissions("doctors:write", app.updateGroupSessionHandler)).Methods("PUT")
+	v1.HandleFunc("/group-sessions/{id:[0-9]+}/cancel", app.requirePermissions("doctors:write", app.cancelGroupSessionHandler)).Methods("POST")
+	// Join, leave and list the participants of a group session, and record their attendance
+	v1.HandleFunc("/group-sessions/{id:[0-9]+}/participants", app.requirePermissions("appointments:read", app.listParticipantsHandler)).Methods("GET")
+	v1.HandleFunc("/group-sessions/{id:[0-9]+}/participants", app.requirePermissions("appointments:write", app.joinGroupSessionHandler)).Methods("POST")
+	v1.HandleFunc("/group-sessions/{id:[0-9]+}/participants/{patientID:[0-9]+}", app.requirePermissions("appointments:write", app.leaveGroupSessionHandler)).Methods("DELETE")
+	v1.HandleFunc("/group-sessions/{id:[0-9]+}/participants/{patientID:[0-9]+}/attendance", app.requirePermissions("appointments:manage", app.setAttendanceHandler)).Methods("PUT")
+
+	// Put a patient on the waitlist of a doctor
+	v1.HandleFunc("/doctors/{id:[0-9]+}/waitlist", app.requirePermissions("appointments:write", app.createWaitlistEntryHandler)).Methods("POST")
+	// Get the waitlist of a doctor with the pending offers
+	v1.HandleFunc("/doctors/{id:[0-9]+}/waitlist", app.requirePermissions("appointments:read", app.listWaitlistHandler)).Methods("GET")
+	// Take a patient off the waitlist
+	v1.HandleFunc("/doctors/{id:[0-9]+}/waitlist/{entryID:[0-9]+}", app.requirePermissions("appointments:write", app.deleteWaitlistEntryHandler)).Methods("DELETE")
+	// Accept or decline a freed slot offered to a waitlisted patient
+	v1.HandleFunc("/waitlist/offers/{id:[0-9]+}/accept", app.requirePermissions("appointments:write", app.acceptOfferHandler)).Methods("POST")
+	v1.HandleFunc("/waitlist/offers/{id:[0-9]+}/decline", app.requirePermissions("appointments:write", app.declineOfferHandler)).Methods("POST")
+
 	// Create a new patient
 	v1.HandleFunc("/patients", app.createPatientHandler).Methods("POST")
 	// Get a doctors list by pagination and filters
@@ -54,6 +127,8 @@ func (app *application) routes() http.Handler {
 	v1.HandleFunc("/patients/{id:[0-9]+}", app.requirePermissions("patients:write", app.updatePatientHandler)).Methods("PUT")
 	// Delete a specific patient
 	v1.HandleFunc("/patients/{id:[0-9]+}", app.requirePermissions("patients:write", app.deletePatientHandler)).Methods("DELETE")
+	// Lift the booking restriction of a patient with too many no-shows
+	v1.HandleFunc("/patients/{id:[0-9]+}/no-shows/clear", app.requirePermissions("patients:admin", app.clearNoShowsHandler)).Methods("POST")
 
 	// Create a new clinic
 	v1.HandleFunc("/clinics", app.createClinicHandler).Methods("POST")
@@ -66,12 +141,78 @@ func (app *application) routes() http.Handler {
 	// Delete a specific clinic
 	v1.HandleFunc("/clinics/{id:[0-9]+}", app.requirePermissions("clinics:write", app.deleteClinicHandler)).Methods("DELETE")
 
+	// Replace or get the weekly opening hours of a clinic
+	v1.HandleFunc("/clinics/{id:[0-9]+}/opening-hours", app.requirePermissions("clinics:write", app.setOpeningHoursHandler)).Methods("PUT")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/opening-hours", app.requirePermissions("clinics:read", app.getOpeningHoursHandler)).Methods("GET")
+	// Add, list and delete the holidays of a clinic
+	v1.HandleFunc("/clinics/{id:[0-9]+}/holidays", app.requirePermissions("clinics:write", app.createHolidayHandler)).Methods("POST")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/holidays", app.requirePermissions("clinics:read", app.listHolidaysHandler)).Methods("GET")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/holidays/{holidayID:[0-9]+}", app.requirePermissions("clinics:write", app.deleteHolidayHandler)).Methods("DELETE")
+
+	// Replace or get the cancellation and rescheduling policy of a clinic
+	v1.HandleFunc("/clinics/{id:[0-9]+}/policy", app.requirePermissions("clinics:write", app.setClinicPolicyHandler)).Methods("PUT")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/policy", app.requirePermissions("clinics:read", app.getClinicPolicyHandler)).Methods("GET")
+
+	// Manage the rooms and equipment of a clinic which appointments can reserve
+	v1.HandleFunc("/clinics/{id:[0-9]+}/resources", app.requirePermissions("clinics:write", app.createResourceHandler)).Methods("POST")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/resources", app.requirePermissions("clinics:read", app.listResourcesHandler)).Methods("GET")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/resources/{resourceID:[0-9]+}", app.requirePermissions("clinics:read", app.getResourceHandler)).Methods("GET")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/resources/{resourceID:[0-9]+}", app.requirePermissions("clinics:write", app.updateResourceHandler)).Methods("PUT")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/resources/{resourceID:[0-9]+}", app.requirePermissions("clinics:write", app.deleteResourceHandler)).Methods("DELETE")
+	// Get the room utilisation of a clinic for a day
+	v1.HandleFunc("/clinics/{id:[0-9]+}/utilisation", app.requirePermissions("clinics:read", app.utilisationHandler)).Methods("GET")
+
+	// Manage the appointment type catalog of a clinic
+	v1.HandleFunc("/clinics/{id:[0-9]+}/appointment-types", app.requirePermissions("clinics:write", app.createAppointmentTypeHandler)).Methods("POST")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/appointment-types", app.requirePermissions("clinics:read", app.listAppointmentTypesHandler)).Methods("GET")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/appointment-types/{typeID:[0-9]+}", app.requirePermissions("clinics:read", app.getAppointmentTypeHandler)).Methods("GET")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/appointment-types/{typeID:[0-9]+}", app.requirePermissions("clinics:write", app.updateAppointmentTypeHandler)).Methods("PUT")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/appointment-types/{typeID:[0-9]+}", app.requirePermissions("clinics:write", app.deleteAppointmentTypeHandler)).Methods("DELETE")
+
+	// The waiting room of a clinic: checked-in patients by doctor, calling the next one in and
+	// marking a patient as seen
+	v1.HandleFunc("/clinics/{id:[0-9]+}/queue", app.requirePermissions("appointments:manage", app.getQueueHandler)).Methods("GET")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/queue/doctors/{doctorID:[0-9]+}/call-next", app.requirePermissions("appointments:manage", app.callNextHandler)).Methods("POST")
+	v1.HandleFunc("/clinics/{id:[0-9]+}/queue/{appointmentID:[0-9]+}/seen", app.requirePermissions("appointments:manage", app.markSeenHandler)).Methods("POST")
+
 	// Get doctors by clinic
 	v1.HandleFunc("/clinics/{id:[0-9]+}/doctors", app.getDoctorsByClinicHandler).Methods("GET")
 	// Get appointments by clinic
-	v1.HandleFunc("/doctors/{id:[0-9]+}/appointments", app.getAppointmentsByDoctorIDHandler).Methods("GET")
+	v1.HandleFunc("/doctors/{id:[0-9]+}/appointments", app.requirePermissions("appointments:read", app.getAppointmentsByDoctorIDHandler)).Methods("GET")
 	// Get appointments by patient
-	v1.HandleFunc("/patients/{id:[0-9]+}/appointments", app.getAppointmentsByPatientIDHandler).Methods("GET")
+	v1.HandleFunc("/patients/{id:[0-9]+}/appointments", app.requirePermissions("appointments:read", app.getAppointmentsByPatientIDHandler)).Methods("GET")
+
+	// iCalendar feeds, which calendar clients authenticate to with ?token=<feed token>
+	v1.HandleFunc("/doctors/{id:[0-9]+}/appointments.ics", app.authenticateFeed(app.requirePermissions("appointments:read", app.doctorCalendarHandler))).Methods("GET")
+	v1.HandleFunc("/patients/{id:[0-9]+}/appointments.ics", app.authenticateFeed(app.requirePermissions("appointments:read", app.patientCalendarHandler))).Methods("GET")
+	// Create or revoke the calendar feed token of the current user
+	v1.HandleFunc("/users/me/feed-token", app.requireActivatedUser(app.createFeedTokenHandler)).Methods("POST")
+	v1.HandleFunc("/users/me/feed-token", app.requireActivatedUser(app.deleteFeedTokenHandler)).Methods("DELETE")
+	// Log out the current client, list the sessions of the current user and log them out of one
+	// or all of them
+	v1.HandleFunc("/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler)).Methods("DELETE")
+	v1.HandleFunc("/users/me/sessions", app.requireAuthenticatedUser(app.listSessionsHandler)).Methods("GET")
+	v1.HandleFunc("/users/me/sessions", app.requireAuthenticatedUser(app.deleteSessionsHandler)).Methods("DELETE")
+	v1.HandleFunc("/users/me/sessions/{id:[0-9]+}", app.requireAuthenticatedUser(app.deleteSessionHandler)).Methods("DELETE")
+
+	// Roles, the permissions they grant and the users they are assigned to
+	v1.HandleFunc("/admin/permissions", app.requirePermissions("roles:admin", app.listPermissionsHandler)).Methods("GET")
+	v1.HandleFunc("/admin/roles", app.requirePermissions("roles:admin", app.createRoleHandler)).Methods("POST")
+	v1.HandleFunc("/admin/roles", app.requirePermissions("roles:admin", app.listRolesHandler)).Methods("GET")
+	v1.HandleFunc("/admin/roles/{id:[0-9]+}", app.requirePermissions("roles:admin", app.getRoleHandler)).Methods("GET")
+	v1.HandleFunc("/admin/roles/{id:[0-9]+}", app.requirePermissions("roles:admin", app.updateRoleHandler)).Methods("PUT")
+	v1.HandleFunc("/admin/roles/{id:[0-9]+}", app.requirePermissions("roles:admin", app.deleteRoleHandler)).Methods("DELETE")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}/roles", app.requirePermissions("roles:admin", app.listUserRolesHandler)).Methods("GET")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}/roles", app.requirePermissions("roles:admin", app.assignUserRoleHandler)).Methods("POST")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}/roles/{roleID:[0-9]+}", app.requirePermissions("roles:admin", app.removeUserRoleHandler)).Methods("DELETE")
+
+	// Users, their activation, their password and the permissions granted to them directly
+	v1.HandleFunc("/admin/users", app.requirePermissions("users:admin", app.listUsersHandler)).Methods("GET")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}", app.requirePermissions("users:admin", app.getUserHandler)).Methods("GET")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}/activated", app.requirePermissions("users:admin", app.updateUserActivatedHandler)).Methods("PUT")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}/password-reset", app.requirePermissions("users:admin", app.forcePasswordResetHandler)).Methods("POST")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}/permissions", app.requirePermissions("users:admin", app.grantUserPermissionsHandler)).Methods("POST")
+	v1.HandleFunc("/admin/users/{id:[0-9]+}/permissions/{code}", app.requirePermissions("users:admin", app.revokeUserPermissionHandler)).Methods("DELETE")
 
 	users1 := r.PathPrefix("/api/v1").Subrouter()
 	// User handlers with Authentication
@@ -79,6 +220,11 @@ func (app *application) routes() http.Handler {
 	// users1.HandleFunc("/users", app.registerUserHandler).Methods("POST")
 	users1.HandleFunc("/users/activated", app.activateUserHandler).Methods("PUT")
 	users1.HandleFunc("/users/login", app.createAuthenticationTokenHandler).Methods("POST")
+	// Exchange a refresh token for a new authentication token and refresh token
+	users1.HandleFunc("/tokens/refresh", app.refreshAuthenticationTokenHandler).Methods("POST")
+	// Mail a password reset token, and set a new password with it
+	users1.HandleFunc("/tokens/password-reset", app.createPasswordResetTokenHandler).Methods("POST")
+	users1.HandleFunc("/users/password", app.updateUserPasswordHandler).Methods("PUT")
 
 	//! If error uncomment below
 	// err := http.ListenAndServe(app.config.port, r)
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// maxSlotsRange limits how many days a single available-slots request may cover.
+const maxSlotsRange = 31
+
+func (app *application) createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Doctors.Get(doctorID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Doctors may only change their own working hours.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Weekday       int     `json:"weekday"`
+		StartTime     string  `json:"startTime"`
+		EndTime       string  `json:"endTime"`
+		SlotMinutes   int     `json:"slotMinutes"`
+		EffectiveFrom string  `json:"effectiveFrom"`
+		EffectiveTo   *string `json:"effectiveTo"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	schedule := &model.DoctorSchedule{
+		DoctorID:      int64(doctorID),
+		Weekday:       input.Weekday,
+		StartTime:     input.StartTime,
+		EndTime:       input.EndTime,
+		SlotMinutes:   input.SlotMinutes,
+		EffectiveFrom: input.EffectiveFrom,
+		EffectiveTo:   input.EffectiveTo,
+	}
+
+	v := validator.New()
+
+	if model.ValidateDoctorSchedule(v, schedule); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Schedules.Insert(schedule)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"schedule": schedule}, nil)
+}
+
+func (app *application) listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	schedules, err := app.models.Schedules.GetAllForDoctor(int64(doctorID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"schedule": schedules}, nil)
+}
+
+func (app *application) updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scheduleID, err := app.readNamedIDParam(r, "scheduleID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Doctors may only change their own working hours.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	schedule, err := app.models.Schedules.Get(int64(doctorID), scheduleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Weekday       *int    `json:"weekday"`
+		StartTime     *string `json:"startTime"`
+		EndTime       *string `json:"endTime"`
+		SlotMinutes   *int    `json:"slotMinutes"`
+		EffectiveFrom *string `json:"effectiveFrom"`
+		EffectiveTo   *string `json:"effectiveTo"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Weekday != nil {
+		schedule.Weekday = *input.Weekday
+	}
+	if input.StartTime != nil {
+		schedule.StartTime = *input.StartTime
+	}
+	if input.EndTime != nil {
+		schedule.EndTime = *input.EndTime
+	}
+	if input.SlotMinutes != nil {
+		schedule.SlotMinutes = *input.SlotMinutes
+	}
+	if input.EffectiveFrom != nil {
+		schedule.EffectiveFrom = *input.EffectiveFrom
+	}
+	if input.EffectiveTo != nil {
+		schedule.EffectiveTo = input.EffectiveTo
+	}
+
+	v := validator.New()
+
+	if model.ValidateDoctorSchedule(v, schedule); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Schedules.Update(schedule)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"schedule": schedule}, nil)
+}
+
+func (app *application) deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scheduleID, err := app.readNamedIDParam(r, "scheduleID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Doctors may only change their own working hours.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Schedules.Delete(int64(doctorID), scheduleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
+
+// listSlotsHandler returns the free slots of a doctor between the "from" and "to" query dates
+// (both inclusive). The slots come from the doctor's weekly schedule, minus the time that is
+// already taken by appointments. When the "resources" query lists rooms or equipment, the time
+// they are reserved for is taken out as well.
+func (app *application) listSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	doctor, err := app.models.Doctors.Get(doctorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	clinic, err := app.models.Clinics.Get(doctor.ClinicID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := clinicNow(clinic)
+	from := app.readDate(qs, "from", now.Truncate(24*time.Hour), v)
+	to := app.readDate(qs, "to", from.AddDate(0, 0, 6), v)
+	resourceIDs := app.readIDs(qs, "resources", v)
+
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Sub(from) < maxSlotsRange*24*time.Hour, "to", "must be less than 31 days after from")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	schedules, err := app.models.Schedules.GetAllForDoctor(int64(doctorID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	busy, err := app.models.Appointments.GetBusySlots(int64(doctorID), resourceIDs, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Slots which have already started can not be booked any more.
+	slots := []model.Slot{}
+	for _, slot := range model.FreeSlots(schedules, busy, from, to) {
+		if !slot.Start.Before(now) {
+			slots = append(slots, slot)
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"slots": slots}, nil)
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// createSeriesHandler creates a recurring appointment and books all of its occurrences. The
+// occurrences which overlap with existing appointments are skipped and listed in the response.
+func (app *application) createSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		PatientID int64  `json:"patientId"`
+		DoctorID  int64  `json:"doctorId"`
+		StartDate string `json:"startDate"`
+		StartTime string `json:"startTime"`
+		EndTime   string `json:"endTime"`
+		RRule     string `json:"rrule"`
+		// OverrideReason lets staff book the series against the clinic policy.
+		OverrideReason string `json:"overrideReason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	series := &model.AppointmentSeries{
+		PatientID: input.PatientID,
+		DoctorID:  input.DoctorID,
+		StartDate: input.StartDate,
+		StartTime: input.StartTime,
+		EndTime:   input.EndTime,
+		RRule:     input.RRule,
+	}
+
+	if !app.contextGetAccessScope(r).CanAccessSeries(series) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	dates := model.ValidateSeries(v, series)
+	model.ValidateOverrideReason(v, input.OverrideReason)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	doctor, err := app.models.Doctors.Get(int(series.DoctorID))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("doctorId", "must be an existing doctor")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	clinic, err := app.models.Clinics.Get(doctor.ClinicID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The first occurrence is the earliest one, so none of the others has started either.
+	start, _ := time.Parse(model.DateLayout+" "+model.ClockLayout, series.StartDate+" "+series.StartTime)
+	if v.Check(start.After(clinicNow(clinic)), "startDate", "must not be in the past"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	occurrences := make([]*model.Appointment, len(dates))
+	for i, date := range dates {
+		occurrences[i] = series.Occurrence(date)
+	}
+
+	violations, ok := app.enforceBookingPolicy(w, r, occurrences, input.OverrideReason)
+	if !ok {
+		return
+	}
+
+	appointments, conflicts, err := app.models.Series.Insert(series, dates)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAppointmentConflict) && len(conflicts) > 0:
+			app.appointmentConflictResponse(w, r, conflicts)
+		case errors.Is(err, model.ErrAppointmentConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, appointment := range appointments {
+		for _, violation := range violations {
+			app.recordOverride(r, appointment.Id, model.PolicyActionBook, violation, input.OverrideReason)
+		}
+	}
+
+	env := envelope{"series": series, "appointments": appointments, "conflicts": conflicts}
+	app.writeJSON(w, http.StatusCreated, env, nil)
+}
+
+func (app *application) getSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	series, err := app.models.Series.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetAccessScope(r).CanAccessSeries(series) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	appointments, err := app.models.Series.GetOccurrences(series.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"series": series, "appointments": appointments}, nil)
+}
+
+// updateSeriesHandler moves the occurrences of a series. The scope decides whether only the
+// picked occurrence, the picked one and all later ones, or the whole series is moved. Only
+// occurrences which are still requested or confirmed are touched.
+func (app *application) updateSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Scope         string  `json:"scope"`
+		AppointmentID int64   `json:"appointmentId"`
+		DoctorID      *int64  `json:"doctorId"`
+		Date          *string `json:"date"`
+		StartTime     *string `json:"startTime"`
+		EndTime       *string `json:"endTime"`
+		// OverrideReason lets staff move occurrences against the clinic policy.
+		OverrideReason string `json:"overrideReason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	model.ValidateSeriesScope(v, input.Scope, input.AppointmentID)
+	if input.Date != nil {
+		_, err := time.Parse(model.DateLayout, *input.Date)
+		v.Check(err == nil, "date", "must be a date in YYYY-MM-DD format")
+		v.Check(input.Scope == model.SeriesScopeThis, "date", "can only be changed for a single occurrence")
+	}
+	if input.StartTime != nil {
+		_, err := time.Parse(model.ClockLayout, *input.StartTime)
+		v.Check(err == nil, "startTime", "must be a time in HH:MM format")
+	}
+	if input.EndTime != nil {
+		_, err := time.Parse(model.ClockLayout, *input.EndTime)
+		v.Check(err == nil, "endTime", "must be a time in HH:MM format")
+	}
+	model.ValidateOverrideReason(v, input.OverrideReason)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	series, err := app.models.Series.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetAccessScope(r).CanAccessSeries(series) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// A doctor can not move their patients into another doctor's calendar.
+	scope := app.contextGetAccessScope(r)
+	if input.DoctorID != nil && !scope.All && !scope.IsPatient(series.PatientID) && !scope.IsDoctor(*input.DoctorID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	changes := model.SeriesChanges{
+		DoctorID:  input.DoctorID,
+		Date:      input.Date,
+		StartTime: input.StartTime,
+		EndTime:   input.EndTime,
+	}
+
+	// Every moved occurrence is held to the rescheduling policy, like a single appointment.
+	occurrences, err := app.models.Series.GetPendingOccurrences(series, input.Scope, input.AppointmentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Changing only one of the times can leave an occurrence ending before it starts.
+	for _, occurrence := range occurrences {
+		if model.ValidateAppointment(v, changes.Apply(occurrence)); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	now := time.Now()
+	violations, violation, err := app.seriesPolicyViolations(occurrences, func(policy *model.ClinicPolicy, occurrence *model.Appointment) *model.PolicyViolation {
+		return policy.CheckReschedule(occurrence, changes.Apply(occurrence), now)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !app.enforcePolicy(w, r, violation, input.OverrideReason) {
+		return
+	}
+
+	appointments, conflicts, err := app.models.Series.UpdateOccurrences(series, input.Scope, input.AppointmentID, changes)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrAppointmentConflict):
+			app.appointmentConflictResponse(w, r, conflicts)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for appointmentID, violation := range violations {
+		app.recordOverride(r, appointmentID, model.PolicyActionReschedule, violation, input.OverrideReason)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"series": series, "appointments": appointments}, nil)
+}
+
+// cancelSeriesHandler cancels the occurrences of a series in the requested scope.
+func (app *application) cancelSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Scope          string `json:"scope"`
+		AppointmentID  int64  `json:"appointmentId"`
+		Reason         string `json:"reason"`
+		OverrideReason string `json:"overrideReason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	model.ValidateSeriesScope(v, input.Scope, input.AppointmentID)
+	if model.ValidateOverrideReason(v, input.OverrideReason); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	series, err := app.models.Series.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetAccessScope(r).CanAccessSeries(series) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Every cancelled occurrence is held to the cancellation policy, like a single appointment.
+	occurrences, err := app.models.Series.GetPendingOccurrences(series, input.Scope, input.AppointmentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	violations, violation, err := app.seriesPolicyViolations(occurrences, func(policy *model.ClinicPolicy, occurrence *model.Appointment) *model.PolicyViolation {
+		return policy.CheckCancel(occurrence, now)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !app.enforcePolicy(w, r, violation, input.OverrideReason) {
+		return
+	}
+
+	cancelled, err := app.models.Series.Cancel(series, input.Scope, input.AppointmentID, user.ID, input.Reason)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for appointmentID, violation := range violations {
+		app.recordOverride(r, appointmentID, model.PolicyActionCancel, violation, input.OverrideReason)
+	}
+
+	for _, appointmentID := range cancelled {
+		appointment, err := app.models.Appointments.Get(int(appointmentID))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+		app.offerFreedSlot(appointment)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"series": series, "cancelled": cancelled}, nil)
+}
+
+// seriesPolicyViolations checks an action on every occurrence against the policy of the clinic
+// of its doctor. It returns the broken rules by appointment ID, and the first of them to report.
+func (app *application) seriesPolicyViolations(occurrences []*model.Appointment, check func(*model.ClinicPolicy, *model.Appointment) *model.PolicyViolation) (map[string]*model.PolicyViolation, *model.PolicyViolation, error) {
+	policies := map[string]*model.ClinicPolicy{}
+	violations := map[string]*model.PolicyViolation{}
+
+	var first *model.PolicyViolation
+
+	for _, occurrence := range occurrences {
+		policy, ok := policies[occurrence.DoctorId]
+		if !ok {
+			var err error
+			policy, err = app.models.Policies.GetForDoctor(occurrence.DoctorId)
+			if err != nil {
+				return nil, nil, err
+			}
+			policies[occurrence.DoctorId] = policy
+		}
+
+		if violation := check(policy, occurrence); violation != nil {
+			violations[occurrence.Id] = violation
+			if first == nil {
+				first = violation
+			}
+		}
+	}
+
+	return violations, first, nil
+}
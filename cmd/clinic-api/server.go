@@ -27,6 +27,19 @@ func (app *application) serve() error {
 	// by the graceful Shutdown() function.
 	shutdownError := make(chan error)
 
+	// Start the background workers. Cancelling their context on shutdown tells them to stop,
+	// and app.wg.Wait() below waits until they have.
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Event streams never finish on their own, so the workers are stopped as soon as the
+	// shutdown starts, which closes the streams instead of waiting for them to time out.
+	srv.RegisterOnShutdown(stopWorkers)
+
+	app.startReminders(workers)
+	app.startEventListener(workers)
+	app.startHoldSweeper(workers)
+
 	// Start a background goroutine.
 	go func() {
 		// Create a quit channel which carries os.Signal values. Use buffered
@@ -59,6 +72,9 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
+		// Tell the background workers to stop.
+		stopWorkers()
+
 		// Log a message to say that we're waiting for any background goroutines to complete
 		// their tasks.
 		app.logger.PrintInfo("completing background tasks", map[string]string{
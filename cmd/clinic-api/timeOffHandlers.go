@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// createTimeOffHandler blocks a range of the doctor's calendar. The appointments which fall into
+// it are returned, and cancelled too when the client asks for it.
+func (app *application) createTimeOffHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Doctors.Get(doctorID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Start              string `json:"start"`
+		End                string `json:"end"`
+		Reason             string `json:"reason"`
+		CancelAppointments bool   `json:"cancelAppointments"`
+		CancellationReason string `json:"cancellationReason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	timeOff := &model.DoctorTimeOff{
+		DoctorID:  int64(doctorID),
+		Start:     input.Start,
+		End:       input.End,
+		Reason:    input.Reason,
+		CreatedBy: &user.ID,
+	}
+
+	v := validator.New()
+
+	if model.ValidateTimeOff(v, timeOff); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.CancellationReason == "" {
+		input.CancellationReason = input.Reason
+	}
+
+	affected, err := app.models.TimeOff.Insert(timeOff, input.CancelAppointments, user.ID, input.CancellationReason)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"timeOff": timeOff, "affectedAppointments": affected, "cancelled": input.CancelAppointments}
+	app.writeJSON(w, http.StatusCreated, env, nil)
+}
+
+func (app *application) listTimeOffHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	timeOffs, err := app.models.TimeOff.GetAllForDoctor(int64(doctorID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"timeOff": timeOffs}, nil)
+}
+
+func (app *application) deleteTimeOffHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	timeOffID, err := app.readNamedIDParam(r, "timeOffID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.TimeOff.Delete(int64(doctorID), timeOffID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
 	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/Zhassulan1/Go_Project/pkg/notify"
 )
 
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -61,17 +64,227 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	// Otherwise, if the password is correct, we generate a new token with a 24-hour expiry time
-	// and the scope 'authentication'.
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, model.ScopeAuthentication)
+	// Otherwise, if the password is correct, we start a new session with a short-lived
+	// authentication token and a refresh token, which is exchanged for new tokens once the
+	// authentication token expires.
+	token, refresh, err := app.models.Tokens.NewSession(user.ID, app.config.tokens.accessTTL, app.config.tokens.refreshTTL, clientIP(r), r.UserAgent())
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Encode the token to JSON and send it in the response along with a 201 Created status code.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	// Encode the tokens to JSON and send them in the response along with a 201 Created status code.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refresh}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// refreshAuthenticationTokenHandler exchanges a refresh token for a new authentication token and
+// a new refresh token. Every refresh token works once; when an old one is sent again, the whole
+// session is revoked, since either the client or whoever stole the token has to log in again.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, refresh, err := app.models.Tokens.Refresh(input.RefreshToken, app.config.tokens.accessTTL, app.config.tokens.refreshTTL, clientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, model.ErrTokenReused):
+			app.logger.PrintInfo("revoked session after refresh token reuse", map[string]string{
+				"ip": clientIP(r),
+			})
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refresh}, nil)
+}
+
+// passwordResetTTL is how long a password reset token can be used.
+const passwordResetTTL = 45 * time.Minute
+
+// createPasswordResetTokenHandler mails a password reset token to the user with the email
+// address. The response is the same whether or not there is such a user, so that it can not be
+// used to find out who has an account.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.writeJSON(w, http.StatusAccepted, env, nil)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Accounts which were never activated can not sign in, so there is nothing to reset.
+	if !user.Activated {
+		app.writeJSON(w, http.StatusAccepted, env, nil)
+		return
+	}
+
+	// Only the newest token works, so that an older email can not be used after a new one was
+	// asked for.
+	err = app.models.Tokens.DeleteAllForUser(model.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, passwordResetTTL, model.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		err := app.notifier.Notify(passwordResetMessage(user, token))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user": strconv.FormatInt(user.ID, 10)})
+		}
+	})
+
+	app.writeJSON(w, http.StatusAccepted, env, nil)
+}
+
+func passwordResetMessage(user *model.User, token *model.Token) notify.Message {
+	body := fmt.Sprintf(
+		"Hello %s,\n\nplease send a PUT /api/v1/users/password request with the following JSON body "+
+			"to set a new password:\n\n{\"password\": \"your new password\", \"token\": \"%s\"}\n\n"+
+			"This is a one-time token which expires at %s. If you did not ask to reset your password, "+
+			"you can ignore this email.",
+		user.Name, token.Plaintext, token.Expiry.Format(time.RFC1123),
+	)
+
+	return notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	}
+}
+
+// deleteAuthenticationTokenHandler logs the client out by revoking the authentication token of
+// the request, and every other token of its session.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token := app.contextGetToken(r)
+	if token == "" {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err := app.models.Tokens.DeleteSessionForToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+}
+
+// listSessionsHandler returns the sessions of the current user which haven't expired.
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	sessions, err := app.models.Tokens.GetSessions(user.ID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+}
+
+// deleteSessionsHandler logs the current user out everywhere, including the current client.
+func (app *application) deleteSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out of every session"}, nil)
+}
+
+// deleteSessionHandler logs the current user out of one of their sessions, such as one on a lost
+// device.
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.contextGetUser(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteSession(user.ID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/model"
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/Zhassulan1/Go_Project/pkg/notify"
+)
+
+// createWaitlistEntryHandler puts a patient on the waitlist of a fully booked doctor.
+func (app *application) createWaitlistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err := app.models.Doctors.Get(doctorID); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		PatientID          int64   `json:"patientId"`
+		PreferredFrom      string  `json:"preferredFrom"`
+		PreferredTo        string  `json:"preferredTo"`
+		PreferredStartTime *string `json:"preferredStartTime"`
+		PreferredEndTime   *string `json:"preferredEndTime"`
+		Notes              string  `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &model.WaitlistEntry{
+		DoctorID:           int64(doctorID),
+		PatientID:          input.PatientID,
+		PreferredFrom:      input.PreferredFrom,
+		PreferredTo:        input.PreferredTo,
+		PreferredStartTime: input.PreferredStartTime,
+		PreferredEndTime:   input.PreferredEndTime,
+		Notes:              input.Notes,
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsPatient(entry.PatientID) && !scope.IsDoctor(entry.DoctorID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateWaitlistEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, err := app.models.Patients.Get(int(entry.PatientID)); err != nil {
+		v.AddError("patientId", "must refer to an existing patient")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Waitlist.Insert(entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"entry": entry}, nil)
+}
+
+func (app *application) listWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entries, err := app.models.Waitlist.GetAllForDoctor(int64(doctorID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Patients only see their own place on the waitlist.
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsDoctor(int64(doctorID)) {
+		own := []*model.WaitlistEntry{}
+		for _, entry := range entries {
+			if scope.IsPatient(entry.PatientID) {
+				own = append(own, entry)
+			}
+		}
+		entries = own
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"waitlist": entries}, nil)
+}
+
+func (app *application) deleteWaitlistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entryID, err := app.readNamedIDParam(r, "entryID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entry, err := app.models.Waitlist.GetEntry(int64(doctorID), entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsPatient(entry.PatientID) && !scope.IsDoctor(entry.DoctorID) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Waitlist.Delete(entry.DoctorID, entry.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+}
+
+// acceptOfferHandler books the offered slot for the waitlisted patient.
+func (app *application) acceptOfferHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	offer := app.getAnswerableOffer(w, r, int64(id))
+	if offer == nil {
+		return
+	}
+
+	// Accepting is held to the booking policy, and only takes a body with an override reason.
+	var input struct {
+		OverrideReason string `json:"overrideReason"`
+	}
+
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if model.ValidateOverrideReason(v, input.OverrideReason); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	violations, ok := app.enforceBookingPolicy(w, r, []*model.Appointment{offer.Appointment()}, input.OverrideReason)
+	if !ok {
+		return
+	}
+
+	offer, appointment, err := app.models.Waitlist.AcceptOffer(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrOfferExpired):
+			app.offerExpiredResponse(w, r)
+		case errors.Is(err, model.ErrAppointmentConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrDoctorUnavailable):
+			app.doctorUnavailableResponse(w, r)
+		case errors.Is(err, model.ErrClinicClosed):
+			app.clinicClosedResponse(w, r)
+		case errors.Is(err, model.ErrSlotHeld):
+			app.slotHeldResponse(w, r)
+		case errors.Is(err, model.ErrGroupSession):
+			app.groupSessionConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, violation := range violations {
+		app.recordOverride(r, appointment.Id, model.PolicyActionBook, violation, input.OverrideReason)
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"offer": offer, "appointment": appointment}, nil)
+}
+
+// declineOfferHandler turns an offer down and hands the slot to the next matching patient.
+func (app *application) declineOfferHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if app.getAnswerableOffer(w, r, int64(id)) == nil {
+		return
+	}
+
+	offer, err := app.models.Waitlist.DeclineOffer(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrOfferExpired):
+			app.offerExpiredResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.offerFreedSlot(&model.Appointment{
+		DoctorId:  strconv.FormatInt(offer.DoctorID, 10),
+		Date:      offer.Date,
+		StartTime: offer.StartTime,
+		EndTime:   offer.EndTime,
+	})
+
+	app.writeJSON(w, http.StatusOK, envelope{"offer": offer}, nil)
+}
+
+// getAnswerableOffer returns the offer when it exists and was made to the patient of the
+// request. It sends the error response itself otherwise, and returns nil then. Staff may answer
+// offers on behalf of patients.
+func (app *application) getAnswerableOffer(w http.ResponseWriter, r *http.Request, id int64) *model.WaitlistOffer {
+	offer, err := app.models.Waitlist.GetOffer(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	scope := app.contextGetAccessScope(r)
+	if !scope.All && !scope.IsPatient(offer.PatientID) {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	return offer
+}
+
+// offerFreedSlot offers the time slot of a cancelled appointment to the next patient on the
+// doctor's waitlist. The cancellation itself has already succeeded, so failures are only logged.
+func (app *application) offerFreedSlot(appointment *model.Appointment) {
+	offer, err := app.models.Waitlist.OfferSlot(appointment, app.config.waitlist.offerTTL)
+	if err != nil {
+		if !errors.Is(err, model.ErrRecordNotFound) {
+			app.logger.PrintError(err, map[string]string{"doctor": appointment.DoctorId, "date": appointment.Date})
+		}
+		return
+	}
+
+	app.logger.PrintInfo("offered freed slot to waitlisted patient", map[string]string{
+		"offer":     strconv.FormatInt(offer.ID, 10),
+		"patient":   strconv.FormatInt(offer.PatientID, 10),
+		"date":      offer.Date,
+		"startTime": offer.StartTime,
+		"expiresAt": offer.ExpiresAt.String(),
+	})
+
+	app.background(func() {
+		notice, err := app.models.Waitlist.GetOfferNotice(offer.ID)
+		if err != nil {
+			if !errors.Is(err, model.ErrRecordNotFound) {
+				app.logger.PrintError(err, map[string]string{"offer": strconv.FormatInt(offer.ID, 10)})
+			}
+			return
+		}
+
+		err = app.notifier.Notify(offerMessage(notice, offer, app.config.waitlist.offerTTL))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"offer": strconv.FormatInt(offer.ID, 10)})
+		}
+	})
+}
+
+// sweepOffers closes the offers which ran out unanswered, and offers their slots to the next
+// patients on the waitlists.
+func (app *application) sweepOffers() {
+	// Recover any panic, so that a failing sweep can neither bring down the server nor stop the
+	// following sweeps.
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+
+	offers, err := app.models.Waitlist.ExpireOffers()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	for _, offer := range offers {
+		app.offerFreedSlot(offer.Appointment())
+	}
+}
+
+func offerMessage(notice *model.OfferNotice, offer *model.WaitlistOffer, ttl time.Duration) notify.Message {
+	body := fmt.Sprintf(
+		"Hello %s,\n\na slot with %s (%s) has become free on %s at %s, and you are next on the waitlist.\n\n"+
+			"The slot is kept for you for %s. Accept offer %d to book it, or decline it so that the next patient can take it.",
+		notice.PatientName, notice.DoctorName, notice.Specialty, offer.Date, offer.StartTime, ttl, offer.ID,
+	)
+
+	return notify.Message{
+		To:      notice.Email,
+		Subject: fmt.Sprintf("A slot on %s at %s is free for you", offer.Date, offer.StartTime),
+		Body:    body,
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS appointments DROP CONSTRAINT IF EXISTS appointments_patient_overlap;
+ALTER TABLE IF EXISTS appointments DROP CONSTRAINT IF EXISTS appointments_doctor_overlap;
+DROP EXTENSION IF EXISTS btree_gist;
@@ -0,0 +1,15 @@
+-- btree_gist lets us mix plain equality (doctor_id, patient_id) with range overlap in one
+-- exclusion constraint
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- A doctor can not be booked into two overlapping slots
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_doctor_overlap
+        EXCLUDE USING gist (doctor_id WITH =, tsrange(date + start_time, date + end_time) WITH &&)
+        WHERE (status <> 'cancelled');
+
+-- A patient can not be in two places at once
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_patient_overlap
+        EXCLUDE USING gist (patient_id WITH =, tsrange(date + start_time, date + end_time) WITH &&)
+        WHERE (status <> 'cancelled');
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS appointments_doctor_id_date_idx;
+DROP TABLE IF EXISTS doctor_schedules;
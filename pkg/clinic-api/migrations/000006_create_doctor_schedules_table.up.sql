@@ -0,0 +1,19 @@
+-- weekday follows Go's time.Weekday: 0 = Sunday, 1 = Monday, ..., 6 = Saturday
+CREATE TABLE IF NOT EXISTS doctor_schedules
+(
+    id             BIGSERIAL PRIMARY KEY,
+    doctor_id      BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    weekday        SMALLINT                    NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time     TIME                        NOT NULL,
+    end_time       TIME                        NOT NULL,
+    slot_minutes   INTEGER                     NOT NULL CHECK (slot_minutes > 0),
+    effective_from DATE                        NOT NULL,
+    effective_to   DATE,
+    created_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (start_time < end_time),
+    CHECK (effective_to IS NULL OR effective_from <= effective_to)
+);
+
+CREATE INDEX IF NOT EXISTS doctor_schedules_doctor_id_idx ON doctor_schedules (doctor_id);
+CREATE INDEX IF NOT EXISTS appointments_doctor_id_date_idx ON appointments (doctor_id, date);
@@ -0,0 +1,18 @@
+DELETE FROM permissions WHERE code = 'appointments:manage';
+
+ALTER TABLE IF EXISTS appointments
+    DROP COLUMN IF EXISTS no_show_by,
+    DROP COLUMN IF EXISTS no_show_at,
+    DROP COLUMN IF EXISTS cancellation_reason,
+    DROP COLUMN IF EXISTS cancelled_by,
+    DROP COLUMN IF EXISTS cancelled_at,
+    DROP COLUMN IF EXISTS completed_by,
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS started_by,
+    DROP COLUMN IF EXISTS started_at,
+    DROP COLUMN IF EXISTS checked_in_by,
+    DROP COLUMN IF EXISTS checked_in_at,
+    DROP COLUMN IF EXISTS confirmed_by,
+    DROP COLUMN IF EXISTS confirmed_at,
+    DROP CONSTRAINT IF EXISTS appointments_status_check,
+    ALTER COLUMN status DROP DEFAULT;
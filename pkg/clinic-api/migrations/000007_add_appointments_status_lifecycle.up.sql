@@ -0,0 +1,34 @@
+-- Statuses used to be free text. Anything outside of the lifecycle is reset to 'requested',
+-- except the cancelled ones which have to keep freeing their time slot.
+UPDATE appointments
+SET status = 'cancelled'
+WHERE lower(status) IN ('cancelled', 'canceled');
+
+UPDATE appointments
+SET status = 'requested'
+WHERE status NOT IN ('requested', 'confirmed', 'checked_in', 'in_progress', 'completed', 'cancelled', 'no_show');
+
+ALTER TABLE appointments
+    ALTER COLUMN status SET DEFAULT 'requested',
+    ADD CONSTRAINT appointments_status_check
+        CHECK (status IN ('requested', 'confirmed', 'checked_in', 'in_progress', 'completed', 'cancelled', 'no_show'));
+
+-- Who moved the appointment into each status, and when
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS confirmed_at        TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS confirmed_by        BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS checked_in_at       TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS checked_in_by       BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS started_at          TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS started_by          BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS completed_at        TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS completed_by        BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS cancelled_at        TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS cancelled_by        BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS cancellation_reason TEXT,
+    ADD COLUMN IF NOT EXISTS no_show_at          TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS no_show_by          BIGINT REFERENCES users (id) ON DELETE SET NULL;
+
+-- Confirming, checking in, starting, completing and marking no-shows is done by clinic staff
+INSERT INTO permissions (code)
+VALUES ('appointments:manage');
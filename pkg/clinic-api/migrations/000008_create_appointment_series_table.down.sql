@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS appointments_series_id_idx;
+ALTER TABLE IF EXISTS appointments DROP COLUMN IF EXISTS series_id;
+DROP TABLE IF EXISTS appointment_series;
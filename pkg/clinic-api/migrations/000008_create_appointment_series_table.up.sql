@@ -0,0 +1,21 @@
+-- A series is the template of a recurring appointment. Its occurrences are expanded from the
+-- RFC 5545 rule into regular rows of the appointments table.
+CREATE TABLE IF NOT EXISTS appointment_series
+(
+    id         BIGSERIAL PRIMARY KEY,
+    patient_id BIGINT                      NOT NULL REFERENCES patients (id),
+    doctor_id  BIGINT                      NOT NULL REFERENCES doctors (id),
+    start_date DATE                        NOT NULL,
+    start_time TIME                        NOT NULL,
+    end_time   TIME                        NOT NULL,
+    rrule      TEXT                        NOT NULL,
+    status     TEXT                        NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (start_time < end_time)
+);
+
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS series_id BIGINT REFERENCES appointment_series (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS appointments_series_id_idx ON appointments (series_id);
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS waitlist_entries
+(
+    id                   BIGSERIAL PRIMARY KEY,
+    doctor_id            BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    patient_id           BIGINT                      NOT NULL REFERENCES patients (id) ON DELETE CASCADE,
+    preferred_from       DATE                        NOT NULL,
+    preferred_to         DATE                        NOT NULL,
+    preferred_start_time TIME,
+    preferred_end_time   TIME,
+    notes                TEXT                        NOT NULL DEFAULT '',
+    status               TEXT                        NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'booked')),
+    created_at           TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (preferred_from <= preferred_to),
+    CHECK (preferred_start_time IS NULL OR preferred_end_time IS NULL OR preferred_start_time < preferred_end_time)
+);
+
+CREATE INDEX IF NOT EXISTS waitlist_entries_doctor_id_idx ON waitlist_entries (doctor_id, status, created_at);
+
+-- An offer hands a freed time slot to the patient at the head of the waitlist for a limited time
+CREATE TABLE IF NOT EXISTS waitlist_offers
+(
+    id             BIGSERIAL PRIMARY KEY,
+    entry_id       BIGINT                      NOT NULL REFERENCES waitlist_entries (id) ON DELETE CASCADE,
+    date           DATE                        NOT NULL,
+    start_time     TIME                        NOT NULL,
+    end_time       TIME                        NOT NULL,
+    expires_at     TIMESTAMP(0) with time zone NOT NULL,
+    status         TEXT                        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined')),
+    appointment_id BIGINT REFERENCES appointments (id) ON DELETE SET NULL,
+    created_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS waitlist_offers_entry_id_idx ON waitlist_offers (entry_id);
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'records:all';
+
+DROP INDEX IF EXISTS appointments_patient_id_idx;
+DROP INDEX IF EXISTS doctors_user_id_idx;
+DROP INDEX IF EXISTS patients_user_id_idx;
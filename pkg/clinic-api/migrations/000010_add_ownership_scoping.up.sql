@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS patients_user_id_idx ON patients (user_id);
+CREATE INDEX IF NOT EXISTS doctors_user_id_idx ON doctors (user_id);
+CREATE INDEX IF NOT EXISTS appointments_patient_id_idx ON appointments (patient_id);
+
+-- Admins and front-desk staff see every patient and appointment, everybody else only their own
+INSERT INTO permissions (code)
+VALUES ('records:all');
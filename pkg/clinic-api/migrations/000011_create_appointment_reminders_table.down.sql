@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS appointments_date_start_time_idx;
+DROP TABLE IF EXISTS appointment_reminders;
@@ -0,0 +1,10 @@
+-- Every reminder sent for an appointment, so that restarts don't send the same reminder twice
+CREATE TABLE IF NOT EXISTS appointment_reminders
+(
+    appointment_id BIGINT                      NOT NULL REFERENCES appointments (id) ON DELETE CASCADE,
+    lead_seconds   BIGINT                      NOT NULL,
+    sent_at        TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (appointment_id, lead_seconds)
+);
+
+CREATE INDEX IF NOT EXISTS appointments_date_start_time_idx ON appointments ((date + start_time));
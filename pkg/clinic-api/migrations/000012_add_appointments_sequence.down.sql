@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS appointments_bump_sequence ON appointments;
+DROP FUNCTION IF EXISTS appointments_bump_sequence();
+
+ALTER TABLE IF EXISTS appointments
+    DROP COLUMN IF EXISTS sequence;
@@ -0,0 +1,23 @@
+-- The iCalendar SEQUENCE of an appointment. It grows with every change calendar clients
+-- care about, so that they replace the event they already have.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS sequence INTEGER NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION appointments_bump_sequence() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF (NEW.patient_id, NEW.doctor_id, NEW.date, NEW.start_time, NEW.end_time, NEW.status)
+        IS DISTINCT FROM (OLD.patient_id, OLD.doctor_id, OLD.date, OLD.start_time, OLD.end_time, OLD.status) THEN
+        NEW.sequence := OLD.sequence + 1;
+        NEW.updated_at := now();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_bump_sequence ON appointments;
+CREATE TRIGGER appointments_bump_sequence
+    BEFORE UPDATE
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_bump_sequence();
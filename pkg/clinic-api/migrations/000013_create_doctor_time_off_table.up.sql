@@ -0,0 +1,15 @@
+-- Vacations, conferences, sick leave and other absences during which a doctor can't be booked.
+-- Like appointments, the ranges are in the local time of the clinic.
+CREATE TABLE IF NOT EXISTS doctor_time_off
+(
+    id         BIGSERIAL PRIMARY KEY,
+    doctor_id  BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    starts_at  TIMESTAMP(0)                NOT NULL,
+    ends_at    TIMESTAMP(0)                NOT NULL,
+    reason     TEXT                        NOT NULL DEFAULT '',
+    created_by BIGINT                      REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (starts_at < ends_at)
+);
+
+CREATE INDEX IF NOT EXISTS doctor_time_off_doctor_id_idx ON doctor_time_off USING gist (doctor_id, tsrange(starts_at, ends_at));
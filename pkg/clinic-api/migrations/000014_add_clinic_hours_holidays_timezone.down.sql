@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS clinic_holidays;
+DROP TABLE IF EXISTS clinic_opening_hours;
+
+ALTER TABLE IF EXISTS clinics
+    DROP COLUMN IF EXISTS timezone;
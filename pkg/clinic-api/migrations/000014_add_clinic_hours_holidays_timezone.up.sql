@@ -0,0 +1,28 @@
+-- The IANA time zone of the clinic. Appointment dates and times are wall-clock times in it.
+ALTER TABLE IF EXISTS clinics
+    ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Asia/Almaty';
+
+-- Weekly opening hours, with 0 being Sunday as in EXTRACT(DOW ...). A clinic without any
+-- opening hours is treated as always open.
+CREATE TABLE IF NOT EXISTS clinic_opening_hours
+(
+    id         BIGSERIAL PRIMARY KEY,
+    clinic_id  BIGINT  NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    weekday    INTEGER NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    open_time  TIME    NOT NULL,
+    close_time TIME    NOT NULL,
+    CHECK (open_time < close_time)
+);
+
+CREATE INDEX IF NOT EXISTS clinic_opening_hours_clinic_id_idx ON clinic_opening_hours (clinic_id, weekday);
+
+-- Days on which the clinic is closed
+CREATE TABLE IF NOT EXISTS clinic_holidays
+(
+    id         BIGSERIAL PRIMARY KEY,
+    clinic_id  BIGINT                      NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    date       DATE                        NOT NULL,
+    name       TEXT                        NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    UNIQUE (clinic_id, date)
+);
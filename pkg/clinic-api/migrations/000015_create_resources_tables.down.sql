@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS appointments_sync_resources ON appointments;
+DROP FUNCTION IF EXISTS appointments_sync_resources();
+DROP TABLE IF EXISTS appointment_resources;
+DROP TABLE IF EXISTS resources;
@@ -0,0 +1,46 @@
+-- Rooms and equipment of a clinic which procedures need on top of a doctor
+CREATE TABLE IF NOT EXISTS resources
+(
+    id          BIGSERIAL PRIMARY KEY,
+    clinic_id   BIGINT                      NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    name        TEXT                        NOT NULL,
+    kind        TEXT                        NOT NULL CHECK (kind IN ('room', 'equipment')),
+    description TEXT                        NOT NULL DEFAULT '',
+    created_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS resources_clinic_id_idx ON resources (clinic_id, kind);
+
+-- The resources reserved by an appointment. The time range and the status are copied from the
+-- appointment, so that an exclusion constraint can keep a resource from being booked twice.
+CREATE TABLE IF NOT EXISTS appointment_resources
+(
+    appointment_id BIGINT  NOT NULL REFERENCES appointments (id) ON DELETE CASCADE,
+    resource_id    BIGINT  NOT NULL REFERENCES resources (id),
+    period         TSRANGE NOT NULL,
+    cancelled      BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (appointment_id, resource_id),
+    CONSTRAINT appointment_resources_overlap
+        EXCLUDE USING gist (resource_id WITH =, period WITH &&) WHERE (NOT cancelled)
+);
+
+-- Keeps the reservations in line with their appointment when it is moved or cancelled. A move
+-- onto a taken resource fails the appointment update with the exclusion violation.
+CREATE OR REPLACE FUNCTION appointments_sync_resources() RETURNS TRIGGER AS
+$$
+BEGIN
+    UPDATE appointment_resources
+    SET period    = tsrange(NEW.date + NEW.start_time, NEW.date + NEW.end_time),
+        cancelled = NEW.status = 'cancelled'
+    WHERE appointment_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_sync_resources ON appointments;
+CREATE TRIGGER appointments_sync_resources
+    AFTER UPDATE OF date, start_time, end_time, status
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_sync_resources();
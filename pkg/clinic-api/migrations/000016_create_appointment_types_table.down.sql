@@ -0,0 +1,13 @@
+ALTER TABLE appointments
+    DROP CONSTRAINT IF EXISTS appointments_doctor_overlap;
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_doctor_overlap
+        EXCLUDE USING gist (doctor_id WITH =, tsrange(date + start_time, date + end_time) WITH &&)
+        WHERE (status <> 'cancelled');
+
+ALTER TABLE IF EXISTS appointments
+    DROP COLUMN IF EXISTS buffer_after,
+    DROP COLUMN IF EXISTS buffer_before,
+    DROP COLUMN IF EXISTS type_id;
+
+DROP TABLE IF EXISTS appointment_types;
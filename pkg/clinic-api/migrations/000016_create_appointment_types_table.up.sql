@@ -0,0 +1,35 @@
+-- The catalog of appointment types of a clinic, such as an initial consultation or a procedure.
+-- An empty specialty means that any doctor of the clinic can take the appointment.
+CREATE TABLE IF NOT EXISTS appointment_types
+(
+    id                    BIGSERIAL PRIMARY KEY,
+    clinic_id             BIGINT                      NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    name                  TEXT                        NOT NULL,
+    duration_minutes      INTEGER                     NOT NULL CHECK (duration_minutes > 0),
+    buffer_before_minutes INTEGER                     NOT NULL DEFAULT 0 CHECK (buffer_before_minutes >= 0),
+    buffer_after_minutes  INTEGER                     NOT NULL DEFAULT 0 CHECK (buffer_after_minutes >= 0),
+    specialty             TEXT                        NOT NULL DEFAULT '',
+    preparation           TEXT                        NOT NULL DEFAULT '',
+    created_at            TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at            TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS appointment_types_clinic_id_idx ON appointment_types (clinic_id);
+
+-- The buffers are copied from the type when the appointment is booked, so that later changes
+-- of the catalog don't move existing appointments.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS type_id       BIGINT REFERENCES appointment_types (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS buffer_before INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS buffer_after  INTEGER NOT NULL DEFAULT 0;
+
+-- The doctor is busy during the buffers too, so they are part of the doctor's overlap check.
+ALTER TABLE appointments
+    DROP CONSTRAINT IF EXISTS appointments_doctor_overlap;
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_doctor_overlap
+        EXCLUDE USING gist (doctor_id WITH =, tsrange(
+            date + start_time - buffer_before * INTERVAL '1 minute',
+            date + end_time + buffer_after * INTERVAL '1 minute'
+        ) WITH &&)
+        WHERE (status <> 'cancelled');
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS appointments_queue_idx;
+
+ALTER TABLE IF EXISTS appointments
+    DROP COLUMN IF EXISTS visit_seconds,
+    DROP COLUMN IF EXISTS wait_seconds,
+    DROP COLUMN IF EXISTS queue_number;
+
+DROP TABLE IF EXISTS appointment_queue_counters;
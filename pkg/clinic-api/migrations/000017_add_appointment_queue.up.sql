@@ -0,0 +1,23 @@
+-- The number a checked-in patient is called by. Numbers start from 1 every day in every clinic.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS queue_number INTEGER;
+
+-- The last queue number handed out by a clinic on a day
+CREATE TABLE IF NOT EXISTS appointment_queue_counters
+(
+    clinic_id   BIGINT  NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    date        DATE    NOT NULL,
+    last_number INTEGER NOT NULL,
+    PRIMARY KEY (clinic_id, date)
+);
+
+-- Waiting times: from arrival to the start of the visit, and the length of the visit
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS wait_seconds  INTEGER
+        GENERATED ALWAYS AS (EXTRACT(EPOCH FROM started_at - checked_in_at)::INTEGER) STORED,
+    ADD COLUMN IF NOT EXISTS visit_seconds INTEGER
+        GENERATED ALWAYS AS (EXTRACT(EPOCH FROM completed_at - started_at)::INTEGER) STORED;
+
+CREATE INDEX IF NOT EXISTS appointments_queue_idx
+    ON appointments (date, doctor_id, queue_number)
+    WHERE status IN ('checked_in', 'in_progress');
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS appointments_notify ON appointments;
+DROP FUNCTION IF EXISTS appointments_notify();
@@ -0,0 +1,41 @@
+-- Publishes every change of an appointment on the appointment_events channel, so that every API
+-- instance can stream it to its clients. Only IDs are sent, as NOTIFY payloads are limited to
+-- 8000 bytes.
+CREATE OR REPLACE FUNCTION appointments_notify() RETURNS TRIGGER AS
+$$
+DECLARE
+    row   appointments;
+    event TEXT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row := OLD;
+        event := 'deleted';
+    ELSE
+        row := NEW;
+        IF TG_OP = 'INSERT' THEN
+            event := 'created';
+        ELSIF NEW.status = 'cancelled' AND OLD.status <> 'cancelled' THEN
+            event := 'cancelled';
+        ELSE
+            event := 'updated';
+        END IF;
+    END IF;
+
+    PERFORM pg_notify('appointment_events', json_build_object(
+        'event', event,
+        'appointmentId', row.id,
+        'doctorId', row.doctor_id,
+        'patientId', row.patient_id,
+        'clinicId', (SELECT clinic_id FROM doctors WHERE id = row.doctor_id)
+    )::TEXT);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_notify ON appointments;
+CREATE TRIGGER appointments_notify
+    AFTER INSERT OR UPDATE OR DELETE
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_notify();
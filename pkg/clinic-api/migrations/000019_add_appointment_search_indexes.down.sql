@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS patients_name_trgm_idx;
+DROP EXTENSION IF EXISTS pg_trgm;
+DROP INDEX IF EXISTS doctors_specialty_idx;
+DROP INDEX IF EXISTS doctors_clinic_id_idx;
+DROP INDEX IF EXISTS appointments_date_status_idx;
@@ -0,0 +1,10 @@
+-- Date range searches across all doctors, optionally by status
+CREATE INDEX IF NOT EXISTS appointments_date_status_idx ON appointments (date, status);
+
+-- Clinic and specialty filters go through the doctor of the appointment
+CREATE INDEX IF NOT EXISTS doctors_clinic_id_idx ON doctors (clinic_id);
+CREATE INDEX IF NOT EXISTS doctors_specialty_idx ON doctors (lower(specialty));
+
+-- Trigram index for searching patients by any part of their name with ILIKE
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS patients_name_trgm_idx ON patients USING gin (name gin_trgm_ops);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS appointment_policy_overrides;
+
+DROP INDEX IF EXISTS appointments_rescheduled_from_idx;
+
+ALTER TABLE IF EXISTS appointments
+    DROP COLUMN IF EXISTS reschedule_count,
+    DROP COLUMN IF EXISTS rescheduled_from;
+
+DROP TABLE IF EXISTS clinic_policies;
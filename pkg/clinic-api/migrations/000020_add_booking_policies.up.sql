@@ -0,0 +1,34 @@
+-- The cancellation and rescheduling policy of a clinic. Clinics without a row have no limits.
+CREATE TABLE IF NOT EXISTS clinic_policies
+(
+    clinic_id                   BIGINT PRIMARY KEY REFERENCES clinics (id) ON DELETE CASCADE,
+    cancellation_notice_minutes INTEGER                     NOT NULL DEFAULT 0 CHECK (cancellation_notice_minutes >= 0),
+    reschedule_notice_minutes   INTEGER                     NOT NULL DEFAULT 0 CHECK (reschedule_notice_minutes >= 0),
+    max_reschedules             INTEGER CHECK (max_reschedules >= 0),
+    booking_horizon_days        INTEGER CHECK (booking_horizon_days > 0),
+    updated_at                  TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+-- A rescheduled appointment is cancelled, and the new one links back to it. The count is carried
+-- over along the chain, so that it limits the reschedules of the original booking.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS rescheduled_from BIGINT REFERENCES appointments (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS reschedule_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS appointments_rescheduled_from_idx ON appointments (rescheduled_from);
+
+-- Policy rules staff broke on purpose. The appointment ID is kept when the appointment is
+-- deleted, so that the record of the override stays.
+CREATE TABLE IF NOT EXISTS appointment_policy_overrides
+(
+    id             BIGSERIAL PRIMARY KEY,
+    appointment_id BIGINT                      NOT NULL,
+    user_id        BIGINT                      REFERENCES users (id) ON DELETE SET NULL,
+    action         TEXT                        NOT NULL,
+    rule           TEXT                        NOT NULL,
+    reason         TEXT                        NOT NULL,
+    created_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS appointment_policy_overrides_appointment_id_idx
+    ON appointment_policy_overrides (appointment_id);
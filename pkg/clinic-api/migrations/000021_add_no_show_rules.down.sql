@@ -0,0 +1,10 @@
+DELETE FROM permissions WHERE code = 'patients:admin';
+
+DROP INDEX IF EXISTS appointments_patient_id_status_idx;
+
+ALTER TABLE IF EXISTS patients
+    DROP COLUMN IF EXISTS no_shows_cleared_at;
+
+ALTER TABLE IF EXISTS clinic_policies
+    DROP COLUMN IF EXISTS no_show_window_days,
+    DROP COLUMN IF EXISTS no_show_limit;
@@ -0,0 +1,14 @@
+-- Patients with no_show_limit no-shows within no_show_window_days need staff approval for new
+-- bookings. A NULL limit turns the rule off.
+ALTER TABLE IF EXISTS clinic_policies
+    ADD COLUMN IF NOT EXISTS no_show_limit       INTEGER CHECK (no_show_limit > 0),
+    ADD COLUMN IF NOT EXISTS no_show_window_days INTEGER NOT NULL DEFAULT 90 CHECK (no_show_window_days > 0);
+
+-- No-shows before this moment no longer count towards the booking restriction.
+ALTER TABLE IF EXISTS patients
+    ADD COLUMN IF NOT EXISTS no_shows_cleared_at TIMESTAMP(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS appointments_patient_id_status_idx ON appointments (patient_id, status);
+
+INSERT INTO permissions (code)
+VALUES ('patients:admin');
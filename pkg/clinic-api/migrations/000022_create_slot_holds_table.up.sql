@@ -0,0 +1,21 @@
+-- A slot of a doctor held for a short time while a booking is being completed. Holds of the same
+-- doctor never overlap. Appointments and holds are checked against each other under an advisory
+-- lock of the doctor, since a constraint can not span two tables.
+CREATE TABLE IF NOT EXISTS slot_holds
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    doctor_id  BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    date       DATE                        NOT NULL,
+    start_time TIME                        NOT NULL,
+    end_time   TIME                        NOT NULL,
+    expires_at TIMESTAMP(0) with time zone NOT NULL,
+    CHECK (start_time < end_time),
+    CONSTRAINT slot_holds_doctor_overlap EXCLUDE USING gist (
+        doctor_id WITH =,
+        tsrange(date + start_time, date + end_time) WITH &&
+    )
+);
+
+CREATE INDEX IF NOT EXISTS slot_holds_expires_at_idx ON slot_holds (expires_at);
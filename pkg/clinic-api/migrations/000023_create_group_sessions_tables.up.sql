@@ -0,0 +1,38 @@
+-- A session of one doctor with many patients, such as a prenatal class or a vaccination day.
+-- Sessions of the same doctor never overlap, and sessions and appointments are checked against
+-- each other under the advisory lock of the doctor.
+CREATE TABLE IF NOT EXISTS group_sessions
+(
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    doctor_id   BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    title       TEXT                        NOT NULL,
+    description TEXT                        NOT NULL DEFAULT '',
+    date        DATE                        NOT NULL,
+    start_time  TIME                        NOT NULL,
+    end_time    TIME                        NOT NULL,
+    capacity    INTEGER                     NOT NULL CHECK (capacity > 0),
+    status      TEXT                        NOT NULL DEFAULT 'scheduled',
+    CHECK (start_time < end_time),
+    CONSTRAINT group_sessions_doctor_overlap EXCLUDE USING gist (
+        doctor_id WITH =,
+        tsrange(date + start_time, date + end_time) WITH &&
+    ) WHERE (status <> 'cancelled')
+);
+
+CREATE INDEX IF NOT EXISTS group_sessions_doctor_id_date_idx ON group_sessions (doctor_id, date);
+
+-- The patients of a session. Registered participants take a place, waitlisted ones wait for one
+-- in the order they joined. Attendance is recorded for registered participants only.
+CREATE TABLE IF NOT EXISTS group_session_participants
+(
+    session_id BIGINT                      NOT NULL REFERENCES group_sessions (id) ON DELETE CASCADE,
+    patient_id BIGINT                      NOT NULL REFERENCES patients (id) ON DELETE CASCADE,
+    status     TEXT                        NOT NULL,
+    attendance TEXT,
+    joined_at  TIMESTAMP with time zone    NOT NULL DEFAULT now(),
+    PRIMARY KEY (session_id, patient_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_session_participants_patient_id_idx ON group_session_participants (patient_id);
@@ -0,0 +1,11 @@
+-- Authentication tokens are listed to their users as sessions, with where they were last used
+-- from. The hash stays the primary key, the id only names a session in the API.
+ALTER TABLE IF EXISTS tokens
+    ADD COLUMN IF NOT EXISTS id           BIGSERIAL,
+    ADD COLUMN IF NOT EXISTS created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS ip           TEXT                        NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS user_agent   TEXT                        NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS tokens_id_key ON tokens (id);
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
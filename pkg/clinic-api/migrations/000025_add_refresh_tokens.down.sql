@@ -0,0 +1,14 @@
+ALTER TABLE IF EXISTS tokens
+    ADD COLUMN IF NOT EXISTS id BIGSERIAL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS tokens_id_key ON tokens (id);
+
+DELETE FROM tokens WHERE scope = 'refresh';
+
+DROP INDEX IF EXISTS tokens_family_id_idx;
+
+ALTER TABLE IF EXISTS tokens
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS family_id;
+
+DROP SEQUENCE IF EXISTS token_family_seq;
@@ -0,0 +1,21 @@
+-- The access and refresh tokens of one login form a family, which is one session of the user.
+-- Rotated refresh tokens are kept until they expire, so that a reuse of one is noticed and the
+-- whole family can be revoked.
+CREATE SEQUENCE IF NOT EXISTS token_family_seq;
+
+ALTER TABLE IF EXISTS tokens
+    ADD COLUMN IF NOT EXISTS family_id  BIGINT,
+    ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- Every authentication token issued so far is a session of its own.
+UPDATE tokens
+SET family_id = nextval('token_family_seq')
+WHERE scope = 'authentication' AND family_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
+
+-- Sessions are named by their family now, so tokens no longer need an id of their own.
+DROP INDEX IF EXISTS tokens_id_key;
+
+ALTER TABLE IF EXISTS tokens
+    DROP COLUMN IF EXISTS id;
@@ -0,0 +1,89 @@
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_code_idx ON permissions (code);
+
+-- Editing roles and assigning them to users
+INSERT INTO permissions (code)
+VALUES ('roles:admin');
+
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    code        TEXT                        NOT NULL UNIQUE,
+    name        TEXT                        NOT NULL,
+    description TEXT                        NOT NULL DEFAULT '',
+    -- Built-in roles are assigned by the API itself, so they can be edited but not deleted
+    builtin     BOOLEAN                     NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions
+(
+    role_id       BIGINT NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles
+(
+    user_id    BIGINT                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id    BIGINT                      NOT NULL REFERENCES roles ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS users_roles_role_id_idx ON users_roles (role_id);
+
+INSERT INTO roles (code, name, description, builtin)
+VALUES ('patient', 'Patient', 'Books and sees their own appointments', TRUE),
+       ('doctor', 'Doctor', 'Sees their own appointments and patients', TRUE),
+       ('receptionist', 'Receptionist', 'Books and manages the appointments of every patient', TRUE),
+       ('clinic_admin', 'Clinic administrator', 'Runs the clinics, their doctors and their patients', TRUE),
+       ('super_admin', 'Super administrator', 'Can do everything, including editing roles', TRUE);
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         INNER JOIN permissions ON permissions.code = ANY (CASE roles.code
+    WHEN 'patient' THEN ARRAY ['patients:write', 'patients:read', 'doctors:read', 'appointments:write',
+        'appointments:read', 'clinics:read']
+    WHEN 'doctor' THEN ARRAY ['doctors:write', 'doctors:read', 'patients:read', 'appointments:read',
+        'appointments:manage', 'clinics:read']
+    WHEN 'receptionist' THEN ARRAY ['patients:write', 'patients:read', 'doctors:read', 'appointments:write',
+        'appointments:read', 'appointments:manage', 'clinics:read', 'records:all']
+    WHEN 'clinic_admin' THEN ARRAY ['patients:write', 'patients:read', 'patients:admin', 'doctors:write',
+        'doctors:read', 'appointments:write', 'appointments:read', 'appointments:manage', 'clinics:write',
+        'clinics:read', 'records:all']
+    END)
+WHERE roles.code <> 'super_admin';
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.code = 'super_admin';
+
+-- Users which signed up as patients or doctors get the role instead of their copy of its
+-- permissions. Whatever else was granted to them stays a direct permission.
+INSERT INTO users_roles (user_id, role_id)
+SELECT DISTINCT patients.user_id, roles.id
+FROM patients,
+     roles
+WHERE patients.user_id IS NOT NULL
+  AND roles.code = 'patient'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO users_roles (user_id, role_id)
+SELECT DISTINCT doctors.user_id, roles.id
+FROM doctors,
+     roles
+WHERE doctors.user_id IS NOT NULL
+  AND roles.code = 'doctor'
+ON CONFLICT DO NOTHING;
+
+DELETE
+FROM users_permissions
+WHERE EXISTS (SELECT 1
+              FROM users_roles
+                       INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+              WHERE users_roles.user_id = users_permissions.user_id
+                AND roles_permissions.permission_id = users_permissions.permission_id);
@@ -0,0 +1,11 @@
+-- Listing users, deactivating them, forcing password resets and granting permissions
+INSERT INTO permissions (code)
+VALUES ('users:admin');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.code = 'super_admin'
+  AND permissions.code = 'users:admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS appointments_reset_reminders ON appointments;
+DROP FUNCTION IF EXISTS appointments_reset_reminders();
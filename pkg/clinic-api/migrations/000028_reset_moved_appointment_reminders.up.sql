@@ -0,0 +1,17 @@
+-- Reminders are sent for the time of an appointment, so a moved appointment gets them again
+CREATE OR REPLACE FUNCTION appointments_reset_reminders() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF (NEW.date, NEW.start_time) IS DISTINCT FROM (OLD.date, OLD.start_time) THEN
+        DELETE FROM appointment_reminders WHERE appointment_id = NEW.id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_reset_reminders ON appointments;
+CREATE TRIGGER appointments_reset_reminders
+    AFTER UPDATE
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_reset_reminders();
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS waitlist_offers_pending_expires_at_idx;
+
+UPDATE waitlist_offers
+SET status = 'declined'
+WHERE status = 'expired';
+
+ALTER TABLE waitlist_offers
+    DROP CONSTRAINT IF EXISTS waitlist_offers_status_check;
+ALTER TABLE waitlist_offers
+    ADD CONSTRAINT waitlist_offers_status_check CHECK (status IN ('pending', 'accepted', 'declined'));
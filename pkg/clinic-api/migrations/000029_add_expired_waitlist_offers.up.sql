@@ -0,0 +1,7 @@
+-- Offers which ran out unanswered, and whose slot has been offered to the next patient
+ALTER TABLE waitlist_offers
+    DROP CONSTRAINT IF EXISTS waitlist_offers_status_check;
+ALTER TABLE waitlist_offers
+    ADD CONSTRAINT waitlist_offers_status_check CHECK (status IN ('pending', 'accepted', 'declined', 'expired'));
+
+CREATE INDEX IF NOT EXISTS waitlist_offers_pending_expires_at_idx ON waitlist_offers (expires_at) WHERE status = 'pending';
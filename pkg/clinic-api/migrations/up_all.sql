@@ -111,3 +111,801 @@ VALUES ('doctors:read'),
        ('clinics:read'),
        ('clinics:write');
 --! 4 ends
+
+
+
+
+
+
+-- btree_gist lets us mix plain equality (doctor_id, patient_id) with range overlap in one
+-- exclusion constraint
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- A doctor can not be booked into two overlapping slots
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_doctor_overlap
+        EXCLUDE USING gist (doctor_id WITH =, tsrange(date + start_time, date + end_time) WITH &&)
+        WHERE (status <> 'cancelled');
+
+-- A patient can not be in two places at once
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_patient_overlap
+        EXCLUDE USING gist (patient_id WITH =, tsrange(date + start_time, date + end_time) WITH &&)
+        WHERE (status <> 'cancelled');
+--! 5 ends
+
+
+
+
+
+
+-- weekday follows Go's time.Weekday: 0 = Sunday, 1 = Monday, ..., 6 = Saturday
+CREATE TABLE IF NOT EXISTS doctor_schedules
+(
+    id             BIGSERIAL PRIMARY KEY,
+    doctor_id      BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    weekday        SMALLINT                    NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time     TIME                        NOT NULL,
+    end_time       TIME                        NOT NULL,
+    slot_minutes   INTEGER                     NOT NULL CHECK (slot_minutes > 0),
+    effective_from DATE                        NOT NULL,
+    effective_to   DATE,
+    created_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (start_time < end_time),
+    CHECK (effective_to IS NULL OR effective_from <= effective_to)
+);
+
+CREATE INDEX IF NOT EXISTS doctor_schedules_doctor_id_idx ON doctor_schedules (doctor_id);
+CREATE INDEX IF NOT EXISTS appointments_doctor_id_date_idx ON appointments (doctor_id, date);
+--! 6 ends
+
+
+
+
+
+
+-- Statuses used to be free text. Anything outside of the lifecycle is reset to 'requested',
+-- except the cancelled ones which have to keep freeing their time slot.
+UPDATE appointments
+SET status = 'cancelled'
+WHERE lower(status) IN ('cancelled', 'canceled');
+
+UPDATE appointments
+SET status = 'requested'
+WHERE status NOT IN ('requested', 'confirmed', 'checked_in', 'in_progress', 'completed', 'cancelled', 'no_show');
+
+ALTER TABLE appointments
+    ALTER COLUMN status SET DEFAULT 'requested',
+    ADD CONSTRAINT appointments_status_check
+        CHECK (status IN ('requested', 'confirmed', 'checked_in', 'in_progress', 'completed', 'cancelled', 'no_show'));
+
+-- Who moved the appointment into each status, and when
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS confirmed_at        TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS confirmed_by        BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS checked_in_at       TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS checked_in_by       BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS started_at          TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS started_by          BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS completed_at        TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS completed_by        BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS cancelled_at        TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS cancelled_by        BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS cancellation_reason TEXT,
+    ADD COLUMN IF NOT EXISTS no_show_at          TIMESTAMP(0) with time zone,
+    ADD COLUMN IF NOT EXISTS no_show_by          BIGINT REFERENCES users (id) ON DELETE SET NULL;
+
+-- Confirming, checking in, starting, completing and marking no-shows is done by clinic staff
+INSERT INTO permissions (code)
+VALUES ('appointments:manage');
+--! 7 ends
+
+
+
+
+
+
+-- A series is the template of a recurring appointment. Its occurrences are expanded from the
+-- RFC 5545 rule into regular rows of the appointments table.
+CREATE TABLE IF NOT EXISTS appointment_series
+(
+    id         BIGSERIAL PRIMARY KEY,
+    patient_id BIGINT                      NOT NULL REFERENCES patients (id),
+    doctor_id  BIGINT                      NOT NULL REFERENCES doctors (id),
+    start_date DATE                        NOT NULL,
+    start_time TIME                        NOT NULL,
+    end_time   TIME                        NOT NULL,
+    rrule      TEXT                        NOT NULL,
+    status     TEXT                        NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (start_time < end_time)
+);
+
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS series_id BIGINT REFERENCES appointment_series (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS appointments_series_id_idx ON appointments (series_id);
+--! 8 ends
+
+
+
+
+
+
+CREATE TABLE IF NOT EXISTS waitlist_entries
+(
+    id                   BIGSERIAL PRIMARY KEY,
+    doctor_id            BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    patient_id           BIGINT                      NOT NULL REFERENCES patients (id) ON DELETE CASCADE,
+    preferred_from       DATE                        NOT NULL,
+    preferred_to         DATE                        NOT NULL,
+    preferred_start_time TIME,
+    preferred_end_time   TIME,
+    notes                TEXT                        NOT NULL DEFAULT '',
+    status               TEXT                        NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'booked')),
+    created_at           TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (preferred_from <= preferred_to),
+    CHECK (preferred_start_time IS NULL OR preferred_end_time IS NULL OR preferred_start_time < preferred_end_time)
+);
+
+CREATE INDEX IF NOT EXISTS waitlist_entries_doctor_id_idx ON waitlist_entries (doctor_id, status, created_at);
+
+-- An offer hands a freed time slot to the patient at the head of the waitlist for a limited time
+CREATE TABLE IF NOT EXISTS waitlist_offers
+(
+    id             BIGSERIAL PRIMARY KEY,
+    entry_id       BIGINT                      NOT NULL REFERENCES waitlist_entries (id) ON DELETE CASCADE,
+    date           DATE                        NOT NULL,
+    start_time     TIME                        NOT NULL,
+    end_time       TIME                        NOT NULL,
+    expires_at     TIMESTAMP(0) with time zone NOT NULL,
+    status         TEXT                        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined')),
+    appointment_id BIGINT REFERENCES appointments (id) ON DELETE SET NULL,
+    created_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS waitlist_offers_entry_id_idx ON waitlist_offers (entry_id);
+--! 9 ends
+
+
+
+
+
+
+CREATE INDEX IF NOT EXISTS patients_user_id_idx ON patients (user_id);
+CREATE INDEX IF NOT EXISTS doctors_user_id_idx ON doctors (user_id);
+CREATE INDEX IF NOT EXISTS appointments_patient_id_idx ON appointments (patient_id);
+
+-- Admins and front-desk staff see every patient and appointment, everybody else only their own
+INSERT INTO permissions (code)
+VALUES ('records:all');
+--! 10 ends
+
+
+
+
+
+
+-- Every reminder sent for an appointment, so that restarts don't send the same reminder twice
+CREATE TABLE IF NOT EXISTS appointment_reminders
+(
+    appointment_id BIGINT                      NOT NULL REFERENCES appointments (id) ON DELETE CASCADE,
+    lead_seconds   BIGINT                      NOT NULL,
+    sent_at        TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (appointment_id, lead_seconds)
+);
+
+CREATE INDEX IF NOT EXISTS appointments_date_start_time_idx ON appointments ((date + start_time));
+--! 11 ends
+
+
+
+
+
+
+-- The iCalendar SEQUENCE of an appointment. It grows with every change calendar clients
+-- care about, so that they replace the event they already have.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS sequence INTEGER NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION appointments_bump_sequence() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF (NEW.patient_id, NEW.doctor_id, NEW.date, NEW.start_time, NEW.end_time, NEW.status)
+        IS DISTINCT FROM (OLD.patient_id, OLD.doctor_id, OLD.date, OLD.start_time, OLD.end_time, OLD.status) THEN
+        NEW.sequence := OLD.sequence + 1;
+        NEW.updated_at := now();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_bump_sequence ON appointments;
+CREATE TRIGGER appointments_bump_sequence
+    BEFORE UPDATE
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_bump_sequence();
+--! 12 ends
+
+
+
+
+
+
+-- Vacations, conferences, sick leave and other absences during which a doctor can't be booked.
+-- Like appointments, the ranges are in the local time of the clinic.
+CREATE TABLE IF NOT EXISTS doctor_time_off
+(
+    id         BIGSERIAL PRIMARY KEY,
+    doctor_id  BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    starts_at  TIMESTAMP(0)                NOT NULL,
+    ends_at    TIMESTAMP(0)                NOT NULL,
+    reason     TEXT                        NOT NULL DEFAULT '',
+    created_by BIGINT                      REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    CHECK (starts_at < ends_at)
+);
+
+CREATE INDEX IF NOT EXISTS doctor_time_off_doctor_id_idx ON doctor_time_off USING gist (doctor_id, tsrange(starts_at, ends_at));
+--! 13 ends
+
+
+
+
+
+
+-- The IANA time zone of the clinic. Appointment dates and times are wall-clock times in it.
+ALTER TABLE IF EXISTS clinics
+    ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Asia/Almaty';
+
+-- Weekly opening hours, with 0 being Sunday as in EXTRACT(DOW ...). A clinic without any
+-- opening hours is treated as always open.
+CREATE TABLE IF NOT EXISTS clinic_opening_hours
+(
+    id         BIGSERIAL PRIMARY KEY,
+    clinic_id  BIGINT  NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    weekday    INTEGER NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    open_time  TIME    NOT NULL,
+    close_time TIME    NOT NULL,
+    CHECK (open_time < close_time)
+);
+
+CREATE INDEX IF NOT EXISTS clinic_opening_hours_clinic_id_idx ON clinic_opening_hours (clinic_id, weekday);
+
+-- Days on which the clinic is closed
+CREATE TABLE IF NOT EXISTS clinic_holidays
+(
+    id         BIGSERIAL PRIMARY KEY,
+    clinic_id  BIGINT                      NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    date       DATE                        NOT NULL,
+    name       TEXT                        NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    UNIQUE (clinic_id, date)
+);
+--! 14 ends
+
+
+
+
+
+
+-- Rooms and equipment of a clinic which procedures need on top of a doctor
+CREATE TABLE IF NOT EXISTS resources
+(
+    id          BIGSERIAL PRIMARY KEY,
+    clinic_id   BIGINT                      NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    name        TEXT                        NOT NULL,
+    kind        TEXT                        NOT NULL CHECK (kind IN ('room', 'equipment')),
+    description TEXT                        NOT NULL DEFAULT '',
+    created_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS resources_clinic_id_idx ON resources (clinic_id, kind);
+
+-- The resources reserved by an appointment. The time range and the status are copied from the
+-- appointment, so that an exclusion constraint can keep a resource from being booked twice.
+CREATE TABLE IF NOT EXISTS appointment_resources
+(
+    appointment_id BIGINT  NOT NULL REFERENCES appointments (id) ON DELETE CASCADE,
+    resource_id    BIGINT  NOT NULL REFERENCES resources (id),
+    period         TSRANGE NOT NULL,
+    cancelled      BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (appointment_id, resource_id),
+    CONSTRAINT appointment_resources_overlap
+        EXCLUDE USING gist (resource_id WITH =, period WITH &&) WHERE (NOT cancelled)
+);
+
+-- Keeps the reservations in line with their appointment when it is moved or cancelled. A move
+-- onto a taken resource fails the appointment update with the exclusion violation.
+CREATE OR REPLACE FUNCTION appointments_sync_resources() RETURNS TRIGGER AS
+$$
+BEGIN
+    UPDATE appointment_resources
+    SET period    = tsrange(NEW.date + NEW.start_time, NEW.date + NEW.end_time),
+        cancelled = NEW.status = 'cancelled'
+    WHERE appointment_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_sync_resources ON appointments;
+CREATE TRIGGER appointments_sync_resources
+    AFTER UPDATE OF date, start_time, end_time, status
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_sync_resources();
+--! 15 ends
+
+
+
+
+
+
+-- The catalog of appointment types of a clinic, such as an initial consultation or a procedure.
+-- An empty specialty means that any doctor of the clinic can take the appointment.
+CREATE TABLE IF NOT EXISTS appointment_types
+(
+    id                    BIGSERIAL PRIMARY KEY,
+    clinic_id             BIGINT                      NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    name                  TEXT                        NOT NULL,
+    duration_minutes      INTEGER                     NOT NULL CHECK (duration_minutes > 0),
+    buffer_before_minutes INTEGER                     NOT NULL DEFAULT 0 CHECK (buffer_before_minutes >= 0),
+    buffer_after_minutes  INTEGER                     NOT NULL DEFAULT 0 CHECK (buffer_after_minutes >= 0),
+    specialty             TEXT                        NOT NULL DEFAULT '',
+    preparation           TEXT                        NOT NULL DEFAULT '',
+    created_at            TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at            TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS appointment_types_clinic_id_idx ON appointment_types (clinic_id);
+
+-- The buffers are copied from the type when the appointment is booked, so that later changes
+-- of the catalog don't move existing appointments.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS type_id       BIGINT REFERENCES appointment_types (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS buffer_before INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS buffer_after  INTEGER NOT NULL DEFAULT 0;
+
+-- The doctor is busy during the buffers too, so they are part of the doctor's overlap check.
+ALTER TABLE appointments
+    DROP CONSTRAINT IF EXISTS appointments_doctor_overlap;
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_doctor_overlap
+        EXCLUDE USING gist (doctor_id WITH =, tsrange(
+            date + start_time - buffer_before * INTERVAL '1 minute',
+            date + end_time + buffer_after * INTERVAL '1 minute'
+        ) WITH &&)
+        WHERE (status <> 'cancelled');
+--! 16 ends
+
+
+
+
+
+
+-- The number a checked-in patient is called by. Numbers start from 1 every day in every clinic.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS queue_number INTEGER;
+
+-- The last queue number handed out by a clinic on a day
+CREATE TABLE IF NOT EXISTS appointment_queue_counters
+(
+    clinic_id   BIGINT  NOT NULL REFERENCES clinics (id) ON DELETE CASCADE,
+    date        DATE    NOT NULL,
+    last_number INTEGER NOT NULL,
+    PRIMARY KEY (clinic_id, date)
+);
+
+-- Waiting times: from arrival to the start of the visit, and the length of the visit
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS wait_seconds  INTEGER
+        GENERATED ALWAYS AS (EXTRACT(EPOCH FROM started_at - checked_in_at)::INTEGER) STORED,
+    ADD COLUMN IF NOT EXISTS visit_seconds INTEGER
+        GENERATED ALWAYS AS (EXTRACT(EPOCH FROM completed_at - started_at)::INTEGER) STORED;
+
+CREATE INDEX IF NOT EXISTS appointments_queue_idx
+    ON appointments (date, doctor_id, queue_number)
+    WHERE status IN ('checked_in', 'in_progress');
+--! 17 ends
+
+
+
+
+
+
+-- Publishes every change of an appointment on the appointment_events channel, so that every API
+-- instance can stream it to its clients. Only IDs are sent, as NOTIFY payloads are limited to
+-- 8000 bytes.
+CREATE OR REPLACE FUNCTION appointments_notify() RETURNS TRIGGER AS
+$$
+DECLARE
+    row   appointments;
+    event TEXT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row := OLD;
+        event := 'deleted';
+    ELSE
+        row := NEW;
+        IF TG_OP = 'INSERT' THEN
+            event := 'created';
+        ELSIF NEW.status = 'cancelled' AND OLD.status <> 'cancelled' THEN
+            event := 'cancelled';
+        ELSE
+            event := 'updated';
+        END IF;
+    END IF;
+
+    PERFORM pg_notify('appointment_events', json_build_object(
+        'event', event,
+        'appointmentId', row.id,
+        'doctorId', row.doctor_id,
+        'patientId', row.patient_id,
+        'clinicId', (SELECT clinic_id FROM doctors WHERE id = row.doctor_id)
+    )::TEXT);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_notify ON appointments;
+CREATE TRIGGER appointments_notify
+    AFTER INSERT OR UPDATE OR DELETE
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_notify();
+--! 18 ends
+
+
+
+
+
+
+-- Date range searches across all doctors, optionally by status
+CREATE INDEX IF NOT EXISTS appointments_date_status_idx ON appointments (date, status);
+
+-- Clinic and specialty filters go through the doctor of the appointment
+CREATE INDEX IF NOT EXISTS doctors_clinic_id_idx ON doctors (clinic_id);
+CREATE INDEX IF NOT EXISTS doctors_specialty_idx ON doctors (lower(specialty));
+
+-- Trigram index for searching patients by any part of their name with ILIKE
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS patients_name_trgm_idx ON patients USING gin (name gin_trgm_ops);
+--! 19 ends
+
+
+
+
+
+
+-- The cancellation and rescheduling policy of a clinic. Clinics without a row have no limits.
+CREATE TABLE IF NOT EXISTS clinic_policies
+(
+    clinic_id                   BIGINT PRIMARY KEY REFERENCES clinics (id) ON DELETE CASCADE,
+    cancellation_notice_minutes INTEGER                     NOT NULL DEFAULT 0 CHECK (cancellation_notice_minutes >= 0),
+    reschedule_notice_minutes   INTEGER                     NOT NULL DEFAULT 0 CHECK (reschedule_notice_minutes >= 0),
+    max_reschedules             INTEGER CHECK (max_reschedules >= 0),
+    booking_horizon_days        INTEGER CHECK (booking_horizon_days > 0),
+    updated_at                  TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+-- A rescheduled appointment is cancelled, and the new one links back to it. The count is carried
+-- over along the chain, so that it limits the reschedules of the original booking.
+ALTER TABLE IF EXISTS appointments
+    ADD COLUMN IF NOT EXISTS rescheduled_from BIGINT REFERENCES appointments (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS reschedule_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS appointments_rescheduled_from_idx ON appointments (rescheduled_from);
+
+-- Policy rules staff broke on purpose. The appointment ID is kept when the appointment is
+-- deleted, so that the record of the override stays.
+CREATE TABLE IF NOT EXISTS appointment_policy_overrides
+(
+    id             BIGSERIAL PRIMARY KEY,
+    appointment_id BIGINT                      NOT NULL,
+    user_id        BIGINT                      REFERENCES users (id) ON DELETE SET NULL,
+    action         TEXT                        NOT NULL,
+    rule           TEXT                        NOT NULL,
+    reason         TEXT                        NOT NULL,
+    created_at     TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS appointment_policy_overrides_appointment_id_idx
+    ON appointment_policy_overrides (appointment_id);
+--! 20 ends
+
+
+
+
+
+
+-- Patients with no_show_limit no-shows within no_show_window_days need staff approval for new
+-- bookings. A NULL limit turns the rule off.
+ALTER TABLE IF EXISTS clinic_policies
+    ADD COLUMN IF NOT EXISTS no_show_limit       INTEGER CHECK (no_show_limit > 0),
+    ADD COLUMN IF NOT EXISTS no_show_window_days INTEGER NOT NULL DEFAULT 90 CHECK (no_show_window_days > 0);
+
+-- No-shows before this moment no longer count towards the booking restriction.
+ALTER TABLE IF EXISTS patients
+    ADD COLUMN IF NOT EXISTS no_shows_cleared_at TIMESTAMP(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS appointments_patient_id_status_idx ON appointments (patient_id, status);
+
+INSERT INTO permissions (code)
+VALUES ('patients:admin');
+--! 21 ends
+
+
+
+
+
+
+-- A slot of a doctor held for a short time while a booking is being completed. Holds of the same
+-- doctor never overlap. Appointments and holds are checked against each other under an advisory
+-- lock of the doctor, since a constraint can not span two tables.
+CREATE TABLE IF NOT EXISTS slot_holds
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    doctor_id  BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    date       DATE                        NOT NULL,
+    start_time TIME                        NOT NULL,
+    end_time   TIME                        NOT NULL,
+    expires_at TIMESTAMP(0) with time zone NOT NULL,
+    CHECK (start_time < end_time),
+    CONSTRAINT slot_holds_doctor_overlap EXCLUDE USING gist (
+        doctor_id WITH =,
+        tsrange(date + start_time, date + end_time) WITH &&
+    )
+);
+
+CREATE INDEX IF NOT EXISTS slot_holds_expires_at_idx ON slot_holds (expires_at);
+--! 22 ends
+
+
+
+
+
+
+-- A session of one doctor with many patients, such as a prenatal class or a vaccination day.
+-- Sessions of the same doctor never overlap, and sessions and appointments are checked against
+-- each other under the advisory lock of the doctor.
+CREATE TABLE IF NOT EXISTS group_sessions
+(
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    doctor_id   BIGINT                      NOT NULL REFERENCES doctors (id) ON DELETE CASCADE,
+    title       TEXT                        NOT NULL,
+    description TEXT                        NOT NULL DEFAULT '',
+    date        DATE                        NOT NULL,
+    start_time  TIME                        NOT NULL,
+    end_time    TIME                        NOT NULL,
+    capacity    INTEGER                     NOT NULL CHECK (capacity > 0),
+    status      TEXT                        NOT NULL DEFAULT 'scheduled',
+    CHECK (start_time < end_time),
+    CONSTRAINT group_sessions_doctor_overlap EXCLUDE USING gist (
+        doctor_id WITH =,
+        tsrange(date + start_time, date + end_time) WITH &&
+    ) WHERE (status <> 'cancelled')
+);
+
+CREATE INDEX IF NOT EXISTS group_sessions_doctor_id_date_idx ON group_sessions (doctor_id, date);
+
+-- The patients of a session. Registered participants take a place, waitlisted ones wait for one
+-- in the order they joined. Attendance is recorded for registered participants only.
+CREATE TABLE IF NOT EXISTS group_session_participants
+(
+    session_id BIGINT                      NOT NULL REFERENCES group_sessions (id) ON DELETE CASCADE,
+    patient_id BIGINT                      NOT NULL REFERENCES patients (id) ON DELETE CASCADE,
+    status     TEXT                        NOT NULL,
+    attendance TEXT,
+    joined_at  TIMESTAMP with time zone    NOT NULL DEFAULT now(),
+    PRIMARY KEY (session_id, patient_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_session_participants_patient_id_idx ON group_session_participants (patient_id);
+--! 23 ends
+
+
+
+
+
+
+-- Authentication tokens are listed to their users as sessions, with where they were last used
+-- from. The hash stays the primary key, the id only names a session in the API.
+ALTER TABLE IF EXISTS tokens
+    ADD COLUMN IF NOT EXISTS id           BIGSERIAL,
+    ADD COLUMN IF NOT EXISTS created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS ip           TEXT                        NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS user_agent   TEXT                        NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS tokens_id_key ON tokens (id);
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
+--! 24 ends
+
+
+
+
+
+
+-- The access and refresh tokens of one login form a family, which is one session of the user.
+-- Rotated refresh tokens are kept until they expire, so that a reuse of one is noticed and the
+-- whole family can be revoked.
+CREATE SEQUENCE IF NOT EXISTS token_family_seq;
+
+ALTER TABLE IF EXISTS tokens
+    ADD COLUMN IF NOT EXISTS family_id  BIGINT,
+    ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- Every authentication token issued so far is a session of its own.
+UPDATE tokens
+SET family_id = nextval('token_family_seq')
+WHERE scope = 'authentication' AND family_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
+
+-- Sessions are named by their family now, so tokens no longer need an id of their own.
+DROP INDEX IF EXISTS tokens_id_key;
+
+ALTER TABLE IF EXISTS tokens
+    DROP COLUMN IF EXISTS id;
+--! 25 ends
+
+
+
+
+
+
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_code_idx ON permissions (code);
+
+-- Editing roles and assigning them to users
+INSERT INTO permissions (code)
+VALUES ('roles:admin');
+
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    code        TEXT                        NOT NULL UNIQUE,
+    name        TEXT                        NOT NULL,
+    description TEXT                        NOT NULL DEFAULT '',
+    -- Built-in roles are assigned by the API itself, so they can be edited but not deleted
+    builtin     BOOLEAN                     NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions
+(
+    role_id       BIGINT NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles
+(
+    user_id    BIGINT                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id    BIGINT                      NOT NULL REFERENCES roles ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS users_roles_role_id_idx ON users_roles (role_id);
+
+INSERT INTO roles (code, name, description, builtin)
+VALUES ('patient', 'Patient', 'Books and sees their own appointments', TRUE),
+       ('doctor', 'Doctor', 'Sees their own appointments and patients', TRUE),
+       ('receptionist', 'Receptionist', 'Books and manages the appointments of every patient', TRUE),
+       ('clinic_admin', 'Clinic administrator', 'Runs the clinics, their doctors and their patients', TRUE),
+       ('super_admin', 'Super administrator', 'Can do everything, including editing roles', TRUE);
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         INNER JOIN permissions ON permissions.code = ANY (CASE roles.code
+    WHEN 'patient' THEN ARRAY ['patients:write', 'patients:read', 'doctors:read', 'appointments:write',
+        'appointments:read', 'clinics:read']
+    WHEN 'doctor' THEN ARRAY ['doctors:write', 'doctors:read', 'patients:read', 'appointments:read',
+        'appointments:manage', 'clinics:read']
+    WHEN 'receptionist' THEN ARRAY ['patients:write', 'patients:read', 'doctors:read', 'appointments:write',
+        'appointments:read', 'appointments:manage', 'clinics:read', 'records:all']
+    WHEN 'clinic_admin' THEN ARRAY ['patients:write', 'patients:read', 'patients:admin', 'doctors:write',
+        'doctors:read', 'appointments:write', 'appointments:read', 'appointments:manage', 'clinics:write',
+        'clinics:read', 'records:all']
+    END)
+WHERE roles.code <> 'super_admin';
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.code = 'super_admin';
+
+-- Users which signed up as patients or doctors get the role instead of their copy of its
+-- permissions. Whatever else was granted to them stays a direct permission.
+INSERT INTO users_roles (user_id, role_id)
+SELECT DISTINCT patients.user_id, roles.id
+FROM patients,
+     roles
+WHERE patients.user_id IS NOT NULL
+  AND roles.code = 'patient'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO users_roles (user_id, role_id)
+SELECT DISTINCT doctors.user_id, roles.id
+FROM doctors,
+     roles
+WHERE doctors.user_id IS NOT NULL
+  AND roles.code = 'doctor'
+ON CONFLICT DO NOTHING;
+
+DELETE
+FROM users_permissions
+WHERE EXISTS (SELECT 1
+              FROM users_roles
+                       INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+              WHERE users_roles.user_id = users_permissions.user_id
+                AND roles_permissions.permission_id = users_permissions.permission_id);
+--! 26 ends
+
+
+
+
+
+
+-- Listing users, deactivating them, forcing password resets and granting permissions
+INSERT INTO permissions (code)
+VALUES ('users:admin');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.code = 'super_admin'
+  AND permissions.code = 'users:admin'
+ON CONFLICT DO NOTHING;
+--! 27 ends
+
+
+
+
+
+
+-- Reminders are sent for the time of an appointment, so a moved appointment gets them again
+CREATE OR REPLACE FUNCTION appointments_reset_reminders() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF (NEW.date, NEW.start_time) IS DISTINCT FROM (OLD.date, OLD.start_time) THEN
+        DELETE FROM appointment_reminders WHERE appointment_id = NEW.id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_reset_reminders ON appointments;
+CREATE TRIGGER appointments_reset_reminders
+    AFTER UPDATE
+    ON appointments
+    FOR EACH ROW
+EXECUTE FUNCTION appointments_reset_reminders();
+--! 28 ends
+
+
+
+
+
+
+-- Offers which ran out unanswered, and whose slot has been offered to the next patient
+ALTER TABLE waitlist_offers
+    DROP CONSTRAINT IF EXISTS waitlist_offers_status_check;
+ALTER TABLE waitlist_offers
+    ADD CONSTRAINT waitlist_offers_status_check CHECK (status IN ('pending', 'accepted', 'declined', 'expired'));
+
+CREATE INDEX IF NOT EXISTS waitlist_offers_pending_expires_at_idx ON waitlist_offers (expires_at) WHERE status = 'pending';
+--! 29 ends
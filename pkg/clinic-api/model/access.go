@@ -0,0 +1,94 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PermissionAllRecords lets admins and front-desk staff see every patient and appointment.
+const PermissionAllRecords = "records:all"
+
+// AccessScope describes which rows a user may see. Users with PermissionAllRecords see
+// everything; a patient sees their own Patient row and appointments; a doctor sees their own
+// appointments and the patients they have appointments with.
+type AccessScope struct {
+	All       bool
+	PatientID *int64
+	DoctorID  *int64
+}
+
+// appointmentCondition returns an SQL condition restricting appointments to the scope, using
+// the placeholders $n, $n+1 and $n+2, together with the arguments to pass for them.
+func (s AccessScope) appointmentCondition(n int) (string, []interface{}) {
+	condition := fmt.Sprintf("($%d OR patient_id = $%d OR doctor_id = $%d)", n, n+1, n+2)
+	return condition, []interface{}{s.All, s.PatientID, s.DoctorID}
+}
+
+// patientCondition is like appointmentCondition, but for rows of the patients table.
+func (s AccessScope) patientCondition(n int) (string, []interface{}) {
+	condition := fmt.Sprintf(`($%d OR patients.id = $%d OR EXISTS (
+			SELECT 1 FROM appointments WHERE appointments.patient_id = patients.id AND appointments.doctor_id = $%d
+		))`, n, n+1, n+2)
+	return condition, []interface{}{s.All, s.PatientID, s.DoctorID}
+}
+
+// CanAccessAppointment reports whether the appointment belongs to the patient or the doctor
+// of the scope.
+func (s AccessScope) CanAccessAppointment(appointment *Appointment) bool {
+	return s.CanBook(appointment.PatientId, appointment.DoctorId)
+}
+
+// CanBook reports whether an appointment between the patient and the doctor with the given
+// IDs would be within the scope.
+func (s AccessScope) CanBook(patientID, doctorID string) bool {
+	return s.All || matchesID(s.PatientID, patientID) || matchesID(s.DoctorID, doctorID)
+}
+
+// CanAccessSeries reports whether the series belongs to the patient or the doctor of the scope.
+func (s AccessScope) CanAccessSeries(series *AppointmentSeries) bool {
+	return s.All || s.IsPatient(series.PatientID) || s.IsDoctor(series.DoctorID)
+}
+
+// IsPatient reports whether the scope is limited to the patient with the given ID.
+func (s AccessScope) IsPatient(patientID int64) bool {
+	return s.PatientID != nil && *s.PatientID == patientID
+}
+
+// IsDoctor reports whether the scope is limited to the doctor with the given ID.
+func (s AccessScope) IsDoctor(doctorID int64) bool {
+	return s.DoctorID != nil && *s.DoctorID == doctorID
+}
+
+func matchesID(scopeID *int64, id string) bool {
+	n, err := strconv.ParseInt(id, 10, 64)
+	return err == nil && scopeID != nil && *scopeID == n
+}
+
+// GetAccessScope builds the scope of the user from their permissions and from the Patient and
+// Doctor rows linked to them through user_id.
+func (m PermissionModel) GetAccessScope(userID int64, permissions Permissions) (AccessScope, error) {
+	if permissions.Include(PermissionAllRecords) {
+		return AccessScope{All: true}, nil
+	}
+
+	query := `
+		SELECT (SELECT id FROM patients WHERE user_id = $1 ORDER BY id LIMIT 1),
+			(SELECT id FROM doctors WHERE user_id = $1 ORDER BY id LIMIT 1)
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var scope AccessScope
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&scope.PatientID, &scope.DoctorID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return AccessScope{}, err
+	}
+
+	return scope, nil
+}
@@ -2,14 +2,215 @@ package model
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/lib/pq"
+)
+
+// The statuses of the appointment lifecycle:
+//
+//	requested -> confirmed -> checked_in -> in_progress -> completed
+//
+// An appointment can be cancelled at any point before it is in progress, and a confirmed
+// appointment the patient never came to is marked as a no-show. Completed, cancelled and
+// no-show appointments are final.
+const (
+	StatusRequested  = "requested"
+	StatusConfirmed  = "confirmed"
+	StatusCheckedIn  = "checked_in"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	// StatusCancelled is the only status which frees the booked time slot again.
+	StatusCancelled = "cancelled"
+	StatusNoShow    = "no_show"
+)
+
+// appointmentTransitions maps every status to the statuses an appointment may move to from it.
+var appointmentTransitions = map[string][]string{
+	StatusRequested:  {StatusConfirmed, StatusCancelled},
+	StatusConfirmed:  {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn:  {StatusInProgress, StatusCompleted, StatusCancelled},
+	StatusInProgress: {StatusCompleted},
+	StatusCompleted:  {},
+	StatusCancelled:  {},
+	StatusNoShow:     {},
+}
+
+// statusColumns holds the prefix of the <prefix>_at and <prefix>_by columns which record
+// the moment an appointment entered a status, and the user who moved it there.
+var statusColumns = map[string]string{
+	StatusConfirmed:  "confirmed",
+	StatusCheckedIn:  "checked_in",
+	StatusInProgress: "started",
+	StatusCompleted:  "completed",
+	StatusCancelled:  "cancelled",
+	StatusNoShow:     "no_show",
+}
+
+var (
+	// ErrAppointmentConflict is returned when an appointment overlaps with another (not
+	// cancelled) appointment of the same doctor or the same patient.
+	ErrAppointmentConflict = errors.New("appointment conflict")
+
+	// ErrInvalidTransition is returned when an appointment can not move from its current status
+	// to the requested one.
+	ErrInvalidTransition = errors.New("invalid status transition")
 )
 
+// appointmentColumns lists the appointments columns in the order expected by
+// (*Appointment).scanDest. Dates and times are formatted the same way clients send them, so
+// that a read appointment can be written back as it is. The columns are qualified with the
+// table name, so that queries can join other tables with columns of the same names.
+const appointmentColumns = `
+	appointments.id, appointments.created_at, appointments.updated_at, appointments.patient_id,
+	appointments.doctor_id, to_char(appointments.date, 'YYYY-MM-DD'),
+	to_char(appointments.start_time, 'HH24:MI'), to_char(appointments.end_time, 'HH24:MI'),
+	appointments.status, appointments.series_id,
+	appointments.confirmed_at, appointments.confirmed_by, appointments.checked_in_at,
+	appointments.checked_in_by, appointments.started_at, appointments.started_by,
+	appointments.completed_at, appointments.completed_by, appointments.cancelled_at,
+	appointments.cancelled_by, appointments.cancellation_reason,
+	appointments.no_show_at, appointments.no_show_by, appointments.sequence, appointments.type_id,
+	appointments.buffer_before, appointments.buffer_after,
+	appointments.queue_number, appointments.wait_seconds, appointments.visit_seconds,
+	appointments.rescheduled_from, appointments.reschedule_count,
+	COALESCE((
+		SELECT clinics.timezone FROM doctors INNER JOIN clinics ON clinics.id = doctors.clinic_id
+		WHERE doctors.id = appointments.doctor_id
+	), '` + DefaultTimezone + `'),
+	ARRAY(
+		SELECT resource_id FROM appointment_resources
+		WHERE appointment_id = appointments.id ORDER BY resource_id
+	)`
+
+// scanDest returns the scan destinations for a row selected with appointmentColumns.
+func (a *Appointment) scanDest() []interface{} {
+	return []interface{}{
+		&a.Id, &a.CreatedAt, &a.UpdatedAt, &a.PatientId, &a.DoctorId, &a.Date, &a.StartTime, &a.EndTime, &a.Status, &a.SeriesId,
+		&a.ConfirmedAt, &a.ConfirmedBy, &a.CheckedInAt, &a.CheckedInBy, &a.StartedAt, &a.StartedBy,
+		&a.CompletedAt, &a.CompletedBy, &a.CancelledAt, &a.CancelledBy, &a.CancellationReason,
+		&a.NoShowAt, &a.NoShowBy, &a.Sequence, &a.TypeID, &a.BufferBeforeMinutes, &a.BufferAfterMinutes,
+		&a.QueueNumber, &a.WaitSeconds, &a.VisitSeconds, &a.RescheduledFrom, &a.RescheduleCount, &a.Timezone, pq.Array(&a.ResourceIDs),
+	}
+}
+
+// Interval returns the start and the end of the appointment as instants in the time zone of
+// its clinic.
+func (a *Appointment) Interval() (time.Time, time.Time, error) {
+	loc, err := LoadLocation(a.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	start, err := time.ParseInLocation(DateLayout+" "+ClockLayout, a.Date+" "+a.StartTime, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	end, err := time.ParseInLocation(DateLayout+" "+ClockLayout, a.Date+" "+a.EndTime, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return start, end, nil
+}
+
+// MarshalJSON adds the start and the end of the appointment as RFC 3339 timestamps with the
+// offset of the clinic's time zone, so that clients in other zones can render them correctly.
+func (a Appointment) MarshalJSON() ([]byte, error) {
+	// appointment has the fields but not the methods of Appointment, which keeps json.Marshal
+	// from calling MarshalJSON again.
+	type appointment Appointment
+
+	out := struct {
+		appointment
+		StartsAt *time.Time `json:"startsAt,omitempty"`
+		EndsAt   *time.Time `json:"endsAt,omitempty"`
+	}{appointment: appointment(a)}
+
+	if start, end, err := a.Interval(); err == nil {
+		out.StartsAt, out.EndsAt = &start, &end
+	}
+
+	return json.Marshal(out)
+}
+
+// CanTransition reports whether an appointment in the from status may move to the to status.
+func CanTransition(from, to string) bool {
+	for _, next := range appointmentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// codeExclusionViolation is the SQLSTATE PostgreSQL reports when an EXCLUDE constraint, such as
+// appointments_doctor_overlap or appointments_patient_overlap, is violated.
+const codeExclusionViolation = "23P01"
+
 func (m AppointmentModel) Insert(appointment *Appointment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertAppointment(ctx, tx, appointment)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertAppointment inserts the appointment using q, which must be a transaction: the lock
+// taken to check the holds lasts until it ends, and the appointment and the reservations of its
+// resources are stored together. An overlap with another appointment is reported as
+// ErrAppointmentConflict, one with a time-off of the doctor as ErrDoctorUnavailable, one with a
+// hold of the slot as ErrSlotHeld, one with a group session of the doctor as ErrGroupSession,
+// and an appointment outside of the opening hours of the clinic as ErrClinicClosed.
+func insertAppointment(ctx context.Context, q querier, appointment *Appointment) error {
+	err := checkHolds(ctx, q, appointment)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := findGroupSessions(ctx, q, appointment)
+	if err != nil {
+		return err
+	}
+	if len(sessions) > 0 {
+		return ErrGroupSession
+	}
+
+	timeOff, err := findTimeOff(ctx, q, appointment)
+	if err != nil {
+		return err
+	}
+	if len(timeOff) > 0 {
+		return ErrDoctorUnavailable
+	}
+
+	err = checkOpeningHours(ctx, q, appointment)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO appointments (patient_id, doctor_id, date, start_time, end_time, status) 
-		VALUES ($1, $2, $3, $4, $5, $6) 
+		INSERT INTO appointments (patient_id, doctor_id, date, start_time, end_time, status, series_id,
+			type_id, buffer_before, buffer_after, rescheduled_from, reschedule_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at, updated_at
 		`
 	args := []interface{}{
@@ -19,35 +220,118 @@ func (m AppointmentModel) Insert(appointment *Appointment) error {
 		appointment.StartTime,
 		appointment.EndTime,
 		appointment.Status,
+		appointment.SeriesId,
+		appointment.TypeID,
+		appointment.BufferBeforeMinutes,
+		appointment.BufferAfterMinutes,
+		appointment.RescheduledFrom,
+		appointment.RescheduleCount,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+	err = q.QueryRowContext(ctx, query, args...).Scan(
 		&appointment.Id,
 		&appointment.CreatedAt,
 		&appointment.UpdatedAt,
 	)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeExclusionViolation:
+			return ErrAppointmentConflict
+		default:
+			return err
+		}
+	}
+
+	if len(appointment.ResourceIDs) > 0 {
+		return reserveResources(ctx, q, appointment)
+	}
+
+	return nil
+}
+
+// AppointmentFilters holds the typed filters of an appointment search. Zero values match every
+// appointment. Dates are in YYYY-MM-DD format, and both ends of the range are inclusive.
+type AppointmentFilters struct {
+	PatientID   int64
+	DoctorID    int64
+	ClinicID    int64
+	Date        string
+	DateFrom    string
+	DateTo      string
+	Specialty   string
+	Statuses    []string
+	PatientName string
+}
+
+// ValidateAppointment checks the date and the times of day of the Appointment type.
+func ValidateAppointment(v *validator.Validator, appointment *Appointment) {
+	_, err := time.Parse(DateLayout, appointment.Date)
+	v.Check(err == nil, "date", "must be a date in YYYY-MM-DD format")
+	validateTimeRange(v, appointment.StartTime, appointment.EndTime)
+}
+
+// ValidateAppointmentFilters runs validation checks on the AppointmentFilters type.
+func ValidateAppointmentFilters(v *validator.Validator, search AppointmentFilters) {
+	v.Check(search.DateFrom == "" || search.DateTo == "" || search.DateFrom <= search.DateTo, "date_to", "must not be before date_from")
+	for _, status := range search.Statuses {
+		if _, ok := appointmentTransitions[status]; !ok {
+			v.AddError("status", "must be a comma-separated list of appointment statuses")
+			break
+		}
+	}
+	v.Check(len(search.Specialty) <= 200, "specialty", "must not be more than 200 bytes long")
+	v.Check(len(search.PatientName) <= 200, "patient_name", "must not be more than 200 bytes long")
 }
-func (m AppointmentModel) GetAll(patientId, doctorId, date, status string, filters Filters) ([]*Appointment, Metadata, error) {
+
+// GetAll returns the appointments matching the filters, limited to the ones within scope. Every
+// appointment comes with a summary of its doctor and patient.
+func (m AppointmentModel) GetAll(search AppointmentFilters, filters Filters, scope AccessScope) ([]*Appointment, Metadata, error) {
+	scopeCondition, scopeArgs := scope.appointmentCondition(12)
+
 	query := fmt.Sprintf(
 		`
-		SELECT count(*) OVER(), id,  created_at, updated_at, patient_id, doctor_id, date, start_time, end_time, status
+		SELECT count(*) OVER(), %s,
+			d.name, d.specialty, d.clinic_id, p.name, to_char(p.birthdate, 'YYYY-MM-DD')
 		FROM appointments
-		WHERE (patient_id::TEXT ILIKE $1 OR $1 = '')
-		AND (doctor_id::TEXT ILIKE $2 OR $2 = '')
-		AND (date::TEXT ILIKE $3 OR $3 = '')
-		AND (status ILIKE $4 OR $4 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $5 OFFSET $6
+		INNER JOIN doctors d ON d.id = appointments.doctor_id
+		INNER JOIN patients p ON p.id = appointments.patient_id
+		WHERE ($1 = 0 OR appointments.patient_id = $1)
+		AND ($2 = 0 OR appointments.doctor_id = $2)
+		AND ($3 = 0 OR d.clinic_id = $3)
+		AND ($4::DATE IS NULL OR appointments.date = $4::DATE)
+		AND ($5::DATE IS NULL OR appointments.date >= $5::DATE)
+		AND ($6::DATE IS NULL OR appointments.date <= $6::DATE)
+		AND ($7 = '' OR lower(d.specialty) = lower($7))
+		AND (cardinality($8::TEXT[]) = 0 OR appointments.status = ANY($8))
+		AND ($9 = '' OR p.name ILIKE '%%' || $9 || '%%')
+		AND %s
+		ORDER BY appointments.%s %s, appointments.id ASC
+		LIMIT $10 OFFSET $11
 		`,
-		filters.sortColumn(), filters.sortDirection())
+		appointmentColumns, scopeCondition, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{patientId, doctorId, date, status, filters.limit(), filters.offset()}
+	statuses := search.Statuses
+	if statuses == nil {
+		statuses = []string{}
+	}
+
+	args := []interface{}{
+		search.PatientID,
+		search.DoctorID,
+		search.ClinicID,
+		nullIfEmpty(search.Date),
+		nullIfEmpty(search.DateFrom),
+		nullIfEmpty(search.DateTo),
+		search.Specialty,
+		pq.Array(statuses),
+		escapeLike(search.PatientName),
+		filters.limit(),
+		filters.offset(),
+	}
+	args = append(args, scopeArgs...)
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -61,13 +345,23 @@ func (m AppointmentModel) GetAll(patientId, doctorId, date, status string, filte
 	}()
 
 	totalRecords := 0
-	var appointments []*Appointment
+	appointments := []*Appointment{}
 	for rows.Next() {
 		var appointment Appointment
-		err := rows.Scan(&totalRecords, &appointment.Id, &appointment.CreatedAt, &appointment.UpdatedAt, &appointment.PatientId, &appointment.DoctorId, &appointment.Date, &appointment.StartTime, &appointment.EndTime, &appointment.Status)
+		doctor := &DoctorSummary{}
+		patient := &PatientSummary{}
+
+		dest := append([]interface{}{&totalRecords}, appointment.scanDest()...)
+		dest = append(dest, &doctor.Name, &doctor.Specialty, &doctor.ClinicID, &patient.Name, &patient.Birthdate)
+
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+
+		doctor.ID, patient.ID = appointment.DoctorId, appointment.PatientId
+		appointment.Doctor, appointment.Patient = doctor, patient
+
 		appointments = append(appointments, &appointment)
 	}
 
@@ -80,17 +374,22 @@ func (m AppointmentModel) GetAll(patientId, doctorId, date, status string, filte
 	return appointments, metadata, nil
 }
 
+// nullIfEmpty returns nil for an empty string, so that it is passed to the database as NULL.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so that s only matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (m AppointmentModel) Get(id int) (*Appointment, error) {
 	query := `
-		SELECT id,
-			created_at,
-			updated_at,
-			patient_id,
-			doctor_id,
-			date,
-			start_time,
-			end_time,
-			status
+		SELECT ` + appointmentColumns + `
 		FROM appointments
 		WHERE id = $1
 	`
@@ -99,17 +398,7 @@ func (m AppointmentModel) Get(id int) (*Appointment, error) {
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&appointment.Id,
-		&appointment.CreatedAt,
-		&appointment.UpdatedAt,
-		&appointment.PatientId,
-		&appointment.DoctorId,
-		&appointment.Date,
-		&appointment.StartTime,
-		&appointment.EndTime,
-		&appointment.Status,
-	)
+	err := row.Scan(appointment.scanDest()...)
 
 	if err != nil {
 		return nil, err
@@ -120,13 +409,14 @@ func (m AppointmentModel) Get(id int) (*Appointment, error) {
 func (m AppointmentModel) Update(appointment *Appointment) error {
 	query := `
 		UPDATE appointments
-		SET patient_id = $1,
-			doctor_id  = $2,
-			date       = $3,
-			start_time = $4,
-			end_time   = $5,
-			status     = $6
-		WHERE id = $7
+		SET patient_id       = $1,
+			doctor_id        = $2,
+			date             = $3,
+			start_time       = $4,
+			end_time         = $5,
+			status           = $6,
+			reschedule_count = $7
+		WHERE id = $8
 		RETURNING updated_at
 		`
 	args := []interface{}{
@@ -136,13 +426,269 @@ func (m AppointmentModel) Update(appointment *Appointment) error {
 		appointment.StartTime,
 		appointment.EndTime,
 		appointment.Status,
+		appointment.RescheduleCount,
+		appointment.Id,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if appointment.Status != StatusCancelled {
+		err = checkHolds(ctx, tx, appointment)
+		if err != nil {
+			return err
+		}
+
+		sessions, err := findGroupSessions(ctx, tx, appointment)
+		if err != nil {
+			return err
+		}
+		if len(sessions) > 0 {
+			return ErrGroupSession
+		}
+
+		timeOff, err := findTimeOff(ctx, tx, appointment)
+		if err != nil {
+			return err
+		}
+		if len(timeOff) > 0 {
+			return ErrDoctorUnavailable
+		}
+	}
+
+	// Moving the appointment also moves its reservations, which may now overlap with others.
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&appointment.UpdatedAt)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeExclusionViolation:
+			return ErrAppointmentConflict
+		default:
+			return err
+		}
+	}
+
+	err = reserveResources(ctx, tx, appointment)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetConflicts returns the IDs of the appointments which occupy the time slot of the given
+// appointment, either for the same doctor, the same patient or one of its resources. For the
+// doctor, the buffers of both appointments count as occupied too. Cancelled appointments and the
+// appointment itself are ignored.
+func (m AppointmentModel) GetConflicts(appointment *Appointment) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return findConflicts(ctx, m.DB, appointment)
+}
+
+// findConflicts is GetConflicts for the connection pool or a transaction.
+func findConflicts(ctx context.Context, q querier, appointment *Appointment) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM appointments
+		WHERE id::TEXT <> $1
+		AND status <> $2
+		AND (
+			doctor_id::TEXT = $3
+			AND tsrange(
+				date + start_time - buffer_before * INTERVAL '1 minute',
+				date + end_time + buffer_after * INTERVAL '1 minute'
+			) && tsrange(
+				$5::DATE + $6::TIME - $9 * INTERVAL '1 minute',
+				$5::DATE + $7::TIME + $10 * INTERVAL '1 minute'
+			)
+			OR (
+				patient_id::TEXT = $4 OR id IN (
+					SELECT appointment_id FROM appointment_resources WHERE resource_id = ANY($8)
+				)
+			)
+			AND tsrange(date + start_time, date + end_time) && tsrange($5::DATE + $6::TIME, $5::DATE + $7::TIME)
+		)
+		ORDER BY id
+		`
+	args := []interface{}{
 		appointment.Id,
+		StatusCancelled,
+		appointment.DoctorId,
+		appointment.PatientId,
+		appointment.Date,
+		appointment.StartTime,
+		appointment.EndTime,
+		pq.Array(appointment.ResourceIDs),
+		appointment.BufferBeforeMinutes,
+		appointment.BufferAfterMinutes,
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// SetStatus moves the appointment to a new status and records which user did it, and when.
+// The update only goes through if the appointment still has the status it was read with, so
+// two concurrent transitions result in ErrEditConflict for the second one. A reason can be
+// given for cancellations, and is ignored for other statuses. Checked-in appointments get the
+// next queue number of their clinic for the day.
+func (m AppointmentModel) SetStatus(appointment *Appointment, status string, userID int64, reason string) error {
+	if !CanTransition(appointment.Status, status) {
+		return ErrInvalidTransition
+	}
+
+	prefix := statusColumns[status]
+
+	query := fmt.Sprintf(`
+		UPDATE appointments
+		SET status = $1, %[1]s_at = now(), %[1]s_by = $2, updated_at = now(),
+			cancellation_reason = CASE WHEN $1 = '%[2]s' THEN NULLIF($3, '') ELSE cancellation_reason END
+		WHERE id = $4 AND status = $5
+		RETURNING %[3]s
+		`, prefix, StatusCancelled, appointmentColumns)
+
+	args := []interface{}{status, userID, reason, appointment.Id, appointment.Status}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(appointment.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case pqErrorCode(err) == codeExclusionViolation:
+			return ErrAppointmentConflict
+		default:
+			return err
+		}
+	}
+
+	if status == StatusCheckedIn {
+		err = assignQueueNumber(ctx, tx, appointment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Reschedule moves a requested or confirmed appointment to the time of the replacement. The
+// original is cancelled and kept, and the replacement is booked as a new requested appointment
+// which links back to it and counts one more reschedule. Both happen in one transaction, so an
+// overlap or a closed clinic leaves the original untouched, and a concurrent change of the
+// original results in ErrEditConflict.
+func (m AppointmentModel) Reschedule(original, replacement *Appointment, userID int64) error {
+	if original.Status != StatusRequested && original.Status != StatusConfirmed {
+		return ErrInvalidTransition
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE appointments
+		SET status = $1, cancelled_at = now(), cancelled_by = $2, cancellation_reason = $3, updated_at = now()
+		WHERE id = $4 AND status = $5
+		RETURNING ` + appointmentColumns
+
+	args := []interface{}{StatusCancelled, userID, "rescheduled", original.Id, original.Status}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(original.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	id, _ := strconv.ParseInt(original.Id, 10, 64)
+	replacement.RescheduledFrom = &id
+	replacement.RescheduleCount = original.RescheduleCount + 1
+	replacement.Status = StatusRequested
+
+	err = insertAppointment(ctx, tx, replacement)
+	if err != nil {
+		return err
 	}
 
+	// Read the replacement back, so that it comes with the time zone of its clinic.
+	query = `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE id = $1
+		`
+
+	err = tx.QueryRowContext(ctx, query, replacement.Id).Scan(replacement.scanDest()...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRescheduleHistory returns the appointments the given one replaced, from the most recent to
+// the original booking.
+func (m AppointmentModel) GetRescheduleHistory(appointment *Appointment) ([]*Appointment, error) {
+	query := `
+		WITH RECURSIVE history (id, depth) AS (
+			SELECT rescheduled_from, 1 FROM appointments WHERE id = $1 AND rescheduled_from IS NOT NULL
+			UNION ALL
+			SELECT a.rescheduled_from, h.depth + 1
+			FROM appointments a
+			INNER JOIN history h ON h.id = a.id
+			WHERE a.rescheduled_from IS NOT NULL
+		)
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		INNER JOIN history ON history.id = appointments.id
+		ORDER BY history.depth
+		`
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&appointment.UpdatedAt)
+	return queryAppointments(ctx, m.DB, query, appointment.Id)
 }
 
 func (m AppointmentModel) Delete(id int) error {
@@ -157,56 +703,109 @@ func (m AppointmentModel) Delete(id int) error {
 	return err
 }
 
-func (m AppointmentModel) GetByDoctorID(doctorID int) ([]*Appointment, error) {
-    query := `SELECT id, doctor_id, patient_id, datetime FROM appointments WHERE doctor_id = $1`
+// GetBusySlots returns the time intervals taken by the doctor's appointments (with their
+// buffers), group sessions, time-offs, clinic holidays and holds, and by the reservations of the given resources,
+// between the from and to dates (both inclusive). Cancelled appointments do not occupy any time.
+func (m AppointmentModel) GetBusySlots(doctorID int64, resourceIDs []int64, from, to time.Time) ([]Slot, error) {
+	query := `
+		SELECT date + start_time - buffer_before * INTERVAL '1 minute',
+			date + end_time + buffer_after * INTERVAL '1 minute'
+		FROM appointments
+		WHERE doctor_id = $1
+		AND status <> $2
+		AND date BETWEEN $3::DATE AND $4::DATE
+		UNION ALL
+		SELECT starts_at, ends_at
+		FROM doctor_time_off
+		WHERE doctor_id = $1
+		AND starts_at < $4::DATE + 1
+		AND ends_at > $3::DATE
+		UNION ALL
+		SELECT h.date::TIMESTAMP, (h.date + 1)::TIMESTAMP
+		FROM clinic_holidays h
+		INNER JOIN doctors d ON d.clinic_id = h.clinic_id
+		WHERE d.id = $1
+		AND h.date BETWEEN $3::DATE AND $4::DATE
+		UNION ALL
+		SELECT lower(period), upper(period)
+		FROM appointment_resources
+		WHERE resource_id = ANY($5)
+		AND NOT cancelled
+		AND period && tsrange($3::DATE, $4::DATE + 1)
+		UNION ALL
+		SELECT date + start_time, date + end_time
+		FROM slot_holds
+		WHERE doctor_id = $1
+		AND expires_at > now()
+		AND date BETWEEN $3::DATE AND $4::DATE
+		UNION ALL
+		SELECT date + start_time, date + end_time
+		FROM group_sessions
+		WHERE doctor_id = $1
+		AND status <> $6
+		AND date BETWEEN $3::DATE AND $4::DATE
+		ORDER BY 1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{doctorID, StatusCancelled, from.Format(DateLayout), to.Format(DateLayout), pq.Array(resourceIDs), GroupSessionCancelled}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
 
-    rows, err := m.DB.Query(query, doctorID)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
 
-    var appointments []*Appointment
+	var slots []Slot
+	for rows.Next() {
+		var slot Slot
+		if err := rows.Scan(&slot.Start, &slot.End); err != nil {
+			return nil, err
+		}
+		slot.Start, slot.End = slot.Start.UTC(), slot.End.UTC()
+		slots = append(slots, slot)
+	}
 
-    for rows.Next() {
-        var appointment Appointment
-        err = rows.Scan(&appointment.Id, &appointment.DoctorId, &appointment.PatientId, &appointment.Date)
-        if err != nil {
-            return nil, err
-        }
-        appointments = append(appointments, &appointment)
-    }
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
-    if err = rows.Err(); err != nil {
-        return nil, err
-    }
+	return slots, nil
+}
 
-    return appointments, nil
+// GetByDoctorID returns all appointments of a doctor, in chronological order.
+func (m AppointmentModel) GetByDoctorID(doctorID int) ([]*Appointment, error) {
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE doctor_id = $1
+		ORDER BY date, start_time, id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryAppointments(ctx, m.DB, query, doctorID)
 }
 
+// GetByPatientID returns all appointments of a patient, in chronological order.
 func (m AppointmentModel) GetByPatientID(patientID int) ([]*Appointment, error) {
-    query := `SELECT id, doctor_id, patient_id, datetime FROM appointments WHERE patient_id = $1`
-
-    rows, err := m.DB.Query(query, patientID)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var appointments []*Appointment
-
-    for rows.Next() {
-        var appointment Appointment
-        err = rows.Scan(&appointment.Id, &appointment.DoctorId, &appointment.PatientId, &appointment.Date)
-        if err != nil {
-            return nil, err
-        }
-        appointments = append(appointments, &appointment)
-    }
-
-    if err = rows.Err(); err != nil {
-        return nil, err
-    }
-
-    return appointments, nil
-}
\ No newline at end of file
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE patient_id = $1
+		ORDER BY date, start_time, id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryAppointments(ctx, m.DB, query, patientID)
+}
@@ -0,0 +1,233 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// AppointmentType is an entry of the catalog of a clinic, such as an initial consultation or a
+// procedure. Appointments of the type last DurationMinutes, and keep the doctor busy for the
+// buffers before and after them. An empty Specialty means that any doctor can take it.
+type AppointmentType struct {
+	ID                  int64     `json:"id"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+	ClinicID            int64     `json:"clinicId"`
+	Name                string    `json:"name"`
+	DurationMinutes     int       `json:"durationMinutes"`
+	BufferBeforeMinutes int       `json:"bufferBeforeMinutes"`
+	BufferAfterMinutes  int       `json:"bufferAfterMinutes"`
+	Specialty           string    `json:"specialty"`
+	Preparation         string    `json:"preparation"`
+}
+
+type AppointmentTypeModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// appointmentTypeColumns lists the appointment_types columns in the order expected by scanDest.
+const appointmentTypeColumns = `
+	id, created_at, updated_at, clinic_id, name, duration_minutes, buffer_before_minutes,
+	buffer_after_minutes, specialty, preparation`
+
+func (t *AppointmentType) scanDest() []interface{} {
+	return []interface{}{
+		&t.ID, &t.CreatedAt, &t.UpdatedAt, &t.ClinicID, &t.Name, &t.DurationMinutes,
+		&t.BufferBeforeMinutes, &t.BufferAfterMinutes, &t.Specialty, &t.Preparation,
+	}
+}
+
+// ValidateAppointmentType runs validation checks on the AppointmentType type.
+func ValidateAppointmentType(v *validator.Validator, appointmentType *AppointmentType) {
+	v.Check(appointmentType.Name != "", "name", "must be provided")
+	v.Check(len(appointmentType.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(appointmentType.DurationMinutes > 0, "durationMinutes", "must be greater than zero")
+	v.Check(appointmentType.DurationMinutes <= 24*60, "durationMinutes", "must not be more than a day")
+	v.Check(appointmentType.BufferBeforeMinutes >= 0, "bufferBeforeMinutes", "must not be negative")
+	v.Check(appointmentType.BufferBeforeMinutes <= 240, "bufferBeforeMinutes", "must not be more than 4 hours")
+	v.Check(appointmentType.BufferAfterMinutes >= 0, "bufferAfterMinutes", "must not be negative")
+	v.Check(appointmentType.BufferAfterMinutes <= 240, "bufferAfterMinutes", "must not be more than 4 hours")
+	v.Check(len(appointmentType.Specialty) <= 200, "specialty", "must not be more than 200 bytes long")
+	v.Check(len(appointmentType.Preparation) <= 5000, "preparation", "must not be more than 5000 bytes long")
+}
+
+// EndTime returns the HH:MM end of an appointment of the type which starts at the HH:MM start.
+// ok is false when the appointment would not end on the same day.
+func (t *AppointmentType) EndTime(start string) (end string, ok bool) {
+	s, err := time.Parse(ClockLayout, start)
+	if err != nil {
+		return "", false
+	}
+
+	e := s.Add(time.Duration(t.DurationMinutes) * time.Minute)
+	if e.Day() != s.Day() {
+		return "", false
+	}
+
+	return e.Format(ClockLayout), true
+}
+
+// Allows reports whether a doctor with the specialty may take appointments of the type.
+func (t *AppointmentType) Allows(specialty string) bool {
+	return t.Specialty == "" || strings.EqualFold(t.Specialty, specialty)
+}
+
+func (m AppointmentTypeModel) Insert(appointmentType *AppointmentType) error {
+	query := `
+		INSERT INTO appointment_types (clinic_id, name, duration_minutes, buffer_before_minutes,
+			buffer_after_minutes, specialty, preparation)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+		`
+	args := []interface{}{
+		appointmentType.ClinicID,
+		appointmentType.Name,
+		appointmentType.DurationMinutes,
+		appointmentType.BufferBeforeMinutes,
+		appointmentType.BufferAfterMinutes,
+		appointmentType.Specialty,
+		appointmentType.Preparation,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&appointmentType.ID, &appointmentType.CreatedAt, &appointmentType.UpdatedAt)
+}
+
+// GetAllForClinic returns the appointment type catalog of the clinic.
+func (m AppointmentTypeModel) GetAllForClinic(clinicID int64) ([]*AppointmentType, error) {
+	query := `
+		SELECT ` + appointmentTypeColumns + `
+		FROM appointment_types
+		WHERE clinic_id = $1
+		ORDER BY name, id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, clinicID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	types := []*AppointmentType{}
+	for rows.Next() {
+		var appointmentType AppointmentType
+		if err := rows.Scan(appointmentType.scanDest()...); err != nil {
+			return nil, err
+		}
+		types = append(types, &appointmentType)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return types, nil
+}
+
+// Get returns the appointment type with the id, whichever clinic it belongs to.
+func (m AppointmentTypeModel) Get(id int64) (*AppointmentType, error) {
+	query := `
+		SELECT ` + appointmentTypeColumns + `
+		FROM appointment_types
+		WHERE id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var appointmentType AppointmentType
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(appointmentType.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &appointmentType, nil
+}
+
+// Update changes the appointment type. Appointments already booked keep their times and buffers.
+func (m AppointmentTypeModel) Update(appointmentType *AppointmentType) error {
+	query := `
+		UPDATE appointment_types
+		SET name = $1, duration_minutes = $2, buffer_before_minutes = $3, buffer_after_minutes = $4,
+			specialty = $5, preparation = $6, updated_at = now()
+		WHERE id = $7 AND clinic_id = $8
+		RETURNING updated_at
+		`
+	args := []interface{}{
+		appointmentType.Name,
+		appointmentType.DurationMinutes,
+		appointmentType.BufferBeforeMinutes,
+		appointmentType.BufferAfterMinutes,
+		appointmentType.Specialty,
+		appointmentType.Preparation,
+		appointmentType.ID,
+		appointmentType.ClinicID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&appointmentType.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the appointment type from the catalog of the clinic. Appointments of the type
+// are kept, without a type.
+func (m AppointmentTypeModel) Delete(clinicID, id int64) error {
+	query := `
+		DELETE FROM appointment_types
+		WHERE id = $1 AND clinic_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, clinicID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -17,11 +17,11 @@ type ClinicModel struct {
 
 func (m ClinicModel) Insert(clinic *Clinic) error {
 	query := `
-		INSERT INTO clinics (name, city, address) 
-		VALUES ($1, $2, $3) 
+		INSERT INTO clinics (name, city, address, timezone) 
+		VALUES ($1, $2, $3, $4) 
 		RETURNING id, created_at, updated_at
 		`
-	args := []interface{}{clinic.Name, clinic.City, clinic.Address}
+	args := []interface{}{clinic.Name, clinic.City, clinic.Address, clinic.Timezone}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -36,7 +36,7 @@ func (m ClinicModel) Insert(clinic *Clinic) error {
 func (m ClinicModel) GetAll(name, city string, filters Filters) ([]*Clinic, Metadata, error) {
 	query := fmt.Sprintf(
 		`
-		SELECT count(*) OVER(), id, created_at, updated_at, name, city, address
+		SELECT count(*) OVER(), id, created_at, updated_at, name, city, address, timezone
 		FROM clinics
 		WHERE (LOWER(name) = LOWER($1) OR $1 = '')
 		AND (LOWER(city) = LOWER($2) OR $2 = '')
@@ -66,7 +66,7 @@ func (m ClinicModel) GetAll(name, city string, filters Filters) ([]*Clinic, Meta
 
 	for rows.Next() {
 		var clinic Clinic
-		err := rows.Scan(&totalRecords, &clinic.Id, &clinic.CreatedAt, &clinic.UpdatedAt, &clinic.Name, &clinic.City, &clinic.Address)
+		err := rows.Scan(&totalRecords, &clinic.Id, &clinic.CreatedAt, &clinic.UpdatedAt, &clinic.Name, &clinic.City, &clinic.Address, &clinic.Timezone)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -85,7 +85,7 @@ func (m ClinicModel) GetAll(name, city string, filters Filters) ([]*Clinic, Meta
 
 func (m ClinicModel) Get(id int) (*Clinic, error) {
 	query := `
-		SELECT id, created_at, updated_at, name, city, address
+		SELECT id, created_at, updated_at, name, city, address, timezone
 		FROM clinics
 		WHERE id = $1
 		`
@@ -101,6 +101,7 @@ func (m ClinicModel) Get(id int) (*Clinic, error) {
 		&clinic.Name,
 		&clinic.City,
 		&clinic.Address,
+		&clinic.Timezone,
 	)
 
 	if err != nil {
@@ -113,14 +114,15 @@ func (m ClinicModel) Get(id int) (*Clinic, error) {
 func (m ClinicModel) Update(clinic *Clinic) error {
 	query := `
 		UPDATE clinics
-		SET name = $1, city = $2, address = $3
-		WHERE id = $4
+		SET name = $1, city = $2, address = $3, timezone = $4
+		WHERE id = $5
 		RETURNING updated_at
 		`
 	args := []interface{}{
 		clinic.Name,
 		clinic.City,
 		clinic.Address,
+		clinic.Timezone,
 		clinic.Id,
 	}
 
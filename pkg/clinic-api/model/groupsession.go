@@ -0,0 +1,754 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/lib/pq"
+)
+
+// The statuses of a group session.
+const (
+	GroupSessionScheduled = "scheduled"
+	GroupSessionCancelled = "cancelled"
+)
+
+// The statuses of a participant of a group session. Registered participants take one of the
+// places of the session, waitlisted ones get the next free place.
+const (
+	ParticipantRegistered = "registered"
+	ParticipantWaitlisted = "waitlisted"
+)
+
+// The attendance of a registered participant, once the session has started.
+const (
+	AttendanceAttended = "attended"
+	AttendanceNoShow   = "no_show"
+)
+
+var (
+	// ErrGroupSession is returned when an appointment, a hold or another group session overlaps
+	// with a group session of the doctor.
+	ErrGroupSession = errors.New("group session")
+
+	// ErrAlreadyParticipant is returned when a patient joins a session they already take part
+	// in, either registered or waitlisted.
+	ErrAlreadyParticipant = errors.New("already participant")
+
+	// ErrSessionClosed is returned when a cancelled or started session is joined or changed.
+	ErrSessionClosed = errors.New("session closed")
+
+	// ErrSessionNotStarted is returned when the attendance of a session is recorded before it
+	// starts.
+	ErrSessionNotStarted = errors.New("session not started")
+
+	// ErrCapacityTooLow is returned when the capacity of a session is reduced below the number of
+	// its registered participants.
+	ErrCapacityTooLow = errors.New("capacity too low")
+)
+
+// GroupSession is a session of one doctor with many patients, such as a prenatal class or a
+// vaccination day. It blocks the calendar of the doctor like an appointment does.
+type GroupSession struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	DoctorID    int64     `json:"doctorId"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Date        string    `json:"date"`
+	StartTime   string    `json:"startTime"`
+	EndTime     string    `json:"endTime"`
+	Capacity    int       `json:"capacity"`
+	Status      string    `json:"status"`
+	Registered  int       `json:"registered"`
+	Waitlisted  int       `json:"waitlisted"`
+
+	// started tells whether the session has started, by the clock of the database.
+	started bool
+}
+
+// GroupParticipant is a patient who takes part in a group session. Position is the place of a
+// waitlisted participant in the queue, starting from one.
+type GroupParticipant struct {
+	SessionID   int64     `json:"sessionId"`
+	PatientID   int64     `json:"patientId"`
+	PatientName string    `json:"patientName"`
+	Status      string    `json:"status"`
+	Attendance  *string   `json:"attendance"`
+	JoinedAt    time.Time `json:"joinedAt"`
+	Position    int       `json:"position,omitempty"`
+}
+
+// GroupSessionNotice holds what a message to a participant of a session needs.
+type GroupSessionNotice struct {
+	PatientID   int64
+	PatientName string
+	Email       string
+	Title       string
+	DoctorName  string
+	Date        string
+	StartTime   string
+}
+
+type GroupSessionModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// groupSessionColumns lists the group_sessions columns of s in the order expected by scanDest.
+var groupSessionColumns = `
+	s.id, s.created_at, s.updated_at, s.doctor_id, s.title, s.description,
+	to_char(s.date, 'YYYY-MM-DD'), to_char(s.start_time, 'HH24:MI'), to_char(s.end_time, 'HH24:MI'),
+	s.capacity, s.status,
+	(SELECT count(*) FROM group_session_participants p WHERE p.session_id = s.id AND p.status = 'registered'),
+	(SELECT count(*) FROM group_session_participants p WHERE p.session_id = s.id AND p.status = 'waitlisted'),
+	` + clinicTime("s.date", "s.start_time", "s.doctor_id") + ` <= now()`
+
+func (s *GroupSession) scanDest() []interface{} {
+	return []interface{}{
+		&s.ID, &s.CreatedAt, &s.UpdatedAt, &s.DoctorID, &s.Title, &s.Description,
+		&s.Date, &s.StartTime, &s.EndTime, &s.Capacity, &s.Status, &s.Registered, &s.Waitlisted, &s.started,
+	}
+}
+
+// slot returns the time of the session as an appointment without buffers, for the checks of the
+// calendar of the doctor.
+func (s *GroupSession) slot() *Appointment {
+	return &Appointment{
+		DoctorId:  strconv.FormatInt(s.DoctorID, 10),
+		Date:      s.Date,
+		StartTime: s.StartTime,
+		EndTime:   s.EndTime,
+	}
+}
+
+// ValidateGroupSession runs validation checks on the GroupSession type.
+func ValidateGroupSession(v *validator.Validator, session *GroupSession) {
+	v.Check(session.Title != "", "title", "must be provided")
+	v.Check(len(session.Title) <= 200, "title", "must not be more than 200 bytes long")
+	v.Check(len(session.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+	_, err := time.Parse(DateLayout, session.Date)
+	v.Check(err == nil, "date", "must be a date in YYYY-MM-DD format")
+	validateTimeRange(v, session.StartTime, session.EndTime)
+	v.Check(session.Capacity > 0, "capacity", "must be greater than zero")
+	v.Check(session.Capacity <= 1000, "capacity", "must not be more than 1000")
+}
+
+// ValidateAttendance runs validation checks on the attendance of a participant.
+func ValidateAttendance(v *validator.Validator, attendance string) {
+	v.Check(attendance == AttendanceAttended || attendance == AttendanceNoShow, "attendance", "must be either attended or no_show")
+}
+
+// findGroupSessions returns the IDs of the scheduled group sessions of the doctor which overlap
+// with the appointment, including its buffers.
+func findGroupSessions(ctx context.Context, q querier, appointment *Appointment) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM group_sessions
+		WHERE doctor_id::TEXT = $1
+		AND status <> $2
+		AND tsrange(date + start_time, date + end_time) && tsrange(
+			$3::DATE + $4::TIME - $6 * INTERVAL '1 minute',
+			$3::DATE + $5::TIME + $7 * INTERVAL '1 minute'
+		)
+		ORDER BY date, start_time
+		`
+	args := []interface{}{
+		appointment.DoctorId,
+		GroupSessionCancelled,
+		appointment.Date,
+		appointment.StartTime,
+		appointment.EndTime,
+		appointment.BufferBeforeMinutes,
+		appointment.BufferAfterMinutes,
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// checkSessionSlot locks the calendar of the doctor, and checks that the time of the session is
+// free: not on a time-off, within the opening hours of the clinic, and without appointments or
+// holds. Overlaps with other sessions are caught by the constraint of the table.
+func checkSessionSlot(ctx context.Context, q querier, session *GroupSession) error {
+	slot := session.slot()
+
+	err := lockDoctorSlots(ctx, q, slot.DoctorId)
+	if err != nil {
+		return err
+	}
+
+	timeOff, err := findTimeOff(ctx, q, slot)
+	if err != nil {
+		return err
+	}
+	if len(timeOff) > 0 {
+		return ErrDoctorUnavailable
+	}
+
+	err = checkOpeningHours(ctx, q, slot)
+	if err != nil {
+		return err
+	}
+
+	conflicts, err := findConflicts(ctx, q, slot)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return ErrAppointmentConflict
+	}
+
+	return checkHolds(ctx, q, slot)
+}
+
+// Insert schedules the session. An overlap with an appointment of the doctor is reported as
+// ErrAppointmentConflict, with another session as ErrGroupSession, with a hold as ErrSlotHeld,
+// with a time-off as ErrDoctorUnavailable, and a session outside the opening hours of the clinic
+// as ErrClinicClosed.
+func (m GroupSessionModel) Insert(session *GroupSession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkSessionSlot(ctx, tx, session)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO group_sessions (doctor_id, title, description, date, start_time, end_time, capacity)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at, status
+		`
+	args := []interface{}{
+		session.DoctorID,
+		session.Title,
+		session.Description,
+		session.Date,
+		session.StartTime,
+		session.EndTime,
+		session.Capacity,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.CreatedAt, &session.UpdatedAt, &session.Status)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeExclusionViolation:
+			return ErrGroupSession
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m GroupSessionModel) Get(id int64) (*GroupSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getGroupSession(ctx, m.DB, id, false)
+}
+
+func getGroupSession(ctx context.Context, q querier, id int64, forUpdate bool) (*GroupSession, error) {
+	query := `
+		SELECT ` + groupSessionColumns + `
+		FROM group_sessions s
+		WHERE s.id = $1
+		`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var session GroupSession
+
+	err := q.QueryRowContext(ctx, query, id).Scan(session.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+// GetAllForDoctor returns the sessions of the doctor which haven't ended yet, including the
+// cancelled ones.
+func (m GroupSessionModel) GetAllForDoctor(doctorID int64) ([]*GroupSession, error) {
+	query := `
+		SELECT ` + groupSessionColumns + `
+		FROM group_sessions s
+		WHERE s.doctor_id = $1 AND ` + clinicTime("s.date", "s.end_time", "s.doctor_id") + ` > now()
+		ORDER BY s.date, s.start_time, s.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	sessions := []*GroupSession{}
+	for rows.Next() {
+		var session GroupSession
+		if err := rows.Scan(session.scanDest()...); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Update saves the changes of a scheduled session which has not started yet. A new time is
+// checked like the time of a new session. Raising the capacity registers waitlisted participants
+// for the new places, and the IDs of their patients are returned. The capacity can not go below
+// the number of registered participants.
+func (m GroupSessionModel) Update(session *GroupSession) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := getGroupSession(ctx, tx, session.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !current.open() {
+		return nil, ErrSessionClosed
+	}
+
+	if session.Capacity < current.Registered {
+		return nil, ErrCapacityTooLow
+	}
+
+	if session.Date != current.Date || session.StartTime != current.StartTime || session.EndTime != current.EndTime {
+		err = checkSessionSlot(ctx, tx, session)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE group_sessions
+		SET title = $1, description = $2, date = $3, start_time = $4, end_time = $5, capacity = $6,
+			updated_at = now()
+		WHERE id = $7
+		`
+	args := []interface{}{
+		session.Title,
+		session.Description,
+		session.Date,
+		session.StartTime,
+		session.EndTime,
+		session.Capacity,
+		session.ID,
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeExclusionViolation:
+			return nil, ErrGroupSession
+		default:
+			return nil, err
+		}
+	}
+
+	promoted, err := promoteWaitlisted(ctx, tx, session.ID, session.Capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := getGroupSession(ctx, tx, session.ID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	*session = *updated
+
+	return promoted, nil
+}
+
+// Cancel cancels a scheduled session which has not started yet, which frees the calendar of the
+// doctor. The participants are kept, so that they can be told.
+func (m GroupSessionModel) Cancel(session *GroupSession) error {
+	query := `
+		UPDATE group_sessions
+		SET status = $1, updated_at = now()
+		WHERE id = $2 AND status = $3
+		AND ` + clinicTime("date", "start_time", "group_sessions.doctor_id") + ` > now()
+		RETURNING status, updated_at
+		`
+	args := []interface{}{GroupSessionCancelled, session.ID, GroupSessionScheduled}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&session.Status, &session.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrSessionClosed
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// open reports whether patients can still join or leave the session.
+func (s *GroupSession) open() bool {
+	return s.Status == GroupSessionScheduled && !s.started
+}
+
+// Join adds the patient to a scheduled session which has not started yet. The patient is
+// registered while there are free places, and waitlisted once the session is full.
+func (m GroupSessionModel) Join(sessionID, patientID int64) (*GroupParticipant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := getGroupSession(ctx, tx, sessionID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.open() {
+		return nil, ErrSessionClosed
+	}
+
+	participant := &GroupParticipant{
+		SessionID: sessionID,
+		PatientID: patientID,
+		Status:    ParticipantRegistered,
+	}
+	if session.Registered >= session.Capacity {
+		participant.Status = ParticipantWaitlisted
+		participant.Position = session.Waitlisted + 1
+	}
+
+	query := `
+		INSERT INTO group_session_participants (session_id, patient_id, status)
+		VALUES ($1, $2, $3)
+		RETURNING joined_at, (SELECT name FROM patients WHERE id = $2)
+		`
+	args := []interface{}{sessionID, patientID, participant.Status}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&participant.JoinedAt, &participant.PatientName)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeUniqueViolation:
+			return nil, ErrAlreadyParticipant
+		default:
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return participant, nil
+}
+
+// Leave removes the patient from a scheduled session which has not started yet. When a
+// registered participant leaves, the first waitlisted one takes the place, and the IDs of the
+// patients who were registered are returned.
+func (m GroupSessionModel) Leave(sessionID, patientID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := getGroupSession(ctx, tx, sessionID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.open() {
+		return nil, ErrSessionClosed
+	}
+
+	query := `
+		DELETE FROM group_session_participants
+		WHERE session_id = $1 AND patient_id = $2
+		`
+
+	result, err := tx.ExecContext(ctx, query, sessionID, patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	promoted, err := promoteWaitlisted(ctx, tx, sessionID, session.Capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return promoted, nil
+}
+
+// promoteWaitlisted registers waitlisted participants of the session, in the order they joined,
+// until the session is full. It returns the IDs of their patients.
+func promoteWaitlisted(ctx context.Context, q querier, sessionID int64, capacity int) ([]int64, error) {
+	query := `
+		UPDATE group_session_participants
+		SET status = $2
+		WHERE session_id = $1 AND patient_id IN (
+			SELECT patient_id
+			FROM group_session_participants
+			WHERE session_id = $1 AND status = $3
+			ORDER BY joined_at, patient_id
+			LIMIT GREATEST($4 - (
+				SELECT count(*) FROM group_session_participants WHERE session_id = $1 AND status = $2
+			), 0)
+		)
+		RETURNING patient_id
+		`
+	args := []interface{}{sessionID, ParticipantRegistered, ParticipantWaitlisted, capacity}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// SetAttendance records whether a registered participant turned up to a session which has
+// started. Waitlisted participants and unknown patients are reported as ErrRecordNotFound.
+func (m GroupSessionModel) SetAttendance(session *GroupSession, patientID int64, attendance string) (*GroupParticipant, error) {
+	if session.Status != GroupSessionScheduled {
+		return nil, ErrSessionClosed
+	}
+
+	query := `
+		UPDATE group_session_participants p
+		SET attendance = $3
+		FROM group_sessions s
+		WHERE p.session_id = $1 AND p.patient_id = $2 AND p.status = $4
+		AND s.id = p.session_id AND ` + clinicTime("s.date", "s.start_time", "s.doctor_id") + ` <= now()
+		RETURNING p.session_id, p.patient_id, (SELECT name FROM patients WHERE id = p.patient_id),
+			p.status, p.attendance, p.joined_at
+		`
+	args := []interface{}{session.ID, patientID, attendance, ParticipantRegistered}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var participant GroupParticipant
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&participant.SessionID,
+		&participant.PatientID,
+		&participant.PatientName,
+		&participant.Status,
+		&participant.Attendance,
+		&participant.JoinedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && session.open():
+			return nil, ErrSessionNotStarted
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &participant, nil
+}
+
+// GetParticipants returns the registered participants of the session, followed by the
+// waitlisted ones in the order they get the free places.
+func (m GroupSessionModel) GetParticipants(sessionID int64) ([]*GroupParticipant, error) {
+	query := `
+		SELECT g.session_id, g.patient_id, p.name, g.status, g.attendance, g.joined_at,
+			CASE WHEN g.status = $2
+				THEN row_number() OVER (PARTITION BY g.status ORDER BY g.joined_at, g.patient_id)
+				ELSE 0
+			END
+		FROM group_session_participants g
+		INNER JOIN patients p ON p.id = g.patient_id
+		WHERE g.session_id = $1
+		ORDER BY g.status = $2, g.joined_at, g.patient_id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, sessionID, ParticipantWaitlisted)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	participants := []*GroupParticipant{}
+	for rows.Next() {
+		var participant GroupParticipant
+		err := rows.Scan(
+			&participant.SessionID,
+			&participant.PatientID,
+			&participant.PatientName,
+			&participant.Status,
+			&participant.Attendance,
+			&participant.JoinedAt,
+			&participant.Position,
+		)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, &participant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
+
+// GetNotices returns what the messages to the given participants of the session need. Without
+// patient IDs, every participant is included.
+func (m GroupSessionModel) GetNotices(sessionID int64, patientIDs []int64) ([]*GroupSessionNotice, error) {
+	query := `
+		SELECT p.id, p.name, u.email, s.title, d.name,
+			to_char(s.date, 'YYYY-MM-DD'), to_char(s.start_time, 'HH24:MI')
+		FROM group_session_participants g
+		INNER JOIN group_sessions s ON s.id = g.session_id
+		INNER JOIN patients p ON p.id = g.patient_id
+		INNER JOIN users u ON u.id = p.user_id
+		INNER JOIN doctors d ON d.id = s.doctor_id
+		WHERE g.session_id = $1
+		AND (cardinality($2::BIGINT[]) = 0 OR g.patient_id = ANY($2))
+		ORDER BY p.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, sessionID, pq.Array(patientIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	var notices []*GroupSessionNotice
+	for rows.Next() {
+		var notice GroupSessionNotice
+		err := rows.Scan(
+			&notice.PatientID,
+			&notice.PatientName,
+			&notice.Email,
+			&notice.Title,
+			&notice.DoctorName,
+			&notice.Date,
+			&notice.StartTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, &notice)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notices, nil
+}
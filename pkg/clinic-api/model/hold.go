@@ -0,0 +1,358 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+var (
+	// ErrSlotHeld is returned when an appointment or a hold overlaps with a hold of another
+	// booking which has not expired yet.
+	ErrSlotHeld = errors.New("slot held")
+
+	// ErrHoldMismatch is returned when an appointment booked with a hold is not for the doctor
+	// and the time of the hold.
+	ErrHoldMismatch = errors.New("hold mismatch")
+
+	// ErrTooManyHolds is returned when a user who already holds MaxActiveHolds slots holds
+	// another one.
+	ErrTooManyHolds = errors.New("too many holds")
+)
+
+// MaxActiveHolds is how many slots a user can hold at the same time, so that nobody can block
+// the calendars of the doctors by holding slots over and over.
+const MaxActiveHolds = 3
+
+const (
+	// doctorSlotsLock is the class of the advisory locks taken on a doctor while checking
+	// appointments and holds against each other.
+	doctorSlotsLock = 1
+	// userHoldsLock is the class of the advisory locks taken on a user while counting their
+	// holds.
+	userHoldsLock = 2
+)
+
+// SlotHold keeps a slot of a doctor free for the user who holds it until it expires, so that
+// the slot can not be taken while the rest of the booking is filled in.
+type SlotHold struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	DoctorID  int64     `json:"doctorId"`
+	UserID    int64     `json:"userId"`
+	Date      string    `json:"date"`
+	StartTime string    `json:"startTime"`
+	EndTime   string    `json:"endTime"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type HoldModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// ValidateSlotHold runs validation checks on the SlotHold type.
+func ValidateSlotHold(v *validator.Validator, hold *SlotHold) {
+	_, err := time.Parse(DateLayout, hold.Date)
+	v.Check(err == nil, "date", "must be a date in YYYY-MM-DD format")
+	validateTimeRange(v, hold.StartTime, hold.EndTime)
+}
+
+// lockDoctorSlots serialises the transactions which book or hold time of the doctor, until the
+// transaction of q ends.
+func lockDoctorSlots(ctx context.Context, q querier, doctorID string) error {
+	_, err := q.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2::INTEGER)", doctorSlotsLock, doctorID)
+	return err
+}
+
+// checkHolds reports ErrSlotHeld when the appointment, with its buffers, overlaps with a hold
+// which has not expired. q must be a transaction, which keeps new holds of the doctor out until
+// it ends.
+func checkHolds(ctx context.Context, q querier, appointment *Appointment) error {
+	err := lockDoctorSlots(ctx, q, appointment.DoctorId)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM slot_holds
+			WHERE doctor_id = $1
+			AND expires_at > now()
+			AND tsrange(date + start_time, date + end_time) && tsrange(
+				$2::DATE + $3::TIME - $5 * INTERVAL '1 minute',
+				$2::DATE + $4::TIME + $6 * INTERVAL '1 minute'
+			)
+		)
+		`
+	args := []interface{}{
+		appointment.DoctorId,
+		appointment.Date,
+		appointment.StartTime,
+		appointment.EndTime,
+		appointment.BufferBeforeMinutes,
+		appointment.BufferAfterMinutes,
+	}
+
+	var held bool
+
+	err = q.QueryRowContext(ctx, query, args...).Scan(&held)
+	if err != nil {
+		return err
+	}
+
+	if held {
+		return ErrSlotHeld
+	}
+
+	return nil
+}
+
+// Insert holds the slot for ttl. The slot must be free: an overlap with an appointment of the
+// doctor is reported as ErrAppointmentConflict, with a time-off as ErrDoctorUnavailable, with the
+// opening hours of the clinic as ErrClinicClosed, with a group session as ErrGroupSession, and with
+// another hold as ErrSlotHeld.
+func (m HoldModel) Insert(hold *SlotHold, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The checks of the appointments see the hold as an appointment without buffers.
+	slot := &Appointment{
+		DoctorId:  strconv.FormatInt(hold.DoctorID, 10),
+		Date:      hold.Date,
+		StartTime: hold.StartTime,
+		EndTime:   hold.EndTime,
+	}
+
+	err = lockDoctorSlots(ctx, tx, slot.DoctorId)
+	if err != nil {
+		return err
+	}
+
+	timeOff, err := findTimeOff(ctx, tx, slot)
+	if err != nil {
+		return err
+	}
+	if len(timeOff) > 0 {
+		return ErrDoctorUnavailable
+	}
+
+	err = checkOpeningHours(ctx, tx, slot)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := findGroupSessions(ctx, tx, slot)
+	if err != nil {
+		return err
+	}
+	if len(sessions) > 0 {
+		return ErrGroupSession
+	}
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM appointments
+			WHERE doctor_id = $1
+			AND status <> $2
+			AND tsrange(
+				date + start_time - buffer_before * INTERVAL '1 minute',
+				date + end_time + buffer_after * INTERVAL '1 minute'
+			) && tsrange($3::DATE + $4::TIME, $3::DATE + $5::TIME)
+		)
+		`
+	args := []interface{}{hold.DoctorID, StatusCancelled, hold.Date, hold.StartTime, hold.EndTime}
+
+	var taken bool
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrAppointmentConflict
+	}
+
+	// Expired holds may not have been swept yet, and must not keep the slot from being held.
+	_, err = tx.ExecContext(ctx, "DELETE FROM slot_holds WHERE doctor_id = $1 AND expires_at <= now()", hold.DoctorID)
+	if err != nil {
+		return err
+	}
+
+	// The holds of the user can be for other doctors, whose locks are not taken.
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2::INTEGER)", userHoldsLock, hold.UserID)
+	if err != nil {
+		return err
+	}
+
+	var active int
+
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM slot_holds WHERE user_id = $1 AND expires_at > now()", hold.UserID).Scan(&active)
+	if err != nil {
+		return err
+	}
+	if active >= MaxActiveHolds {
+		return ErrTooManyHolds
+	}
+
+	query = `
+		INSERT INTO slot_holds (doctor_id, user_id, date, start_time, end_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5, now() + $6 * INTERVAL '1 second')
+		RETURNING id, created_at, expires_at
+		`
+	args = []interface{}{hold.DoctorID, hold.UserID, hold.Date, hold.StartTime, hold.EndTime, int64(ttl.Seconds())}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&hold.ID, &hold.CreatedAt, &hold.ExpiresAt)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeExclusionViolation:
+			return ErrSlotHeld
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Get returns the hold with the id, or ErrRecordNotFound when it does not exist or has expired.
+func (m HoldModel) Get(id int64) (*SlotHold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getHold(ctx, m.DB, id, false)
+}
+
+func getHold(ctx context.Context, q querier, id int64, forUpdate bool) (*SlotHold, error) {
+	query := `
+		SELECT id, created_at, doctor_id, user_id, to_char(date, 'YYYY-MM-DD'),
+			to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), expires_at
+		FROM slot_holds
+		WHERE id = $1 AND expires_at > now()
+		`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var hold SlotHold
+
+	err := q.QueryRowContext(ctx, query, id).Scan(
+		&hold.ID,
+		&hold.CreatedAt,
+		&hold.DoctorID,
+		&hold.UserID,
+		&hold.Date,
+		&hold.StartTime,
+		&hold.EndTime,
+		&hold.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &hold, nil
+}
+
+// Delete releases the hold.
+func (m HoldModel) Delete(id int64) error {
+	query := `
+		DELETE FROM slot_holds
+		WHERE id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired releases the holds which have expired, and returns how many there were.
+func (m HoldModel) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM slot_holds
+		WHERE expires_at <= now()
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// InsertWithHold books the appointment in the slot of the hold, and releases the hold in the
+// same transaction. Only the user of the hold can use it, and the appointment must be for the
+// doctor, the date and the times of the hold. An expired or unknown hold is reported as
+// ErrRecordNotFound, and a hold for another slot as ErrHoldMismatch. Otherwise the errors are
+// the ones of Insert.
+func (m AppointmentModel) InsertWithHold(appointment *Appointment, holdID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hold, err := getHold(ctx, tx, holdID, true)
+	if err != nil {
+		return err
+	}
+
+	if hold.UserID != userID {
+		return ErrRecordNotFound
+	}
+
+	if strconv.FormatInt(hold.DoctorID, 10) != appointment.DoctorId || hold.Date != appointment.Date ||
+		hold.StartTime != appointment.StartTime || hold.EndTime != appointment.EndTime {
+		return ErrHoldMismatch
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM slot_holds WHERE id = $1", hold.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertAppointment(ctx, tx, appointment)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,308 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// DefaultTimezone is the time zone of clinics created without one.
+const DefaultTimezone = "Asia/Almaty"
+
+// clinicTime returns the SQL expression which turns a date and a time of day, both local to the
+// clinic of the doctor, into an absolute time that can be compared with now(). The arguments are
+// SQL expressions, such as column names.
+func clinicTime(date, clock, doctorID string) string {
+	return fmt.Sprintf(`((%s + %s) AT TIME ZONE (
+		SELECT clinics.timezone FROM doctors INNER JOIN clinics ON clinics.id = doctors.clinic_id
+		WHERE doctors.id = %s
+	))`, date, clock, doctorID)
+}
+
+var (
+	// ErrClinicClosed is returned when an appointment falls outside the opening hours of the
+	// doctor's clinic, or on one of its holidays.
+	ErrClinicClosed = errors.New("clinic closed")
+
+	// ErrDuplicateHoliday is returned when a clinic already has a holiday on the date.
+	ErrDuplicateHoliday = errors.New("duplicate holiday")
+)
+
+// codeUniqueViolation is the SQLSTATE PostgreSQL reports when a UNIQUE constraint is violated.
+const codeUniqueViolation = "23505"
+
+// OpeningHours is a range of a weekday during which the clinic is open. Weekday 0 is Sunday.
+type OpeningHours struct {
+	Weekday   int    `json:"weekday"`
+	OpenTime  string `json:"openTime"`
+	CloseTime string `json:"closeTime"`
+}
+
+// ClinicHoliday is a day on which the clinic is closed.
+type ClinicHoliday struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	ClinicID  int64     `json:"clinicId"`
+	Date      string    `json:"date"`
+	Name      string    `json:"name"`
+}
+
+// locations caches the loaded time zones, since time.LoadLocation reads the zone database
+// every time it is called.
+var locations sync.Map
+
+// LoadLocation returns the time zone with the given IANA name, such as "Asia/Aqtobe".
+func LoadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// ValidateClinic runs validation checks on the Clinic type.
+func ValidateClinic(v *validator.Validator, clinic *Clinic) {
+	_, err := LoadLocation(clinic.Timezone)
+	v.Check(clinic.Timezone != "" && err == nil, "timezone", "must be an IANA time zone such as Asia/Almaty")
+}
+
+// ValidateOpeningHours runs validation checks on the weekly opening hours of a clinic.
+func ValidateOpeningHours(v *validator.Validator, hours []OpeningHours) {
+	for _, h := range hours {
+		v.Check(h.Weekday >= 0 && h.Weekday <= 6, "weekday", "must be between 0 (Sunday) and 6 (Saturday)")
+
+		open, errOpen := time.Parse(ClockLayout, h.OpenTime)
+		closing, errClose := time.Parse(ClockLayout, h.CloseTime)
+		v.Check(errOpen == nil, "openTime", "must be a time in HH:MM format")
+		v.Check(errClose == nil, "closeTime", "must be a time in HH:MM format")
+		if errOpen == nil && errClose == nil {
+			v.Check(open.Before(closing), "closeTime", "must be after openTime")
+		}
+	}
+}
+
+// ValidateHoliday runs validation checks on the ClinicHoliday type.
+func ValidateHoliday(v *validator.Validator, holiday *ClinicHoliday) {
+	_, err := time.Parse(DateLayout, holiday.Date)
+	v.Check(err == nil, "date", "must be a date in YYYY-MM-DD format")
+	v.Check(len(holiday.Name) <= 200, "name", "must not be more than 200 bytes long")
+}
+
+// SetOpeningHours replaces the weekly opening hours of the clinic. An empty list removes all
+// restrictions, so that the clinic is treated as always open.
+func (m ClinicModel) SetOpeningHours(clinicID int64, hours []OpeningHours) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM clinic_opening_hours WHERE clinic_id = $1`, clinicID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO clinic_opening_hours (clinic_id, weekday, open_time, close_time)
+		VALUES ($1, $2, $3, $4)
+		`
+	for _, h := range hours {
+		_, err = tx.ExecContext(ctx, query, clinicID, h.Weekday, h.OpenTime, h.CloseTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetOpeningHours returns the weekly opening hours of the clinic, ordered from Sunday.
+func (m ClinicModel) GetOpeningHours(clinicID int64) ([]OpeningHours, error) {
+	query := `
+		SELECT weekday, to_char(open_time, 'HH24:MI'), to_char(close_time, 'HH24:MI')
+		FROM clinic_opening_hours
+		WHERE clinic_id = $1
+		ORDER BY weekday, open_time
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, clinicID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	hours := []OpeningHours{}
+	for rows.Next() {
+		var h OpeningHours
+		if err := rows.Scan(&h.Weekday, &h.OpenTime, &h.CloseTime); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hours, nil
+}
+
+func (m ClinicModel) InsertHoliday(holiday *ClinicHoliday) error {
+	query := `
+		INSERT INTO clinic_holidays (clinic_id, date, name)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, holiday.ClinicID, holiday.Date, holiday.Name).Scan(&holiday.ID, &holiday.CreatedAt)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeUniqueViolation:
+			return ErrDuplicateHoliday
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetHolidays returns the holidays of the clinic between the from and to dates (both inclusive).
+func (m ClinicModel) GetHolidays(clinicID int64, from, to time.Time) ([]*ClinicHoliday, error) {
+	query := `
+		SELECT id, created_at, clinic_id, to_char(date, 'YYYY-MM-DD'), name
+		FROM clinic_holidays
+		WHERE clinic_id = $1 AND date BETWEEN $2::DATE AND $3::DATE
+		ORDER BY date
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, clinicID, from.Format(DateLayout), to.Format(DateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	holidays := []*ClinicHoliday{}
+	for rows.Next() {
+		var holiday ClinicHoliday
+		if err := rows.Scan(&holiday.ID, &holiday.CreatedAt, &holiday.ClinicID, &holiday.Date, &holiday.Name); err != nil {
+			return nil, err
+		}
+		holidays = append(holidays, &holiday)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return holidays, nil
+}
+
+func (m ClinicModel) DeleteHoliday(clinicID, id int64) error {
+	query := `
+		DELETE FROM clinic_holidays
+		WHERE id = $1 AND clinic_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, clinicID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CheckOpeningHours reports ErrClinicClosed when the appointment falls on a holiday of the
+// doctor's clinic, or outside of its opening hours.
+func (m AppointmentModel) CheckOpeningHours(appointment *Appointment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return checkOpeningHours(ctx, m.DB, appointment)
+}
+
+func checkOpeningHours(ctx context.Context, q querier, appointment *Appointment) error {
+	query := `
+		SELECT
+			EXISTS (
+				SELECT 1 FROM clinic_holidays h
+				WHERE h.clinic_id = d.clinic_id AND h.date = $2::DATE
+			),
+			NOT EXISTS (
+				SELECT 1 FROM clinic_opening_hours o WHERE o.clinic_id = d.clinic_id
+			) OR EXISTS (
+				SELECT 1 FROM clinic_opening_hours o
+				WHERE o.clinic_id = d.clinic_id
+				AND o.weekday = EXTRACT(DOW FROM $2::DATE)
+				AND o.open_time <= $3::TIME
+				AND o.close_time >= $4::TIME
+			)
+		FROM doctors d
+		WHERE d.id = $1
+		`
+	args := []interface{}{appointment.DoctorId, appointment.Date, appointment.StartTime, appointment.EndTime}
+
+	var holiday, open bool
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(&holiday, &open)
+	if err != nil {
+		switch {
+		// An unknown doctor is rejected by the foreign key of the appointment instead.
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if holiday || !open {
+		return ErrClinicClosed
+	}
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log"
 	"os"
+
+	"github.com/lib/pq"
 )
 
 type AppointmentModel struct {
@@ -21,6 +24,25 @@ var (
 	ErrEditConflict = errors.New("edit conflict")
 )
 
+// pqErrorCode returns the PostgreSQL SQLSTATE code of err, or an empty string if err did not
+// come from the database server. It lets us tell constraint violations apart without relying
+// on the (localized) error message.
+func pqErrorCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
+	}
+	return ""
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so that helpers can run their queries
+// either on their own or as a part of a bigger transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type Models struct {
 	Doctors      DoctorModel
 	Appointments AppointmentModel
@@ -29,6 +51,17 @@ type Models struct {
 	Tokens       TokenModel
 	Permissions  PermissionModel
 	Clinics      ClinicModel
+	Schedules    ScheduleModel
+	Series       SeriesModel
+	Waitlist     WaitlistModel
+	Reminders    ReminderModel
+	TimeOff      TimeOffModel
+	Resources    ResourceModel
+	Types        AppointmentTypeModel
+	Policies     PolicyModel
+	Holds        HoldModel
+	Sessions     GroupSessionModel
+	Roles        RoleModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -72,5 +105,60 @@ func NewModels(db *sql.DB) Models {
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
 		},
+		Schedules: ScheduleModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Series: SeriesModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Waitlist: WaitlistModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Reminders: ReminderModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		TimeOff: TimeOffModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Resources: ResourceModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Types: AppointmentTypeModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Policies: PolicyModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Holds: HoldModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Sessions: GroupSessionModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Roles: RoleModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
 	}
 }
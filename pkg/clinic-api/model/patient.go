@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -14,6 +15,23 @@ type PatientModel struct {
 	ErrorLog *log.Logger
 }
 
+// patientNoShowJoin counts the no-shows of every patient, and the appointments which are over
+// and which the patient either attended or not. patientNoShowColumns selects the counts in the
+// order of the NoShow fields of Patient.
+const (
+	patientNoShowJoin = `
+		LEFT JOIN LATERAL (
+			SELECT count(*) FILTER (WHERE status = '` + StatusNoShow + `') AS no_shows,
+				count(*) FILTER (WHERE status IN ('` + StatusCompleted + `', '` + StatusNoShow + `')) AS attended_or_not
+			FROM appointments
+			WHERE appointments.patient_id = patients.id
+		) no_show_stats ON true`
+
+	patientNoShowColumns = `no_show_stats.no_shows,
+		COALESCE(no_show_stats.no_shows::FLOAT8 / NULLIF(no_show_stats.attended_or_not, 0), 0),
+		patients.no_shows_cleared_at`
+)
+
 func (m PatientModel) Insert(patient *Patient) error {
 	query := `
 		INSERT INTO patients (name, birthdate, gender, user_id) 
@@ -39,22 +57,29 @@ func (m PatientModel) Insert(patient *Patient) error {
 	)
 }
 
-func (m PatientModel) GetAll(name, gender string, filters Filters) ([]*Patient, Metadata, error) {
+// GetAll returns the patients matching the filters, limited to the ones within scope.
+func (m PatientModel) GetAll(name, gender string, filters Filters, scope AccessScope) ([]*Patient, Metadata, error) {
+	scopeCondition, scopeArgs := scope.patientCondition(5)
+
 	query := fmt.Sprintf(
 		`
-		SELECT count(*) OVER(), id, created_at, updated_at, name, birthdate, gender
+		SELECT count(*) OVER(), id, created_at, updated_at, name, birthdate, gender,
+			%s
 		FROM patients
+		%s
 		WHERE (LOWER(name) = LOWER($1) OR $1 = '')
 		AND (gender = $2 OR $2 = '')
+		AND %s
 		ORDER BY %s %s, id ASC
 		LIMIT $3 OFFSET $4		
 		`,
-		filters.sortColumn(), filters.sortDirection())
+		patientNoShowColumns, patientNoShowJoin, scopeCondition, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	args := []interface{}{name, gender, filters.limit(), filters.offset()}
+	args = append(args, scopeArgs...)
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -71,7 +96,10 @@ func (m PatientModel) GetAll(name, gender string, filters Filters) ([]*Patient,
 	var patients []*Patient
 	for rows.Next() {
 		var patient Patient
-		err := rows.Scan(&totalRecords, &patient.Id, &patient.CreatedAt, &patient.UpdatedAt, &patient.Name, &patient.Birthdate, &patient.Gender)
+		err := rows.Scan(
+			&totalRecords, &patient.Id, &patient.CreatedAt, &patient.UpdatedAt, &patient.Name, &patient.Birthdate, &patient.Gender,
+			&patient.NoShowCount, &patient.NoShowRate, &patient.NoShowsClearedAt,
+		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -89,8 +117,9 @@ func (m PatientModel) GetAll(name, gender string, filters Filters) ([]*Patient,
 
 func (m PatientModel) Get(id int) (*Patient, error) {
 	query := `
-		SELECT id, created_at, updated_at, name, birthdate, gender
+		SELECT id, created_at, updated_at, name, birthdate, gender, ` + patientNoShowColumns + `
 		FROM patients
+		` + patientNoShowJoin + `
 		WHERE id = $1
 		`
 	var patient Patient
@@ -105,6 +134,9 @@ func (m PatientModel) Get(id int) (*Patient, error) {
 		&patient.Name,
 		&patient.Birthdate,
 		&patient.Gender,
+		&patient.NoShowCount,
+		&patient.NoShowRate,
+		&patient.NoShowsClearedAt,
 	)
 
 	if err != nil {
@@ -113,6 +145,26 @@ func (m PatientModel) Get(id int) (*Patient, error) {
 	return &patient, nil
 }
 
+// CanAccess reports whether the patient with the given ID is within scope. Doctors may access
+// the patients they have at least one appointment with.
+func (m PatientModel) CanAccess(id int, scope AccessScope) (bool, error) {
+	scopeCondition, scopeArgs := scope.patientCondition(2)
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM patients
+			WHERE id = $1 AND ` + scopeCondition + `
+		)
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ok bool
+	err := m.DB.QueryRowContext(ctx, query, append([]interface{}{id}, scopeArgs...)...).Scan(&ok)
+	return ok, err
+}
+
 func (m PatientModel) Update(patient *Patient) error {
 	query := `
 		UPDATE patients
@@ -144,3 +196,29 @@ func (m PatientModel) Delete(id int) error {
 	_, err := m.DB.ExecContext(ctx, query, id)
 	return err
 }
+
+// ClearNoShows lifts the booking restriction of the patient: the no-shows so far no longer count
+// towards the no-show limit of any clinic. They still count towards NoShowCount and NoShowRate.
+func (m PatientModel) ClearNoShows(patient *Patient) error {
+	query := `
+		UPDATE patients
+		SET no_shows_cleared_at = now()
+		WHERE id = $1
+		RETURNING no_shows_cleared_at
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, patient.Id).Scan(&patient.NoShowsClearedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,394 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/lib/pq"
+)
+
+// The actions on appointments which the policy of a clinic limits.
+const (
+	PolicyActionBook       = "book"
+	PolicyActionCancel     = "cancel"
+	PolicyActionReschedule = "reschedule"
+	PolicyActionDelete     = "delete"
+)
+
+// The rules of a clinic policy which an action may break.
+const (
+	RuleCancellationNotice = "cancellation_notice"
+	RuleRescheduleNotice   = "reschedule_notice"
+	RuleMaxReschedules     = "max_reschedules"
+	RuleBookingHorizon     = "booking_horizon"
+	RuleNoShowLimit        = "no_show_limit"
+	// RuleStarted is broken by changing an appointment which has already started, or is over.
+	RuleStarted = "started"
+)
+
+// ClinicPolicy holds the cancellation and rescheduling rules of a clinic. Appointments can be
+// cancelled and rescheduled until the notice before their start, rescheduled at most
+// MaxReschedules times, and booked at most BookingHorizonDays ahead. Patients with NoShowLimit
+// no-shows within NoShowWindowDays need staff to book for them. Nil limits are unlimited.
+type ClinicPolicy struct {
+	ClinicID                  int64      `json:"clinicId"`
+	CancellationNoticeMinutes int        `json:"cancellationNoticeMinutes"`
+	RescheduleNoticeMinutes   int        `json:"rescheduleNoticeMinutes"`
+	MaxReschedules            *int       `json:"maxReschedules"`
+	BookingHorizonDays        *int       `json:"bookingHorizonDays"`
+	NoShowLimit               *int       `json:"noShowLimit"`
+	NoShowWindowDays          int        `json:"noShowWindowDays"`
+	UpdatedAt                 *time.Time `json:"updatedAt,omitempty"`
+
+	// timezone is the time zone of the clinic, which the times of its appointments are local to.
+	timezone string
+}
+
+// PolicyViolation describes the rule of a clinic policy an action breaks.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyOverride records that a staff member broke a policy rule on purpose, and why.
+type PolicyOverride struct {
+	ID            int64     `json:"id"`
+	AppointmentID int64     `json:"appointmentId"`
+	UserID        *int64    `json:"userId"`
+	Action        string    `json:"action"`
+	Rule          string    `json:"rule"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// DefaultNoShowWindowDays is the period in which no-shows count towards the no-show limit of
+// clinics which have not set one.
+const DefaultNoShowWindowDays = 90
+
+type PolicyModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// ValidateClinicPolicy runs validation checks on the ClinicPolicy type.
+func ValidateClinicPolicy(v *validator.Validator, policy *ClinicPolicy) {
+	v.Check(policy.CancellationNoticeMinutes >= 0, "cancellationNoticeMinutes", "must not be negative")
+	v.Check(policy.CancellationNoticeMinutes <= 30*24*60, "cancellationNoticeMinutes", "must not be more than 30 days")
+	v.Check(policy.RescheduleNoticeMinutes >= 0, "rescheduleNoticeMinutes", "must not be negative")
+	v.Check(policy.RescheduleNoticeMinutes <= 30*24*60, "rescheduleNoticeMinutes", "must not be more than 30 days")
+	if policy.MaxReschedules != nil {
+		v.Check(*policy.MaxReschedules >= 0, "maxReschedules", "must not be negative")
+	}
+	if policy.BookingHorizonDays != nil {
+		v.Check(*policy.BookingHorizonDays > 0, "bookingHorizonDays", "must be greater than zero")
+		v.Check(*policy.BookingHorizonDays <= 5*365, "bookingHorizonDays", "must not be more than 5 years")
+	}
+	if policy.NoShowLimit != nil {
+		v.Check(*policy.NoShowLimit > 0, "noShowLimit", "must be greater than zero")
+	}
+	v.Check(policy.NoShowWindowDays > 0, "noShowWindowDays", "must be greater than zero")
+	v.Check(policy.NoShowWindowDays <= 5*365, "noShowWindowDays", "must not be more than 5 years")
+}
+
+// ValidateOverrideReason runs validation checks on the reason given for a policy override.
+func ValidateOverrideReason(v *validator.Validator, reason string) {
+	v.Check(len(reason) <= 500, "overrideReason", "must not be more than 500 bytes long")
+}
+
+// CheckBooking returns the rule broken by booking the appointment, or nil.
+func (p *ClinicPolicy) CheckBooking(appointment *Appointment, now time.Time) *PolicyViolation {
+	start, err := p.start(appointment)
+	if err != nil || p.BookingHorizonDays == nil {
+		return nil
+	}
+
+	if start.After(now.AddDate(0, 0, *p.BookingHorizonDays)) {
+		return &PolicyViolation{
+			Rule:    RuleBookingHorizon,
+			Message: fmt.Sprintf("appointments can be booked at most %d days ahead", *p.BookingHorizonDays),
+		}
+	}
+
+	return nil
+}
+
+// CheckCancel returns the rule broken by cancelling the appointment, or nil. Deleting an
+// appointment is held to the same rules.
+func (p *ClinicPolicy) CheckCancel(appointment *Appointment, now time.Time) *PolicyViolation {
+	return p.checkNotice(appointment, now, p.CancellationNoticeMinutes, RuleCancellationNotice, "cancelled")
+}
+
+// CheckReschedule returns the rule broken by moving the original appointment to the time of the
+// replacement, or nil.
+func (p *ClinicPolicy) CheckReschedule(original, replacement *Appointment, now time.Time) *PolicyViolation {
+	if violation := p.checkNotice(original, now, p.RescheduleNoticeMinutes, RuleRescheduleNotice, "rescheduled"); violation != nil {
+		return violation
+	}
+
+	if p.MaxReschedules != nil && original.RescheduleCount >= *p.MaxReschedules {
+		return &PolicyViolation{
+			Rule:    RuleMaxReschedules,
+			Message: fmt.Sprintf("appointments can be rescheduled at most %d times", *p.MaxReschedules),
+		}
+	}
+
+	return p.CheckBooking(replacement, now)
+}
+
+// checkNotice reports RuleStarted for appointments which have started, and the notice rule for
+// the ones which start in less than noticeMinutes.
+func (p *ClinicPolicy) checkNotice(appointment *Appointment, now time.Time, noticeMinutes int, rule, action string) *PolicyViolation {
+	start, err := p.start(appointment)
+	if err != nil {
+		return nil
+	}
+
+	if !start.After(now) {
+		return &PolicyViolation{
+			Rule:    RuleStarted,
+			Message: fmt.Sprintf("the appointment has already started and can not be %s", action),
+		}
+	}
+
+	if start.Sub(now) < time.Duration(noticeMinutes)*time.Minute {
+		return &PolicyViolation{
+			Rule:    rule,
+			Message: fmt.Sprintf("appointments can only be %s at least %d minutes before they start", action, noticeMinutes),
+		}
+	}
+
+	return nil
+}
+
+// start returns the start of the appointment as an instant in the time zone of the clinic.
+func (p *ClinicPolicy) start(appointment *Appointment) (time.Time, error) {
+	loc, err := LoadLocation(p.timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.ParseInLocation(DateLayout+" "+ClockLayout, appointment.Date+" "+appointment.StartTime, loc)
+}
+
+// GetForDoctor returns the policy of the clinic the doctor works at. Clinics which have not set
+// a policy get one without any limits.
+func (m PolicyModel) GetForDoctor(doctorID string) (*ClinicPolicy, error) {
+	query := `
+		SELECT c.id, c.timezone, COALESCE(p.cancellation_notice_minutes, 0),
+			COALESCE(p.reschedule_notice_minutes, 0), p.max_reschedules, p.booking_horizon_days,
+			p.no_show_limit, COALESCE(p.no_show_window_days, $2), p.updated_at
+		FROM doctors d
+		INNER JOIN clinics c ON c.id = d.clinic_id
+		LEFT JOIN clinic_policies p ON p.clinic_id = c.id
+		WHERE d.id::TEXT = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policy ClinicPolicy
+
+	err := m.DB.QueryRowContext(ctx, query, doctorID, DefaultNoShowWindowDays).Scan(
+		&policy.ClinicID,
+		&policy.timezone,
+		&policy.CancellationNoticeMinutes,
+		&policy.RescheduleNoticeMinutes,
+		&policy.MaxReschedules,
+		&policy.BookingHorizonDays,
+		&policy.NoShowLimit,
+		&policy.NoShowWindowDays,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &policy, nil
+}
+
+// Get returns the policy of the clinic, or one without any limits if it has not set one.
+func (m PolicyModel) Get(clinicID int64) (*ClinicPolicy, error) {
+	query := `
+		SELECT c.timezone, COALESCE(p.cancellation_notice_minutes, 0),
+			COALESCE(p.reschedule_notice_minutes, 0), p.max_reschedules, p.booking_horizon_days,
+			p.no_show_limit, COALESCE(p.no_show_window_days, $2), p.updated_at
+		FROM clinics c
+		LEFT JOIN clinic_policies p ON p.clinic_id = c.id
+		WHERE c.id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	policy := ClinicPolicy{ClinicID: clinicID}
+
+	err := m.DB.QueryRowContext(ctx, query, clinicID, DefaultNoShowWindowDays).Scan(
+		&policy.timezone,
+		&policy.CancellationNoticeMinutes,
+		&policy.RescheduleNoticeMinutes,
+		&policy.MaxReschedules,
+		&policy.BookingHorizonDays,
+		&policy.NoShowLimit,
+		&policy.NoShowWindowDays,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &policy, nil
+}
+
+// Set creates or replaces the policy of the clinic.
+func (m PolicyModel) Set(policy *ClinicPolicy) error {
+	query := `
+		INSERT INTO clinic_policies (clinic_id, cancellation_notice_minutes, reschedule_notice_minutes,
+			max_reschedules, booking_horizon_days, no_show_limit, no_show_window_days)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (clinic_id) DO UPDATE
+		SET cancellation_notice_minutes = EXCLUDED.cancellation_notice_minutes,
+			reschedule_notice_minutes = EXCLUDED.reschedule_notice_minutes,
+			max_reschedules = EXCLUDED.max_reschedules,
+			booking_horizon_days = EXCLUDED.booking_horizon_days,
+			no_show_limit = EXCLUDED.no_show_limit,
+			no_show_window_days = EXCLUDED.no_show_window_days,
+			updated_at = now()
+		RETURNING updated_at
+		`
+	args := []interface{}{
+		policy.ClinicID,
+		policy.CancellationNoticeMinutes,
+		policy.RescheduleNoticeMinutes,
+		policy.MaxReschedules,
+		policy.BookingHorizonDays,
+		policy.NoShowLimit,
+		policy.NoShowWindowDays,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&policy.UpdatedAt)
+}
+
+// CheckNoShows returns RuleNoShowLimit when the patient has reached the no-show limit of the
+// policy, or nil. No-shows at any clinic count, except the ones before the patient's no-shows
+// were last cleared.
+func (m PolicyModel) CheckNoShows(policy *ClinicPolicy, patientID string) (*PolicyViolation, error) {
+	if policy.NoShowLimit == nil {
+		return nil, nil
+	}
+
+	query := `
+		SELECT count(*)
+		FROM appointments a
+		INNER JOIN patients p ON p.id = a.patient_id
+		WHERE p.id::TEXT = $1
+		AND a.status = $2
+		AND a.no_show_at > now() - $3 * INTERVAL '1 day'
+		AND (p.no_shows_cleared_at IS NULL OR a.no_show_at > p.no_shows_cleared_at)
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, patientID, StatusNoShow, policy.NoShowWindowDays).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= *policy.NoShowLimit {
+		return &PolicyViolation{
+			Rule: RuleNoShowLimit,
+			Message: fmt.Sprintf(
+				"the patient did not turn up to %d appointments in the last %d days, so new bookings need staff approval",
+				count, policy.NoShowWindowDays,
+			),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// InsertOverride records a policy override.
+func (m PolicyModel) InsertOverride(override *PolicyOverride) error {
+	query := `
+		INSERT INTO appointment_policy_overrides (appointment_id, user_id, action, rule, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+		`
+	args := []interface{}{override.AppointmentID, override.UserID, override.Action, override.Rule, override.Reason}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&override.ID, &override.CreatedAt)
+}
+
+// GetOverrides returns the policy overrides of the appointments with the IDs, oldest first.
+func (m PolicyModel) GetOverrides(appointmentIDs []int64) ([]*PolicyOverride, error) {
+	query := `
+		SELECT id, appointment_id, user_id, action, rule, reason, created_at
+		FROM appointment_policy_overrides
+		WHERE appointment_id = ANY($1)
+		ORDER BY created_at, id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(appointmentIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	overrides := []*PolicyOverride{}
+	for rows.Next() {
+		var override PolicyOverride
+
+		err := rows.Scan(
+			&override.ID,
+			&override.AppointmentID,
+			&override.UserID,
+			&override.Action,
+			&override.Rule,
+			&override.Reason,
+			&override.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		overrides = append(overrides, &override)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
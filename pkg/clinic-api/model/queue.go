@@ -0,0 +1,149 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// QueueEntry is a checked-in patient in the waiting room, or one who is being seen.
+type QueueEntry struct {
+	AppointmentID int64      `json:"appointmentId"`
+	QueueNumber   int        `json:"queueNumber"`
+	PatientID     int64      `json:"patientId"`
+	PatientName   string     `json:"patientName"`
+	Status        string     `json:"status"`
+	StartTime     string     `json:"startTime"`
+	CheckedInAt   time.Time  `json:"checkedInAt"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	// WaitSeconds is how long the patient has waited so far, or waited in total once called.
+	WaitSeconds int `json:"waitSeconds"`
+}
+
+// DoctorQueue is the part of the waiting room queue of a clinic which waits for one doctor.
+type DoctorQueue struct {
+	DoctorID   int64        `json:"doctorId"`
+	DoctorName string       `json:"doctorName"`
+	Entries    []QueueEntry `json:"entries"`
+}
+
+// assignQueueNumber hands out the next queue number of the appointment's clinic for its date.
+// The counter row is locked by the upsert, so concurrent check-ins never get the same number.
+func assignQueueNumber(ctx context.Context, q querier, appointment *Appointment) error {
+	query := `
+		WITH counter AS (
+			INSERT INTO appointment_queue_counters (clinic_id, date, last_number)
+			SELECT d.clinic_id, a.date, 1
+			FROM appointments a
+			INNER JOIN doctors d ON d.id = a.doctor_id
+			WHERE a.id = $1
+			ON CONFLICT (clinic_id, date)
+			DO UPDATE SET last_number = appointment_queue_counters.last_number + 1
+			RETURNING last_number
+		)
+		UPDATE appointments
+		SET queue_number = (SELECT last_number FROM counter)
+		WHERE id = $1
+		RETURNING queue_number
+		`
+
+	return q.QueryRowContext(ctx, query, appointment.Id).Scan(&appointment.QueueNumber)
+}
+
+// GetQueue returns the patients of the clinic who are checked in or being seen on the date,
+// grouped by doctor and ordered by their queue number. Unless the scope covers every record, only
+// the queue of the doctor of the scope is returned.
+func (m AppointmentModel) GetQueue(clinicID int64, date time.Time, scope AccessScope) ([]*DoctorQueue, error) {
+	query := `
+		SELECT d.id, d.name, a.id, a.queue_number, p.id, p.name, a.status,
+			to_char(a.start_time, 'HH24:MI'), a.checked_in_at, a.started_at,
+			COALESCE(a.wait_seconds, EXTRACT(EPOCH FROM now() - a.checked_in_at)::INTEGER)
+		FROM appointments a
+		INNER JOIN doctors d ON d.id = a.doctor_id
+		INNER JOIN patients p ON p.id = a.patient_id
+		WHERE d.clinic_id = $1
+		AND a.date = $2::DATE
+		AND a.status IN ($3, $4)
+		AND a.queue_number IS NOT NULL
+		AND ($5 OR d.id = $6)
+		ORDER BY d.name, d.id, a.queue_number
+		`
+	args := []interface{}{clinicID, date.Format(DateLayout), StatusCheckedIn, StatusInProgress, scope.All, scope.DoctorID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	queues := []*DoctorQueue{}
+	for rows.Next() {
+		var (
+			doctorID   int64
+			doctorName string
+			entry      QueueEntry
+		)
+
+		err := rows.Scan(
+			&doctorID, &doctorName, &entry.AppointmentID, &entry.QueueNumber, &entry.PatientID,
+			&entry.PatientName, &entry.Status, &entry.StartTime, &entry.CheckedInAt, &entry.StartedAt,
+			&entry.WaitSeconds,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(queues) == 0 || queues[len(queues)-1].DoctorID != doctorID {
+			queues = append(queues, &DoctorQueue{DoctorID: doctorID, DoctorName: doctorName})
+		}
+		queue := queues[len(queues)-1]
+		queue.Entries = append(queue.Entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return queues, nil
+}
+
+// NextInQueue returns the checked-in appointment of the doctor on the date with the lowest queue
+// number, or ErrRecordNotFound when nobody is waiting.
+func (m AppointmentModel) NextInQueue(doctorID int64, date time.Time) (*Appointment, error) {
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE doctor_id = $1
+		AND date = $2::DATE
+		AND status = $3
+		AND queue_number IS NOT NULL
+		ORDER BY queue_number
+		LIMIT 1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var appointment Appointment
+
+	err := m.DB.QueryRowContext(ctx, query, doctorID, date.Format(DateLayout), StatusCheckedIn).Scan(appointment.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &appointment, nil
+}
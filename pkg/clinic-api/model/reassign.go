@@ -0,0 +1,284 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+// The reasons why an appointment could not be reassigned.
+const (
+	// ReassignNoDoctor means that no other doctor of the clinic has the specialty, or may take
+	// appointments of the type.
+	ReassignNoDoctor = "no_doctor"
+	// ReassignTimeOff means that the target doctor is on time-off.
+	ReassignTimeOff = "time_off"
+	// ReassignConflict means that the target doctor is busy with other appointments or a group
+	// session, or the slot is held for another booking.
+	ReassignConflict = "conflict"
+	// ReassignNoFreeDoctor means that every doctor of the specialty is either busy or on time-off.
+	ReassignNoFreeDoctor = "no_free_doctor"
+)
+
+// Reassignment moves the upcoming appointments of a doctor between two dates, both inclusive,
+// to a colleague. ToDoctorID picks the colleague, and zero lets every appointment go to the
+// least busy doctor of the same specialty in the clinic who is free at the time.
+type Reassignment struct {
+	FromDoctorID int64
+	ToDoctorID   int64
+	DateFrom     string
+	DateTo       string
+}
+
+// MovedAppointment is an appointment which was reassigned.
+type MovedAppointment struct {
+	AppointmentID int64  `json:"appointmentId"`
+	PatientID     int64  `json:"patientId"`
+	ToDoctorID    int64  `json:"toDoctorId"`
+	Date          string `json:"date"`
+	StartTime     string `json:"startTime"`
+	EndTime       string `json:"endTime"`
+}
+
+// UnmovableAppointment is an appointment which stays with its doctor, with the reason why.
+type UnmovableAppointment struct {
+	AppointmentID int64   `json:"appointmentId"`
+	PatientID     int64   `json:"patientId"`
+	Date          string  `json:"date"`
+	StartTime     string  `json:"startTime"`
+	EndTime       string  `json:"endTime"`
+	Reason        string  `json:"reason"`
+	Conflicts     []int64 `json:"conflicts,omitempty"`
+	TimeOff       []int64 `json:"timeOff,omitempty"`
+}
+
+// ReassignmentReport lists the outcome of a reassignment for every appointment it covered.
+type ReassignmentReport struct {
+	Moved     []MovedAppointment     `json:"moved"`
+	Unmovable []UnmovableAppointment `json:"unmovable"`
+}
+
+// ValidateReassignment runs validation checks on the Reassignment type.
+func ValidateReassignment(v *validator.Validator, reassignment *Reassignment) {
+	from, errFrom := time.Parse(DateLayout, reassignment.DateFrom)
+	to, errTo := time.Parse(DateLayout, reassignment.DateTo)
+
+	v.Check(errFrom == nil, "dateFrom", "must be a date in YYYY-MM-DD format")
+	v.Check(errTo == nil, "dateTo", "must be a date in YYYY-MM-DD format")
+	if errFrom == nil && errTo == nil {
+		v.Check(!to.Before(from), "dateTo", "must not be before dateFrom")
+		v.Check(to.Sub(from) <= 366*24*time.Hour, "dateTo", "must not be more than a year after dateFrom")
+	}
+	v.Check(reassignment.ToDoctorID != reassignment.FromDoctorID, "toDoctorId", "must be another doctor")
+}
+
+// Reassign moves the requested and confirmed appointments of the doctor which have not started
+// yet. Everything runs in a single transaction: the appointments are locked, and each one is
+// tried with the candidate doctors in turn until one of them is free at the time. The ones no
+// candidate can take stay with their doctor, and are reported as unmovable.
+func (m AppointmentModel) Reassign(reassignment *Reassignment) (*ReassignmentReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE doctor_id = $1
+		AND date BETWEEN $2::DATE AND $3::DATE
+		AND status IN ($4, $5)
+		AND ` + clinicTime("date", "start_time", "doctor_id") + ` > now()
+		ORDER BY date, start_time, id
+		FOR UPDATE
+		`
+	args := []interface{}{
+		reassignment.FromDoctorID,
+		reassignment.DateFrom,
+		reassignment.DateTo,
+		StatusRequested,
+		StatusConfirmed,
+	}
+
+	appointments, err := queryAppointments(ctx, tx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReassignmentReport{Moved: []MovedAppointment{}, Unmovable: []UnmovableAppointment{}}
+
+	for _, appointment := range appointments {
+		id, _ := strconv.ParseInt(appointment.Id, 10, 64)
+		patientID, _ := strconv.ParseInt(appointment.PatientId, 10, 64)
+
+		candidates, err := reassignCandidates(ctx, tx, reassignment, appointment)
+		if err != nil {
+			return nil, err
+		}
+
+		unmovable := UnmovableAppointment{
+			AppointmentID: id,
+			PatientID:     patientID,
+			Date:          appointment.Date,
+			StartTime:     appointment.StartTime,
+			EndTime:       appointment.EndTime,
+			Reason:        ReassignNoDoctor,
+		}
+
+		moved := false
+		for _, candidate := range candidates {
+			unmovable.Reason, unmovable.Conflicts, unmovable.TimeOff, err = moveAppointment(ctx, tx, appointment, candidate)
+			if err != nil {
+				return nil, err
+			}
+
+			if unmovable.Reason == "" {
+				report.Moved = append(report.Moved, MovedAppointment{
+					AppointmentID: id,
+					PatientID:     patientID,
+					ToDoctorID:    candidate,
+					Date:          appointment.Date,
+					StartTime:     appointment.StartTime,
+					EndTime:       appointment.EndTime,
+				})
+				moved = true
+				break
+			}
+		}
+
+		if !moved {
+			// The details of a failure only help when there was a single doctor to try.
+			if len(candidates) > 1 {
+				unmovable.Reason, unmovable.Conflicts, unmovable.TimeOff = ReassignNoFreeDoctor, nil, nil
+			}
+			report.Unmovable = append(report.Unmovable, unmovable)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// reassignCandidates returns the doctors the appointment may be moved to, the least busy on the
+// day of the appointment first. They work at the clinic of the original doctor and must be
+// allowed to take appointments of its type.
+func reassignCandidates(ctx context.Context, q querier, reassignment *Reassignment, appointment *Appointment) ([]int64, error) {
+	query := `
+		SELECT d.id
+		FROM doctors d
+		INNER JOIN doctors s ON s.id = $1
+		WHERE d.id <> s.id
+		AND d.clinic_id = s.clinic_id
+		AND ($2 = 0 AND lower(d.specialty) = lower(s.specialty) OR d.id = $2)
+		AND NOT EXISTS (
+			SELECT 1 FROM appointment_types t
+			WHERE t.id = $3 AND t.specialty <> '' AND lower(t.specialty) <> lower(d.specialty)
+		)
+		ORDER BY (
+			SELECT count(*) FROM appointments a
+			WHERE a.doctor_id = d.id AND a.date = $4::DATE AND a.status <> $5
+		), d.id
+		`
+	args := []interface{}{
+		reassignment.FromDoctorID,
+		reassignment.ToDoctorID,
+		appointment.TypeID,
+		appointment.Date,
+		StatusCancelled,
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// moveAppointment gives the appointment to the doctor, unless the doctor is on time-off or busy
+// at the time. It returns the reason why the appointment could not be moved, with the
+// time-offs or appointments in the way, and an empty reason once it is moved. The update runs
+// in a savepoint, so that an overlap does not abort the transaction of q.
+func moveAppointment(ctx context.Context, q querier, appointment *Appointment, doctorID int64) (string, []int64, []int64, error) {
+	original := appointment.DoctorId
+	appointment.DoctorId = strconv.FormatInt(doctorID, 10)
+
+	timeOff, err := findTimeOff(ctx, q, appointment)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(timeOff) > 0 {
+		appointment.DoctorId = original
+		return ReassignTimeOff, nil, timeOff, nil
+	}
+
+	err = checkHolds(ctx, q, appointment)
+	if err != nil {
+		appointment.DoctorId = original
+		if errors.Is(err, ErrSlotHeld) {
+			return ReassignConflict, nil, nil, nil
+		}
+		return "", nil, nil, err
+	}
+
+	sessions, err := findGroupSessions(ctx, q, appointment)
+	if err != nil {
+		appointment.DoctorId = original
+		return "", nil, nil, err
+	}
+	if len(sessions) > 0 {
+		appointment.DoctorId = original
+		return ReassignConflict, nil, nil, nil
+	}
+
+	if _, err := q.ExecContext(ctx, "SAVEPOINT reassignment"); err != nil {
+		return "", nil, nil, err
+	}
+
+	query := `
+		UPDATE appointments
+		SET doctor_id = $1, updated_at = now()
+		WHERE id = $2
+		RETURNING ` + appointmentColumns
+
+	err = q.QueryRowContext(ctx, query, doctorID, appointment.Id).Scan(appointment.scanDest()...)
+	if err != nil {
+		if pqErrorCode(err) != codeExclusionViolation {
+			return "", nil, nil, err
+		}
+
+		if _, err := q.ExecContext(ctx, "ROLLBACK TO SAVEPOINT reassignment"); err != nil {
+			return "", nil, nil, err
+		}
+
+		conflicts, err := findConflicts(ctx, q, appointment)
+		appointment.DoctorId = original
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		return ReassignConflict, conflicts, nil, nil
+	}
+
+	return "", nil, nil, nil
+}
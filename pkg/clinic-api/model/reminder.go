@@ -0,0 +1,201 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reminder is an upcoming appointment which is due for a reminder, with everything needed to
+// write the message to the patient.
+type Reminder struct {
+	AppointmentID int64
+	Lead          time.Duration
+	PatientName   string
+	Email         string
+	DoctorName    string
+	Specialty     string
+	Date          string
+	StartTime     string
+	// Preparation holds the instructions of the appointment type, if the appointment has one.
+	Preparation string
+}
+
+type ReminderModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// GetDue returns the requested and confirmed appointments which start more than after, but at
+// most lead from now in the time zone of their clinic, and have not had the lead reminder sent
+// yet. Passing the next shorter lead as after keeps an appointment booked at short notice from
+// getting every reminder at once.
+func (m ReminderModel) GetDue(lead, after time.Duration) ([]*Reminder, error) {
+	query := `
+		SELECT a.id, p.name, u.email, d.name, d.specialty,
+			to_char(a.date, 'YYYY-MM-DD'), to_char(a.start_time, 'HH24:MI'),
+			COALESCE(t.preparation, '')
+		FROM appointments a
+		INNER JOIN patients p ON p.id = a.patient_id
+		INNER JOIN users u ON u.id = p.user_id
+		INNER JOIN doctors d ON d.id = a.doctor_id
+		INNER JOIN clinics c ON c.id = d.clinic_id
+		LEFT JOIN appointment_types t ON t.id = a.type_id
+		WHERE a.status IN ('requested', 'confirmed')
+		AND (a.date + a.start_time) AT TIME ZONE c.timezone > now() + $2 * INTERVAL '1 second'
+		AND (a.date + a.start_time) AT TIME ZONE c.timezone <= now() + $1 * INTERVAL '1 second'
+		AND NOT EXISTS (
+			SELECT 1 FROM appointment_reminders r
+			WHERE r.appointment_id = a.id AND r.lead_seconds = $1
+		)
+		ORDER BY a.date, a.start_time, a.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, int64(lead.Seconds()), int64(after.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	var reminders []*Reminder
+	for rows.Next() {
+		reminder := Reminder{Lead: lead}
+
+		err := rows.Scan(
+			&reminder.AppointmentID,
+			&reminder.PatientName,
+			&reminder.Email,
+			&reminder.DoctorName,
+			&reminder.Specialty,
+			&reminder.Date,
+			&reminder.StartTime,
+			&reminder.Preparation,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reminders = append(reminders, &reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// GetForAppointments returns the details needed to write a message to the patients of the
+// appointments with the IDs, such as a notice that the appointment was moved. Patients without a
+// user account are left out, as there is nowhere to send the message to.
+func (m ReminderModel) GetForAppointments(ids []int64) ([]*Reminder, error) {
+	query := `
+		SELECT a.id, p.name, u.email, d.name, d.specialty,
+			to_char(a.date, 'YYYY-MM-DD'), to_char(a.start_time, 'HH24:MI'),
+			COALESCE(t.preparation, '')
+		FROM appointments a
+		INNER JOIN patients p ON p.id = a.patient_id
+		INNER JOIN users u ON u.id = p.user_id
+		INNER JOIN doctors d ON d.id = a.doctor_id
+		LEFT JOIN appointment_types t ON t.id = a.type_id
+		WHERE a.id = ANY($1)
+		ORDER BY a.date, a.start_time, a.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	var reminders []*Reminder
+	for rows.Next() {
+		var reminder Reminder
+
+		err := rows.Scan(
+			&reminder.AppointmentID,
+			&reminder.PatientName,
+			&reminder.Email,
+			&reminder.DoctorName,
+			&reminder.Specialty,
+			&reminder.Date,
+			&reminder.StartTime,
+			&reminder.Preparation,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reminders = append(reminders, &reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// Claim records that the reminder is being sent, and reports whether it was not claimed before.
+// Only the caller which claimed a reminder sends it, so that several instances of the API never
+// send the same reminder twice.
+func (m ReminderModel) Claim(reminder *Reminder) (bool, error) {
+	query := `
+		INSERT INTO appointment_reminders (appointment_id, lead_seconds)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING appointment_id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+
+	err := m.DB.QueryRowContext(ctx, query, reminder.AppointmentID, int64(reminder.Lead.Seconds())).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Release gives up the claim of a reminder which could not be sent, so that it is tried again.
+func (m ReminderModel) Release(reminder *Reminder) error {
+	query := `
+		DELETE FROM appointment_reminders
+		WHERE appointment_id = $1 AND lead_seconds = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reminder.AppointmentID, int64(reminder.Lead.Seconds()))
+	return err
+}
@@ -0,0 +1,356 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/lib/pq"
+)
+
+// The kinds of resources a clinic can have.
+const (
+	ResourceRoom      = "room"
+	ResourceEquipment = "equipment"
+)
+
+var (
+	// ErrUnknownResource is returned when an appointment reserves a resource which doesn't exist
+	// or doesn't belong to the clinic of the doctor.
+	ErrUnknownResource = errors.New("unknown resource")
+
+	// ErrResourceInUse is returned when a resource which appointments have reserved is deleted.
+	ErrResourceInUse = errors.New("resource in use")
+)
+
+// codeForeignKeyViolation is the SQLSTATE PostgreSQL reports when a FOREIGN KEY constraint is
+// violated.
+const codeForeignKeyViolation = "23503"
+
+// Resource is a room or a piece of equipment of a clinic, which appointments can reserve.
+type Resource struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	ClinicID    int64     `json:"clinicId"`
+	Name        string    `json:"name"`
+	Kind        string    `json:"kind"`
+	Description string    `json:"description"`
+}
+
+// ResourceBooking is an appointment which reserves a resource.
+type ResourceBooking struct {
+	AppointmentID int64  `json:"appointmentId"`
+	DoctorID      int64  `json:"doctorId"`
+	StartTime     string `json:"startTime"`
+	EndTime       string `json:"endTime"`
+	Status        string `json:"status"`
+}
+
+// ResourceUtilisation is the share of a day's opening hours for which a resource is reserved.
+type ResourceUtilisation struct {
+	Resource      *Resource         `json:"resource"`
+	Bookings      []ResourceBooking `json:"bookings"`
+	BookedMinutes int               `json:"bookedMinutes"`
+	OpenMinutes   int               `json:"openMinutes"`
+	Utilisation   float64           `json:"utilisation"`
+}
+
+type ResourceModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// resourceColumns lists the resources columns in the order expected by scanDest.
+const resourceColumns = `id, created_at, updated_at, clinic_id, name, kind, description`
+
+func (r *Resource) scanDest() []interface{} {
+	return []interface{}{&r.ID, &r.CreatedAt, &r.UpdatedAt, &r.ClinicID, &r.Name, &r.Kind, &r.Description}
+}
+
+// ValidateResource runs validation checks on the Resource type.
+func ValidateResource(v *validator.Validator, resource *Resource) {
+	v.Check(resource.Name != "", "name", "must be provided")
+	v.Check(len(resource.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(validator.In(resource.Kind, ResourceRoom, ResourceEquipment), "kind", "must be room or equipment")
+	v.Check(len(resource.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+}
+
+func (m ResourceModel) Insert(resource *Resource) error {
+	query := `
+		INSERT INTO resources (clinic_id, name, kind, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+		`
+	args := []interface{}{resource.ClinicID, resource.Name, resource.Kind, resource.Description}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&resource.ID, &resource.CreatedAt, &resource.UpdatedAt)
+}
+
+// GetAllForClinic returns the resources of the clinic, optionally only the ones of a kind.
+func (m ResourceModel) GetAllForClinic(clinicID int64, kind string) ([]*Resource, error) {
+	query := `
+		SELECT ` + resourceColumns + `
+		FROM resources
+		WHERE clinic_id = $1
+		AND (kind = $2 OR $2 = '')
+		ORDER BY kind, name, id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, clinicID, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	resources := []*Resource{}
+	for rows.Next() {
+		var resource Resource
+		if err := rows.Scan(resource.scanDest()...); err != nil {
+			return nil, err
+		}
+		resources = append(resources, &resource)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+func (m ResourceModel) Get(clinicID, id int64) (*Resource, error) {
+	query := `
+		SELECT ` + resourceColumns + `
+		FROM resources
+		WHERE id = $1 AND clinic_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var resource Resource
+
+	err := m.DB.QueryRowContext(ctx, query, id, clinicID).Scan(resource.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &resource, nil
+}
+
+func (m ResourceModel) Update(resource *Resource) error {
+	query := `
+		UPDATE resources
+		SET name = $1, kind = $2, description = $3, updated_at = now()
+		WHERE id = $4 AND clinic_id = $5
+		RETURNING updated_at
+		`
+	args := []interface{}{resource.Name, resource.Kind, resource.Description, resource.ID, resource.ClinicID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&resource.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a resource of the clinic. Resources which appointments have reserved are kept
+// for their history, and ErrResourceInUse is returned instead.
+func (m ResourceModel) Delete(clinicID, id int64) error {
+	query := `
+		DELETE FROM resources
+		WHERE id = $1 AND clinic_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, clinicID)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeForeignKeyViolation:
+			return ErrResourceInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetUtilisation returns, for every resource of the clinic (optionally only the ones of a kind),
+// the appointments reserving it on the date and how much of the clinic's opening hours they
+// take. A clinic without opening hours counts as open all day, and one on holiday as closed.
+func (m ResourceModel) GetUtilisation(clinicID int64, date time.Time, kind string) ([]*ResourceUtilisation, error) {
+	resources, err := m.GetAllForClinic(clinicID, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hoursQuery := `
+		SELECT
+			CASE
+				WHEN EXISTS (SELECT 1 FROM clinic_holidays WHERE clinic_id = $1 AND date = $2::DATE) THEN 0
+				WHEN NOT EXISTS (SELECT 1 FROM clinic_opening_hours WHERE clinic_id = $1) THEN 24 * 60
+				ELSE COALESCE((
+					SELECT SUM(EXTRACT(EPOCH FROM close_time - open_time))::INTEGER / 60
+					FROM clinic_opening_hours
+					WHERE clinic_id = $1 AND weekday = EXTRACT(DOW FROM $2::DATE)
+				), 0)
+			END
+		`
+
+	var openMinutes int
+
+	err = m.DB.QueryRowContext(ctx, hoursQuery, clinicID, date.Format(DateLayout)).Scan(&openMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	bookingsQuery := `
+		SELECT ar.resource_id, a.id, a.doctor_id, to_char(a.start_time, 'HH24:MI'),
+			to_char(a.end_time, 'HH24:MI'), a.status,
+			EXTRACT(EPOCH FROM a.end_time - a.start_time)::INTEGER / 60
+		FROM appointment_resources ar
+		INNER JOIN appointments a ON a.id = ar.appointment_id
+		INNER JOIN resources r ON r.id = ar.resource_id
+		WHERE r.clinic_id = $1
+		AND a.date = $2::DATE
+		AND NOT ar.cancelled
+		ORDER BY a.start_time, a.id
+		`
+
+	rows, err := m.DB.QueryContext(ctx, bookingsQuery, clinicID, date.Format(DateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	utilisation := make([]*ResourceUtilisation, len(resources))
+	byResource := make(map[int64]*ResourceUtilisation, len(resources))
+	for i, resource := range resources {
+		utilisation[i] = &ResourceUtilisation{Resource: resource, Bookings: []ResourceBooking{}, OpenMinutes: openMinutes}
+		byResource[resource.ID] = utilisation[i]
+	}
+
+	for rows.Next() {
+		var (
+			resourceID int64
+			booking    ResourceBooking
+			minutes    int
+		)
+		err := rows.Scan(&resourceID, &booking.AppointmentID, &booking.DoctorID, &booking.StartTime, &booking.EndTime, &booking.Status, &minutes)
+		if err != nil {
+			return nil, err
+		}
+
+		// Resources of other kinds are filtered out here rather than in the query.
+		if u, ok := byResource[resourceID]; ok {
+			u.Bookings = append(u.Bookings, booking)
+			u.BookedMinutes += minutes
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, u := range utilisation {
+		if u.OpenMinutes > 0 {
+			u.Utilisation = float64(u.BookedMinutes) / float64(u.OpenMinutes)
+		}
+	}
+
+	return utilisation, nil
+}
+
+// reserveResources reserves the resources of the appointment, which must already be stored. A
+// resource taken by another appointment at the same time is reported as ErrAppointmentConflict.
+func reserveResources(ctx context.Context, q querier, appointment *Appointment) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM appointment_resources WHERE appointment_id = $1`, appointment.Id)
+	if err != nil {
+		return err
+	}
+
+	if len(appointment.ResourceIDs) == 0 {
+		return nil
+	}
+
+	// Only the resources of the doctor's clinic can be reserved.
+	query := `
+		INSERT INTO appointment_resources (appointment_id, resource_id, period, cancelled)
+		SELECT a.id, r.id, tsrange(a.date + a.start_time, a.date + a.end_time), a.status = $3
+		FROM appointments a
+		INNER JOIN doctors d ON d.id = a.doctor_id
+		INNER JOIN resources r ON r.clinic_id = d.clinic_id
+		WHERE a.id = $1 AND r.id = ANY($2)
+		`
+
+	result, err := q.ExecContext(ctx, query, appointment.Id, pq.Array(appointment.ResourceIDs), StatusCancelled)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeExclusionViolation:
+			return ErrAppointmentConflict
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected != int64(len(appointment.ResourceIDs)) {
+		return ErrUnknownResource
+	}
+
+	return nil
+}
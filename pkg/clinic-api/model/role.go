@@ -0,0 +1,383 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/lib/pq"
+)
+
+// The built-in roles. The API assigns the patient and doctor roles to the users it creates for
+// patients and doctors.
+const (
+	RolePatient      = "patient"
+	RoleDoctor       = "doctor"
+	RoleReceptionist = "receptionist"
+	RoleClinicAdmin  = "clinic_admin"
+	RoleSuperAdmin   = "super_admin"
+)
+
+const (
+	// PermissionRolesAdmin lets a user edit roles and assign them to users.
+	PermissionRolesAdmin = "roles:admin"
+	// PermissionUsersAdmin lets a user manage the accounts and the permissions of other users.
+	PermissionUsersAdmin = "users:admin"
+)
+
+var (
+	// ErrDuplicateRole is returned when a role is created with the code of another role.
+	ErrDuplicateRole = errors.New("duplicate role")
+
+	// ErrBuiltinRole is returned when a built-in role is deleted.
+	ErrBuiltinRole = errors.New("built-in role")
+
+	// ErrUnknownPermission is returned when a role is given a permission code which doesn't
+	// exist.
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+// RoleCodeRX matches the codes of roles, such as clinic_admin.
+var RoleCodeRX = regexp.MustCompile("^[a-z][a-z0-9_]*$")
+
+// Role is a named set of permissions. Users have the permissions of their roles on top of the
+// ones granted to them directly.
+type Role struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+	Code        string      `json:"code"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Builtin     bool        `json:"builtin"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type RoleModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// roleColumns lists the roles columns, and the permission codes of the role, in the order
+// expected by scanDest. The query must join roles_permissions and permissions, and group by
+// roles.id.
+const roleColumns = `roles.id, roles.created_at, roles.updated_at, roles.code, roles.name,
+	roles.description, roles.builtin,
+	COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')`
+
+// roleJoins joins the permissions of the roles for roleColumns.
+const roleJoins = `
+	LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+	LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id`
+
+func (r *Role) scanDest() []interface{} {
+	return []interface{}{
+		&r.ID, &r.CreatedAt, &r.UpdatedAt, &r.Code, &r.Name, &r.Description, &r.Builtin,
+		pq.Array((*[]string)(&r.Permissions)),
+	}
+}
+
+// ValidateRole runs validation checks on the Role type.
+func ValidateRole(v *validator.Validator, role *Role) {
+	v.Check(role.Code != "", "code", "must be provided")
+	v.Check(len(role.Code) <= 50, "code", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(role.Code, RoleCodeRX), "code", "must contain only lowercase letters, digits and underscores")
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(len(role.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(role.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+
+	// Nobody could edit roles any more without it.
+	if role.Code == RoleSuperAdmin {
+		v.Check(role.Permissions.Include(PermissionRolesAdmin), "permissions", "must include "+PermissionRolesAdmin+" for the super_admin role")
+	}
+}
+
+// setRolePermissions replaces the permissions of the role with the ones with the codes. A code
+// which doesn't exist is reported as ErrUnknownPermission.
+func setRolePermissions(ctx context.Context, q querier, roleID int64, codes []string) error {
+	_, err := q.ExecContext(ctx, "DELETE FROM roles_permissions WHERE role_id = $1", roleID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO roles_permissions (role_id, permission_id)
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		`
+
+	result, err := q.ExecContext(ctx, query, roleID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected != int64(len(codes)) {
+		return ErrUnknownPermission
+	}
+
+	return nil
+}
+
+// Insert creates the role with its permissions.
+func (m RoleModel) Insert(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO roles (code, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+		`
+	args := []interface{}{role.Code, role.Name, role.Description}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&role.ID, &role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		switch {
+		case pqErrorCode(err) == codeUniqueViolation:
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAll returns every role with its permissions.
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles` + roleJoins + `
+		GROUP BY roles.id
+		ORDER BY roles.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.queryRoles(ctx, query)
+}
+
+// GetAllForUser returns the roles assigned to the user.
+func (m RoleModel) GetAllForUser(userID int64) ([]*Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles` + roleJoins + `
+		WHERE roles.id IN (SELECT role_id FROM users_roles WHERE user_id = $1)
+		GROUP BY roles.id
+		ORDER BY roles.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.queryRoles(ctx, query, userID)
+}
+
+func (m RoleModel) queryRoles(ctx context.Context, query string, args ...interface{}) ([]*Role, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(role.scanDest()...); err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (m RoleModel) Get(id int64) (*Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles` + roleJoins + `
+		WHERE roles.id = $1
+		GROUP BY roles.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role Role
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(role.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &role, nil
+}
+
+// Update saves the name, the description and the permissions of the role. The code of a role
+// can not be changed.
+func (m RoleModel) Update(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE roles
+		SET name = $1, description = $2, updated_at = now()
+		WHERE id = $3
+		RETURNING updated_at
+		`
+	args := []interface{}{role.Name, role.Description, role.ID}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&role.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes the role, and takes it away from the users it was assigned to. Built-in roles
+// are kept, and ErrBuiltinRole is returned instead.
+func (m RoleModel) Delete(id int64) error {
+	query := `
+		DELETE FROM roles
+		WHERE id = $1
+		RETURNING builtin
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var builtin bool
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&builtin)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if builtin {
+		return ErrBuiltinRole
+	}
+
+	return tx.Commit()
+}
+
+// AssignToUser gives the role with the code to the user. Assigning a role the user already has
+// does nothing, and an unknown code is reported as ErrRecordNotFound.
+func (m RoleModel) AssignToUser(userID int64, code string) error {
+	query := `
+		WITH role AS (
+			SELECT id FROM roles WHERE code = $2
+		), assigned AS (
+			INSERT INTO users_roles (user_id, role_id)
+			SELECT $1, role.id FROM role
+			ON CONFLICT DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM role)
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	err := m.DB.QueryRowContext(ctx, query, userID, code).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RemoveFromUser takes the role away from the user.
+func (m RoleModel) RemoveFromUser(userID, roleID int64) error {
+	query := `
+		DELETE FROM users_roles
+		WHERE user_id = $1 AND role_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
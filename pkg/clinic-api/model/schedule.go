@@ -0,0 +1,350 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+const (
+	// DateLayout is the layout used for calendar dates in requests and responses.
+	DateLayout = "2006-01-02"
+	// ClockLayout is the layout used for the time of day in requests and responses.
+	ClockLayout = "15:04"
+)
+
+// DoctorSchedule is a weekly recurring block of working time for a doctor. The block is split
+// into slots of SlotMinutes length, and applies only between EffectiveFrom and EffectiveTo
+// (inclusive, with a nil EffectiveTo meaning "until further notice").
+type DoctorSchedule struct {
+	ID            int64     `json:"id"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	DoctorID      int64     `json:"doctorId"`
+	Weekday       int       `json:"weekday"`
+	StartTime     string    `json:"startTime"`
+	EndTime       string    `json:"endTime"`
+	SlotMinutes   int       `json:"slotMinutes"`
+	EffectiveFrom string    `json:"effectiveFrom"`
+	EffectiveTo   *string   `json:"effectiveTo"`
+}
+
+// Slot is a time interval on a doctor's calendar. Slots are encoded to JSON in the same
+// date/start/end shape that the appointment endpoints accept.
+type Slot struct {
+	Start time.Time
+	End   time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface for Slot.
+func (s Slot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Date      string `json:"date"`
+		StartTime string `json:"startTime"`
+		EndTime   string `json:"endTime"`
+	}{
+		Date:      s.Start.Format(DateLayout),
+		StartTime: s.Start.Format(ClockLayout),
+		EndTime:   s.End.Format(ClockLayout),
+	})
+}
+
+// Overlaps reports whether the two slots share any point in time. Slots which only touch at
+// their boundaries do not overlap.
+func (s Slot) Overlaps(other Slot) bool {
+	return s.Start.Before(other.End) && other.Start.Before(s.End)
+}
+
+type ScheduleModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// ValidateDoctorSchedule runs validation checks on the DoctorSchedule type.
+func ValidateDoctorSchedule(v *validator.Validator, s *DoctorSchedule) {
+	v.Check(s.Weekday >= 0 && s.Weekday <= 6, "weekday", "must be between 0 (Sunday) and 6 (Saturday)")
+	v.Check(s.SlotMinutes > 0, "slotMinutes", "must be greater than 0")
+	v.Check(s.SlotMinutes <= 24*60, "slotMinutes", "must not be more than a day")
+
+	start, errStart := time.Parse(ClockLayout, s.StartTime)
+	end, errEnd := time.Parse(ClockLayout, s.EndTime)
+	v.Check(errStart == nil, "startTime", "must be a time in HH:MM format")
+	v.Check(errEnd == nil, "endTime", "must be a time in HH:MM format")
+	if errStart == nil && errEnd == nil {
+		v.Check(start.Before(end), "endTime", "must be after startTime")
+	}
+
+	from, errFrom := time.Parse(DateLayout, s.EffectiveFrom)
+	v.Check(errFrom == nil, "effectiveFrom", "must be a date in YYYY-MM-DD format")
+	if s.EffectiveTo != nil {
+		to, errTo := time.Parse(DateLayout, *s.EffectiveTo)
+		v.Check(errTo == nil, "effectiveTo", "must be a date in YYYY-MM-DD format")
+		if errFrom == nil && errTo == nil {
+			v.Check(!to.Before(from), "effectiveTo", "must not be before effectiveFrom")
+		}
+	}
+}
+
+func (m ScheduleModel) Insert(schedule *DoctorSchedule) error {
+	query := `
+		INSERT INTO doctor_schedules (doctor_id, weekday, start_time, end_time, slot_minutes, effective_from, effective_to)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+		`
+	args := []interface{}{
+		schedule.DoctorID,
+		schedule.Weekday,
+		schedule.StartTime,
+		schedule.EndTime,
+		schedule.SlotMinutes,
+		schedule.EffectiveFrom,
+		schedule.EffectiveTo,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&schedule.ID,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+}
+
+// GetAllForDoctor returns every schedule entry of a doctor, ordered by weekday and start time.
+func (m ScheduleModel) GetAllForDoctor(doctorID int64) ([]*DoctorSchedule, error) {
+	query := `
+		SELECT id, created_at, updated_at, doctor_id, weekday,
+			to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), slot_minutes,
+			to_char(effective_from, 'YYYY-MM-DD'), to_char(effective_to, 'YYYY-MM-DD')
+		FROM doctor_schedules
+		WHERE doctor_id = $1
+		ORDER BY weekday, start_time, id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	schedules := []*DoctorSchedule{}
+	for rows.Next() {
+		var schedule DoctorSchedule
+		err := rows.Scan(
+			&schedule.ID,
+			&schedule.CreatedAt,
+			&schedule.UpdatedAt,
+			&schedule.DoctorID,
+			&schedule.Weekday,
+			&schedule.StartTime,
+			&schedule.EndTime,
+			&schedule.SlotMinutes,
+			&schedule.EffectiveFrom,
+			&schedule.EffectiveTo,
+		)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, &schedule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// Get returns a single schedule entry of a doctor. Entries belonging to another doctor are
+// reported as ErrRecordNotFound.
+func (m ScheduleModel) Get(doctorID, id int64) (*DoctorSchedule, error) {
+	query := `
+		SELECT id, created_at, updated_at, doctor_id, weekday,
+			to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), slot_minutes,
+			to_char(effective_from, 'YYYY-MM-DD'), to_char(effective_to, 'YYYY-MM-DD')
+		FROM doctor_schedules
+		WHERE id = $1 AND doctor_id = $2
+		`
+	var schedule DoctorSchedule
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, doctorID).Scan(
+		&schedule.ID,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+		&schedule.DoctorID,
+		&schedule.Weekday,
+		&schedule.StartTime,
+		&schedule.EndTime,
+		&schedule.SlotMinutes,
+		&schedule.EffectiveFrom,
+		&schedule.EffectiveTo,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &schedule, nil
+}
+
+func (m ScheduleModel) Update(schedule *DoctorSchedule) error {
+	query := `
+		UPDATE doctor_schedules
+		SET weekday = $1, start_time = $2, end_time = $3, slot_minutes = $4,
+			effective_from = $5, effective_to = $6, updated_at = now()
+		WHERE id = $7 AND doctor_id = $8
+		RETURNING updated_at
+		`
+	args := []interface{}{
+		schedule.Weekday,
+		schedule.StartTime,
+		schedule.EndTime,
+		schedule.SlotMinutes,
+		schedule.EffectiveFrom,
+		schedule.EffectiveTo,
+		schedule.ID,
+		schedule.DoctorID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&schedule.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ScheduleModel) Delete(doctorID, id int64) error {
+	query := `
+		DELETE FROM doctor_schedules
+		WHERE id = $1 AND doctor_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, doctorID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// applies reports whether the schedule entry is in effect on the given day.
+func (s *DoctorSchedule) applies(day time.Time) bool {
+	if int(day.Weekday()) != s.Weekday {
+		return false
+	}
+
+	from, err := time.Parse(DateLayout, s.EffectiveFrom)
+	if err != nil || day.Before(from) {
+		return false
+	}
+
+	if s.EffectiveTo != nil {
+		to, err := time.Parse(DateLayout, *s.EffectiveTo)
+		if err != nil || day.After(to) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FreeSlots expands the schedules into slots for every day between from and to (both dates
+// inclusive) and drops the slots which overlap with any of the busy intervals. Schedule entries
+// which overlap each other never yield the same slot twice.
+func FreeSlots(schedules []*DoctorSchedule, busy []Slot, from, to time.Time) []Slot {
+	slots := []Slot{}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		var daySlots []Slot
+
+		for _, schedule := range schedules {
+			if !schedule.applies(day) {
+				continue
+			}
+
+			start, errStart := time.Parse(ClockLayout, schedule.StartTime)
+			end, errEnd := time.Parse(ClockLayout, schedule.EndTime)
+			if errStart != nil || errEnd != nil {
+				continue
+			}
+
+			blockStart := day.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+			blockEnd := day.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute)
+			length := time.Duration(schedule.SlotMinutes) * time.Minute
+
+			for slotStart := blockStart; !slotStart.Add(length).After(blockEnd); slotStart = slotStart.Add(length) {
+				slot := Slot{Start: slotStart, End: slotStart.Add(length)}
+				if overlapsAny(slot, busy) || overlapsAny(slot, daySlots) {
+					continue
+				}
+				daySlots = append(daySlots, slot)
+			}
+		}
+
+		sortSlots(daySlots)
+		slots = append(slots, daySlots...)
+	}
+
+	return slots
+}
+
+// overlapsAny reports whether slot overlaps with at least one of the others.
+func overlapsAny(slot Slot, others []Slot) bool {
+	for _, other := range others {
+		if slot.Overlaps(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortSlots orders slots by their start time.
+func sortSlots(slots []Slot) {
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Start.Before(slots[j].Start)
+	})
+}
@@ -0,0 +1,568 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/Zhassulan1/Go_Project/pkg/rrule"
+)
+
+// The parts of a series that an edit or a cancellation applies to.
+const (
+	SeriesScopeThis      = "this"
+	SeriesScopeFollowing = "following"
+	SeriesScopeAll       = "all"
+)
+
+const (
+	SeriesActive    = "active"
+	SeriesCancelled = "cancelled"
+)
+
+// AppointmentSeries is a recurring appointment, such as a weekly physiotherapy session. The
+// occurrences are stored as regular appointments linked back to the series, so they are
+// booked, checked for overlaps and moved through their lifecycle one by one.
+type AppointmentSeries struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	PatientID int64     `json:"patientId"`
+	DoctorID  int64     `json:"doctorId"`
+	StartDate string    `json:"startDate"`
+	StartTime string    `json:"startTime"`
+	EndTime   string    `json:"endTime"`
+	RRule     string    `json:"rrule"`
+	Status    string    `json:"status"`
+}
+
+// SeriesConflict describes an occurrence of a series which could not be booked (or moved)
+// because of existing appointments, time-offs, holds or group sessions of the doctor, or the
+// opening hours of the clinic.
+type SeriesConflict struct {
+	Date          string  `json:"date"`
+	AppointmentID *int64  `json:"appointmentId,omitempty"`
+	Conflicts     []int64 `json:"conflicts"`
+	TimeOff       []int64 `json:"timeOff,omitempty"`
+	ClinicClosed  bool    `json:"clinicClosed,omitempty"`
+	Held          bool    `json:"held,omitempty"`
+	GroupSessions []int64 `json:"groupSessions,omitempty"`
+}
+
+// SeriesChanges holds the fields of an edit which apply to every affected occurrence. Nil
+// fields are left untouched. Date can only be changed for a single occurrence.
+type SeriesChanges struct {
+	DoctorID  *int64
+	Date      *string
+	StartTime *string
+	EndTime   *string
+}
+
+type SeriesModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// ValidateSeries runs validation checks on the AppointmentSeries type and returns the dates of
+// its occurrences when the series is valid.
+func ValidateSeries(v *validator.Validator, series *AppointmentSeries) []time.Time {
+	v.Check(series.PatientID > 0, "patientId", "must be provided")
+	v.Check(series.DoctorID > 0, "doctorId", "must be provided")
+	validateTimeRange(v, series.StartTime, series.EndTime)
+
+	start, err := time.Parse(DateLayout, series.StartDate)
+	v.Check(err == nil, "startDate", "must be a date in YYYY-MM-DD format")
+
+	rule, ruleErr := rrule.Parse(series.RRule)
+	if ruleErr != nil {
+		v.AddError("rrule", ruleErr.Error())
+	}
+
+	if err != nil || ruleErr != nil {
+		return nil
+	}
+
+	// The first occurrence is always the start date, so it has to match the rule.
+	v.Check(rule.Matches(start), "startDate", "must fall on one of the BYDAY days")
+	series.RRule = rule.String()
+
+	return rule.Expand(start)
+}
+
+// Occurrence returns the requested appointment of the series on the date.
+func (series *AppointmentSeries) Occurrence(date time.Time) *Appointment {
+	return &Appointment{
+		PatientId: strconv.FormatInt(series.PatientID, 10),
+		DoctorId:  strconv.FormatInt(series.DoctorID, 10),
+		Date:      date.Format(DateLayout),
+		StartTime: series.StartTime,
+		EndTime:   series.EndTime,
+		Status:    StatusRequested,
+		SeriesId:  &series.ID,
+	}
+}
+
+// ValidateSeriesScope checks the scope of an edit or cancellation.
+func ValidateSeriesScope(v *validator.Validator, scope string, appointmentID int64) {
+	v.Check(validator.In(scope, SeriesScopeThis, SeriesScopeFollowing, SeriesScopeAll), "scope", "must be one of this, following or all")
+	if scope != SeriesScopeAll {
+		v.Check(appointmentID > 0, "appointmentId", "must be provided for this scope")
+	}
+}
+
+// validateTimeRange checks a pair of HH:MM times of day.
+func validateTimeRange(v *validator.Validator, startTime, endTime string) {
+	start, errStart := time.Parse(ClockLayout, startTime)
+	end, errEnd := time.Parse(ClockLayout, endTime)
+	v.Check(errStart == nil, "startTime", "must be a time in HH:MM format")
+	v.Check(errEnd == nil, "endTime", "must be a time in HH:MM format")
+	if errStart == nil && errEnd == nil {
+		v.Check(start.Before(end), "endTime", "must be after startTime")
+	}
+}
+
+// Insert creates the series and books one appointment for every date. Dates which overlap with
+// existing appointments of the doctor or the patient, with a time-off of the doctor, or which
+// fall outside the opening hours of the clinic are skipped and reported back, while the rest of
+// the series is booked. Nothing is created when every date is skipped, and the conflicts are
+// returned with ErrAppointmentConflict.
+func (m SeriesModel) Insert(series *AppointmentSeries, dates []time.Time) ([]*Appointment, []SeriesConflict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO appointment_series (patient_id, doctor_id, start_date, start_time, end_time, rrule)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at, status
+		`
+	args := []interface{}{
+		series.PatientID,
+		series.DoctorID,
+		series.StartDate,
+		series.StartTime,
+		series.EndTime,
+		series.RRule,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&series.ID, &series.CreatedAt, &series.UpdatedAt, &series.Status)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appointments := []*Appointment{}
+	conflicts := []SeriesConflict{}
+
+	for _, date := range dates {
+		appointment := series.Occurrence(date)
+
+		ids, err := findConflicts(ctx, tx, appointment)
+		if err != nil {
+			return nil, nil, err
+		}
+		timeOff, err := findTimeOff(ctx, tx, appointment)
+		if err != nil {
+			return nil, nil, err
+		}
+		closed := false
+		if err := checkOpeningHours(ctx, tx, appointment); err != nil {
+			if !errors.Is(err, ErrClinicClosed) {
+				return nil, nil, err
+			}
+			closed = true
+		}
+		held := false
+		if err := checkHolds(ctx, tx, appointment); err != nil {
+			if !errors.Is(err, ErrSlotHeld) {
+				return nil, nil, err
+			}
+			held = true
+		}
+		sessions, err := findGroupSessions(ctx, tx, appointment)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ids) > 0 || len(timeOff) > 0 || closed || held || len(sessions) > 0 {
+			conflict := SeriesConflict{
+				Date:          appointment.Date,
+				Conflicts:     ids,
+				TimeOff:       timeOff,
+				ClinicClosed:  closed,
+				Held:          held,
+				GroupSessions: sessions,
+			}
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		// The check above already skipped the taken dates, so a conflict here means that
+		// someone booked the slot concurrently, and the whole series is rejected.
+		err = insertAppointment(ctx, tx, appointment)
+		if err != nil {
+			return nil, nil, err
+		}
+		appointments = append(appointments, appointment)
+	}
+
+	// A series without a single occurrence is not worth keeping.
+	if len(appointments) == 0 {
+		return nil, conflicts, ErrAppointmentConflict
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return appointments, conflicts, nil
+}
+
+func (m SeriesModel) Get(id int64) (*AppointmentSeries, error) {
+	query := `
+		SELECT id, created_at, updated_at, patient_id, doctor_id, to_char(start_date, 'YYYY-MM-DD'),
+			to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), rrule, status
+		FROM appointment_series
+		WHERE id = $1
+		`
+	var series AppointmentSeries
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&series.ID,
+		&series.CreatedAt,
+		&series.UpdatedAt,
+		&series.PatientID,
+		&series.DoctorID,
+		&series.StartDate,
+		&series.StartTime,
+		&series.EndTime,
+		&series.RRule,
+		&series.Status,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &series, nil
+}
+
+// GetOccurrences returns every appointment of the series, in chronological order.
+func (m SeriesModel) GetOccurrences(seriesID int64) ([]*Appointment, error) {
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE series_id = $1
+		ORDER BY date, start_time
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryAppointments(ctx, m.DB, query, seriesID)
+}
+
+// scopeCondition returns the SQL condition selecting the occurrences of a series that an edit
+// or a cancellation in the given scope applies to. $2 is the ID of the occurrence the client
+// picked, it is ignored for the whole series.
+func scopeCondition(scope string) string {
+	switch scope {
+	case SeriesScopeThis:
+		return "id = $2"
+	case SeriesScopeFollowing:
+		return "date >= (SELECT date FROM appointments WHERE id = $2 AND series_id = $1)"
+	default:
+		// $2 still has to appear in the query, or PostgreSQL can't tell its type.
+		return "$2::BIGINT >= 0"
+	}
+}
+
+// pendingCondition returns the SQL condition selecting the occurrences of the series $1 in the
+// scope which have not taken place yet, which are the ones edits and cancellations apply to.
+func pendingCondition(scope string) string {
+	return fmt.Sprintf("series_id = $1 AND status IN ('%s', '%s') AND %s AND %s > now()", StatusRequested, StatusConfirmed,
+		scopeCondition(scope), clinicTime("date", "start_time", "appointments.doctor_id"))
+}
+
+// GetPendingOccurrences returns the occurrences in scope that an edit or a cancellation would
+// apply to, in chronological order.
+func (m SeriesModel) GetPendingOccurrences(series *AppointmentSeries, scope string, appointmentID int64) ([]*Appointment, error) {
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE ` + pendingCondition(scope) + `
+		ORDER BY date, start_time
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queryAppointments(ctx, m.DB, query, series.ID, appointmentID)
+}
+
+// Apply returns a copy of the occurrence with the changes applied.
+func (c SeriesChanges) Apply(occurrence *Appointment) *Appointment {
+	changed := *occurrence
+	if c.DoctorID != nil {
+		changed.DoctorId = strconv.FormatInt(*c.DoctorID, 10)
+	}
+	if c.Date != nil {
+		changed.Date = *c.Date
+	}
+	if c.StartTime != nil {
+		changed.StartTime = *c.StartTime
+	}
+	if c.EndTime != nil {
+		changed.EndTime = *c.EndTime
+	}
+	return &changed
+}
+
+// UpdateOccurrences applies the changes to the occurrences in scope that have not taken place
+// yet, and counts the move as a reschedule of each of them. Either all of them are moved, or
+// none: if any of the moved occurrences would overlap with another appointment, a time-off, a
+// hold or a group session, or fall outside the opening hours of the clinic, nothing is saved and
+// the conflicts are returned.
+func (m SeriesModel) UpdateOccurrences(series *AppointmentSeries, scope string, appointmentID int64, changes SeriesChanges) ([]*Appointment, []SeriesConflict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE ` + pendingCondition(scope) + `
+		ORDER BY date, start_time
+		FOR UPDATE
+		`
+
+	occurrences, err := queryAppointments(ctx, tx, query, series.ID, appointmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(occurrences) == 0 {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	conflicts := []SeriesConflict{}
+
+	for i, occurrence := range occurrences {
+		occurrence = changes.Apply(occurrence)
+		occurrences[i] = occurrence
+
+		id, _ := strconv.ParseInt(occurrence.Id, 10, 64)
+
+		timeOff, err := findTimeOff(ctx, tx, occurrence)
+		if err != nil {
+			return nil, nil, err
+		}
+		closed := false
+		if err := checkOpeningHours(ctx, tx, occurrence); err != nil {
+			if !errors.Is(err, ErrClinicClosed) {
+				return nil, nil, err
+			}
+			closed = true
+		}
+		held := false
+		if err := checkHolds(ctx, tx, occurrence); err != nil {
+			if !errors.Is(err, ErrSlotHeld) {
+				return nil, nil, err
+			}
+			held = true
+		}
+		sessions, err := findGroupSessions(ctx, tx, occurrence)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(timeOff) > 0 || closed || held || len(sessions) > 0 {
+			conflict := SeriesConflict{
+				Date:          occurrence.Date,
+				AppointmentID: &id,
+				Conflicts:     []int64{},
+				TimeOff:       timeOff,
+				ClinicClosed:  closed,
+				Held:          held,
+				GroupSessions: sessions,
+			}
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		update := `
+			UPDATE appointments
+			SET doctor_id = $1, date = $2, start_time = $3, end_time = $4,
+				reschedule_count = reschedule_count + 1, updated_at = now()
+			WHERE id = $5
+			RETURNING ` + appointmentColumns
+
+		args := []interface{}{occurrence.DoctorId, occurrence.Date, occurrence.StartTime, occurrence.EndTime, occurrence.Id}
+
+		// Run every update in its own savepoint, so that an overlap does not abort the
+		// transaction before we have collected all of the conflicts.
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT occurrence"); err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.QueryRowContext(ctx, update, args...).Scan(occurrence.scanDest()...)
+		if err != nil {
+			if pqErrorCode(err) != codeExclusionViolation {
+				return nil, nil, err
+			}
+
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT occurrence"); err != nil {
+				return nil, nil, err
+			}
+
+			ids, err := findConflicts(ctx, tx, occurrence)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			conflicts = append(conflicts, SeriesConflict{Date: occurrence.Date, AppointmentID: &id, Conflicts: ids})
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, conflicts, ErrAppointmentConflict
+	}
+
+	// Edits of the following or all occurrences also become the new template of the series.
+	if scope != SeriesScopeThis {
+		if changes.DoctorID != nil {
+			series.DoctorID = *changes.DoctorID
+		}
+		if changes.StartTime != nil {
+			series.StartTime = *changes.StartTime
+		}
+		if changes.EndTime != nil {
+			series.EndTime = *changes.EndTime
+		}
+
+		err = updateSeries(ctx, tx, series)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return occurrences, nil, nil
+}
+
+// Cancel cancels the occurrences in scope that have not taken place yet, and returns their IDs.
+// Cancelling the whole series also marks the series itself as cancelled.
+func (m SeriesModel) Cancel(series *AppointmentSeries, scope string, appointmentID int64, userID int64, reason string) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		UPDATE appointments
+		SET status = '%s', cancelled_at = now(), cancelled_by = $3, cancellation_reason = NULLIF($4, ''),
+			updated_at = now()
+		WHERE %s
+		RETURNING id
+		`, StatusCancelled, pendingCondition(scope))
+
+	rows, err := tx.QueryContext(ctx, query, series.ID, appointmentID, userID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if scope == SeriesScopeAll {
+		series.Status = SeriesCancelled
+
+		err = updateSeries(ctx, tx, series)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// updateSeries saves the template fields and the status of the series.
+func updateSeries(ctx context.Context, q querier, series *AppointmentSeries) error {
+	query := `
+		UPDATE appointment_series
+		SET doctor_id = $1, start_time = $2, end_time = $3, status = $4, updated_at = now()
+		WHERE id = $5
+		RETURNING updated_at
+		`
+	args := []interface{}{series.DoctorID, series.StartTime, series.EndTime, series.Status, series.ID}
+
+	return q.QueryRowContext(ctx, query, args...).Scan(&series.UpdatedAt)
+}
+
+// queryAppointments runs a query selecting appointmentColumns and scans every row.
+func queryAppointments(ctx context.Context, q querier, query string, args ...interface{}) ([]*Appointment, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := []*Appointment{}
+	for rows.Next() {
+		var appointment Appointment
+		if err := rows.Scan(appointment.scanDest()...); err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, &appointment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return appointments, nil
+}
@@ -0,0 +1,231 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+	"github.com/lib/pq"
+)
+
+// DateTimeLayout is the format of the local date-times of time-off ranges, e.g. 2024-05-01T09:00.
+const DateTimeLayout = "2006-01-02T15:04"
+
+var (
+	// ErrDoctorUnavailable is returned when an appointment falls into a time-off of the doctor.
+	ErrDoctorUnavailable = errors.New("doctor unavailable")
+)
+
+// DoctorTimeOff is a range during which the doctor is absent and can't be booked.
+type DoctorTimeOff struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	DoctorID  int64     `json:"doctorId"`
+	Start     string    `json:"start"`
+	End       string    `json:"end"`
+	Reason    string    `json:"reason"`
+	CreatedBy *int64    `json:"createdBy,omitempty"`
+}
+
+type TimeOffModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// timeOffColumns lists the doctor_time_off columns in the order expected by scanDest.
+const timeOffColumns = `
+	id, created_at, doctor_id, to_char(starts_at, 'YYYY-MM-DD"T"HH24:MI'),
+	to_char(ends_at, 'YYYY-MM-DD"T"HH24:MI'), reason, created_by`
+
+func (t *DoctorTimeOff) scanDest() []interface{} {
+	return []interface{}{&t.ID, &t.CreatedAt, &t.DoctorID, &t.Start, &t.End, &t.Reason, &t.CreatedBy}
+}
+
+// ValidateTimeOff runs validation checks on the DoctorTimeOff type.
+func ValidateTimeOff(v *validator.Validator, timeOff *DoctorTimeOff) {
+	start, errStart := time.Parse(DateTimeLayout, timeOff.Start)
+	end, errEnd := time.Parse(DateTimeLayout, timeOff.End)
+	v.Check(errStart == nil, "start", "must be a date-time in YYYY-MM-DDTHH:MM format")
+	v.Check(errEnd == nil, "end", "must be a date-time in YYYY-MM-DDTHH:MM format")
+	if errStart == nil && errEnd == nil {
+		v.Check(start.Before(end), "end", "must be after start")
+	}
+	v.Check(len(timeOff.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+// cancellableStatuses returns the statuses from which an appointment may still be cancelled.
+func cancellableStatuses() []string {
+	var statuses []string
+	for status := range appointmentTransitions {
+		if CanTransition(status, StatusCancelled) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// Insert creates the time-off and returns the appointments of the doctor which fall into it and
+// haven't been cancelled or finished yet. When cancel is set, those appointments are cancelled
+// by userID with the given reason in the same transaction, and returned in their new state.
+func (m TimeOffModel) Insert(timeOff *DoctorTimeOff, cancel bool, userID int64, reason string) ([]*Appointment, error) {
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelCtx()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Appointments booked meanwhile would neither be kept out of the time-off nor be returned.
+	err = lockDoctorSlots(ctx, tx, strconv.FormatInt(timeOff.DoctorID, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO doctor_time_off (doctor_id, starts_at, ends_at, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+		`
+	args := []interface{}{timeOff.DoctorID, timeOff.Start, timeOff.End, timeOff.Reason, timeOff.CreatedBy}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&timeOff.ID, &timeOff.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	overlap := `
+		doctor_id = $1
+		AND status = ANY($2)
+		AND tsrange(date + start_time, date + end_time) && tsrange($3::TIMESTAMP, $4::TIMESTAMP)
+		`
+	args = []interface{}{timeOff.DoctorID, pq.Array(cancellableStatuses()), timeOff.Start, timeOff.End}
+
+	if cancel {
+		query = `
+			UPDATE appointments
+			SET status = 'cancelled', cancelled_at = now(), cancelled_by = $5, cancellation_reason = $6
+			WHERE ` + overlap + `
+			RETURNING ` + appointmentColumns
+		args = append(args, userID, reason)
+	} else {
+		query = `
+			SELECT ` + appointmentColumns + `
+			FROM appointments
+			WHERE ` + overlap + `
+			ORDER BY date, start_time, id
+			`
+	}
+
+	affected, err := queryAppointments(ctx, tx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return affected, nil
+}
+
+// GetAllForDoctor returns the time-offs of the doctor which haven't ended yet.
+func (m TimeOffModel) GetAllForDoctor(doctorID int64) ([]*DoctorTimeOff, error) {
+	query := `
+		SELECT ` + timeOffColumns + `
+		FROM doctor_time_off
+		WHERE doctor_id = $1 AND ends_at > LOCALTIMESTAMP
+		ORDER BY starts_at, id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	timeOffs := []*DoctorTimeOff{}
+	for rows.Next() {
+		var timeOff DoctorTimeOff
+		if err := rows.Scan(timeOff.scanDest()...); err != nil {
+			return nil, err
+		}
+		timeOffs = append(timeOffs, &timeOff)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return timeOffs, nil
+}
+
+// Delete removes a time-off of the doctor, so that the doctor can be booked again.
+func (m TimeOffModel) Delete(doctorID, id int64) error {
+	query := `
+		DELETE FROM doctor_time_off
+		WHERE id = $1 AND doctor_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, doctorID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// findTimeOff returns the IDs of the time-offs of the doctor which the appointment falls into.
+func findTimeOff(ctx context.Context, q querier, appointment *Appointment) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM doctor_time_off
+		WHERE doctor_id = $1
+		AND tsrange(starts_at, ends_at) && tsrange($2::DATE + $3::TIME, $2::DATE + $4::TIME)
+		ORDER BY starts_at
+		`
+	args := []interface{}{appointment.DoctorId, appointment.Date, appointment.StartTime, appointment.EndTime}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"log"
 	"time"
 
@@ -16,8 +17,21 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	// ScopeCalendarFeed tokens are put in the URL of iCalendar feeds, because calendar clients
+	// can't send an Authorization header.
+	ScopeCalendarFeed = "calendar-feed"
+	// ScopePasswordReset tokens are mailed to users who forgot their password, and let them set
+	// a new one.
+	ScopePasswordReset = "password-reset"
+	// ScopeRefresh tokens are long-lived and can only be exchanged for a new short-lived
+	// authentication token. Each of them works once, and is rotated with every exchange.
+	ScopeRefresh = "refresh"
 )
 
+// ErrTokenReused is returned when a refresh token which was already rotated is used again. Only
+// a stolen copy of the token can be used twice, so the whole session is revoked.
+var ErrTokenReused = errors.New("token reused")
+
 type (
 	// Token represents a token record in our tokens table.
 	// Note, it includes plaintext and hashed version of the token.
@@ -27,6 +41,23 @@ type (
 		UserID    int64     `json:"-"`
 		Expiry    time.Time `json:"expiry"`
 		Scope     string    `json:"-"`
+		IP        string    `json:"-"`
+		UserAgent string    `json:"-"`
+		// FamilyID groups the authentication and refresh tokens issued for one login.
+		FamilyID int64 `json:"-"`
+	}
+
+	// Session is a login of a user, with the authentication and refresh tokens issued for it, as
+	// its user sees it in the list of their sessions. The tokens themselves are never shown again
+	// after they were issued.
+	Session struct {
+		ID         int64      `json:"id"`
+		CreatedAt  time.Time  `json:"createdAt"`
+		LastUsedAt *time.Time `json:"lastUsedAt"`
+		Expiry     time.Time  `json:"expiry"`
+		IP         string     `json:"ip"`
+		UserAgent  string     `json:"userAgent"`
+		Current    bool       `json:"current"`
 	}
 
 	// TokenModel struct wraps a sql.DB connection pool and allows us to work with the Token struct
@@ -50,19 +81,157 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 
 }
 
-// Insert inserts a new token record into the tokens table.
-func (m TokenModel) Insert(token *Token) error {
+// maxUserAgentLength is how much of the User-Agent header of a client is kept for its session.
+const maxUserAgentLength = 512
+
+// NewSession starts a session for a client with the IP address and user agent, which are shown
+// in the list of the sessions of the user. It returns a short-lived authentication token and a
+// refresh token, which both belong to the new token family of the session.
+func (m TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var familyID int64
+
+	err = tx.QueryRowContext(ctx, "SELECT nextval('token_family_seq')").Scan(&familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := issueSessionTokens(ctx, tx, userID, familyID, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+// Refresh exchanges the refresh token for a new authentication token and a new refresh token of
+// the same session, and marks the old refresh token as rotated. An unknown or expired refresh
+// token is reported as ErrRecordNotFound. A refresh token which was already rotated is reported
+// as ErrTokenReused, after every token of its session was deleted.
+func (m TokenModel) Refresh(refreshPlaintext string, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope, plain_token)
-		VALUES ($1, $2, $3, $4, $5)
+		SELECT user_id, family_id, rotated_at IS NOT NULL
+		FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > now()
+		FOR UPDATE
 		`
 
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.Plaintext}
+	tokenHash := sha256.Sum256([]byte(refreshPlaintext))
+
+	var (
+		userID   int64
+		familyID int64
+		rotated  bool
+	)
+
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh).Scan(&userID, &familyID, &rotated)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if rotated {
+		_, err = tx.ExecContext(ctx, "DELETE FROM tokens WHERE family_id = $1", familyID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, ErrTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE tokens SET rotated_at = now() WHERE hash = $1", tokenHash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := issueSessionTokens(ctx, tx, userID, familyID, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+// issueSessionTokens inserts a new authentication token and a new refresh token of the token
+// family.
+func issueSessionTokens(ctx context.Context, q querier, userID, familyID int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	tokens := make([]*Token, 2)
+
+	for i, scope := range []string{ScopeAuthentication, ScopeRefresh} {
+		ttl := accessTTL
+		if scope == ScopeRefresh {
+			ttl = refreshTTL
+		}
+
+		token, err := generateToken(userID, ttl, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		token.IP, token.UserAgent, token.FamilyID = ip, userAgent, familyID
+
+		err = insertToken(ctx, q, token)
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens[i] = token
+	}
+
+	return tokens[0], tokens[1], nil
+}
 
+// Insert inserts a new token record into the tokens table. Only the plaintext of authentication
+// tokens is kept, since nothing else looks tokens up by it.
+func (m TokenModel) Insert(token *Token) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	return insertToken(ctx, m.DB, token)
+}
+
+func insertToken(ctx context.Context, q querier, token *Token) error {
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope, plain_token, ip, user_agent, family_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0))
+		`
+
+	var plaintext *string
+	if token.Scope == ScopeAuthentication {
+		plaintext = &token.Plaintext
+	}
+
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, plaintext, token.IP, token.UserAgent, token.FamilyID}
+
+	_, err := q.ExecContext(ctx, query, args...)
 	return err
 }
 
@@ -80,6 +249,161 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 }
 
+// DeleteSessionsForUser deletes the authentication and refresh tokens of every session of the
+// user.
+func (m TokenModel) DeleteSessionsForUser(userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope IN ($1, $2) AND user_id = $3
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ScopeAuthentication, ScopeRefresh, userID)
+	return err
+}
+
+// Touch records that the authentication token was used just now by a client with the IP address
+// and user agent. It is only written once a minute, so that every request does not update the
+// token.
+func (m TokenModel) Touch(tokenPlaintext, ip, userAgent string) error {
+	query := `
+		UPDATE tokens
+		SET last_used_at = now(), ip = $3, user_agent = $4
+		WHERE hash = $1 AND scope = $2
+		AND (last_used_at IS NULL OR last_used_at < now() - INTERVAL '1 minute')
+		`
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:], ScopeAuthentication, ip, userAgent)
+	return err
+}
+
+// GetSessions returns the sessions of the user which haven't expired, the most recently used
+// first. The session of the current authentication token is marked as current.
+func (m TokenModel) GetSessions(userID int64, currentPlaintext string) ([]*Session, error) {
+	// The address and the client of a session are the ones of its most recently used token.
+	query := `
+		SELECT family_id, min(created_at), max(last_used_at), max(expiry),
+			(array_agg(ip ORDER BY COALESCE(last_used_at, created_at) DESC))[1],
+			(array_agg(user_agent ORDER BY COALESCE(last_used_at, created_at) DESC))[1],
+			bool_or(hash = $4)
+		FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3) AND expiry > now() AND rotated_at IS NULL
+		GROUP BY family_id
+		ORDER BY COALESCE(max(last_used_at), min(created_at)) DESC, family_id DESC
+		`
+
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, currentHash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSessionForToken deletes every token of the session of the authentication token, such as
+// the session of a client which logs out.
+func (m TokenModel) DeleteSessionForToken(tokenPlaintext string) error {
+	query := `
+		DELETE FROM tokens
+		WHERE family_id = (
+			SELECT family_id FROM tokens
+			WHERE hash = $1 AND scope = $2
+		)
+		`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, tokenHash[:], ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteSession deletes every token of the session of the user.
+func (m TokenModel) DeleteSession(userID, id int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE family_id = $1 AND user_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
 	// Create a Token instance containing the user ID, expiry, and scope information.
 	// Notice that we add the provided ttl (time-to-live) duration parameter to the
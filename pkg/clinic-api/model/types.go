@@ -10,6 +10,11 @@ type Patient struct {
 	Birthdate string `json:"birthdate"`
 	Gender    string `json:"gender"`
 	UserID    int64  `json:"user_id"`
+	// NoShowCount is how many appointments the patient did not turn up to, and NoShowRate its
+	// share of the appointments which are over, attended or not.
+	NoShowCount      int        `json:"noShowCount"`
+	NoShowRate       float64    `json:"noShowRate"`
+	NoShowsClearedAt *time.Time `json:"noShowsClearedAt,omitempty"`
 }
 
 type Doctor struct {
@@ -53,6 +58,64 @@ type Appointment struct {
 	StartTime string `json:"startTime"`
 	EndTime   string `json:"endTime"`
 	Status    string `json:"status"`
+	SeriesId  *int64 `json:"seriesId,omitempty"`
+	Sequence  int    `json:"sequence"`
+	// Timezone is the IANA time zone of the doctor's clinic, which Date, StartTime and EndTime
+	// are local to.
+	Timezone string `json:"timezone"`
+	// ResourceIDs are the rooms and equipment of the clinic reserved for the appointment.
+	ResourceIDs []int64 `json:"resourceIds"`
+	// TypeID is the appointment type the appointment was booked as. The buffers are copied from
+	// the type, and keep the doctor busy for that many minutes before and after the appointment.
+	TypeID              *int64 `json:"typeId,omitempty"`
+	BufferBeforeMinutes int    `json:"bufferBeforeMinutes"`
+	BufferAfterMinutes  int    `json:"bufferAfterMinutes"`
+
+	// Who moved the appointment into each status of its lifecycle, and when.
+	ConfirmedAt        *time.Time `json:"confirmedAt,omitempty"`
+	ConfirmedBy        *int64     `json:"confirmedBy,omitempty"`
+	CheckedInAt        *time.Time `json:"checkedInAt,omitempty"`
+	CheckedInBy        *int64     `json:"checkedInBy,omitempty"`
+	StartedAt          *time.Time `json:"startedAt,omitempty"`
+	StartedBy          *int64     `json:"startedBy,omitempty"`
+	CompletedAt        *time.Time `json:"completedAt,omitempty"`
+	CompletedBy        *int64     `json:"completedBy,omitempty"`
+	CancelledAt        *time.Time `json:"cancelledAt,omitempty"`
+	CancelledBy        *int64     `json:"cancelledBy,omitempty"`
+	CancellationReason *string    `json:"cancellationReason,omitempty"`
+	NoShowAt           *time.Time `json:"noShowAt,omitempty"`
+	NoShowBy           *int64     `json:"noShowBy,omitempty"`
+
+	// RescheduledFrom links a rescheduled appointment to the one it replaced, and
+	// RescheduleCount is how many times the original booking has been rescheduled so far.
+	RescheduledFrom *int64 `json:"rescheduledFrom,omitempty"`
+	RescheduleCount int    `json:"rescheduleCount"`
+
+	// Doctor and Patient summarise the people of the appointment in search results.
+	Doctor  *DoctorSummary  `json:"doctor,omitempty"`
+	Patient *PatientSummary `json:"patient,omitempty"`
+
+	// QueueNumber is handed out at check-in, and counts from 1 every day in every clinic.
+	QueueNumber *int `json:"queueNumber,omitempty"`
+	// WaitSeconds is the time from check-in to the start of the visit, and VisitSeconds the
+	// length of the visit.
+	WaitSeconds  *int `json:"waitSeconds,omitempty"`
+	VisitSeconds *int `json:"visitSeconds,omitempty"`
+}
+
+// DoctorSummary is the part of a Doctor embedded into the appointments of search results.
+type DoctorSummary struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Specialty string `json:"specialty"`
+	ClinicID  int64  `json:"clinicId"`
+}
+
+// PatientSummary is the part of a Patient embedded into the appointments of search results.
+type PatientSummary struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Birthdate string `json:"birthdate"`
 }
 
 type Clinic struct {
@@ -62,4 +125,5 @@ type Clinic struct {
 	Name      string `json:"name"`
 	Address   string `json:"address"`
 	City      string `json:"city"`
+	Timezone  string `json:"timezone"`
 }
@@ -319,6 +319,61 @@ func (m UserModel) GetUserByToken(token string) (*User, error) {
 	return user, nil
 }
 
+// GetAll returns the users whose name and email contain the given strings, ignoring case,
+// optionally only the activated or only the deactivated ones.
+func (m UserModel) GetAll(name, email string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, activated, version
+		FROM users
+		WHERE (strpos(LOWER(name), LOWER($1)) > 0 OR $1 = '')
+		AND (strpos(LOWER(email), LOWER($2)) > 0 OR $2 = '')
+		AND (activated = $3 OR $3 IS NULL)
+		ORDER BY %s %s, id ASC
+		LIMIT $4 OFFSET $5
+		`,
+		filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{name, email, activated, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&totalRecords, &user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Activated, &user.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// Get returns the user with the id.
+func (m UserModel) Get(id int64) (*User, error) {
+	return m.getById(int(id))
+}
+
 func (m UserModel) getById(id int) (*User, error) {
 	query := `
 		SELECT id, created_at, name, email, password_hash, activated, version
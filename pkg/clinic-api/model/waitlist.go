@@ -0,0 +1,571 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Zhassulan1/Go_Project/pkg/clinic-api/validator"
+)
+
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistBooked  = "booked"
+)
+
+const (
+	OfferPending  = "pending"
+	OfferAccepted = "accepted"
+	OfferDeclined = "declined"
+	// OfferExpired is the status of offers which ran out unanswered.
+	OfferExpired = "expired"
+)
+
+var (
+	// ErrOfferExpired is returned when a patient answers a waitlist offer too late.
+	ErrOfferExpired = errors.New("offer expired")
+)
+
+// WaitlistEntry is a patient waiting for a free slot with a fully booked doctor, within a
+// preferred date window and, optionally, a preferred time of day.
+type WaitlistEntry struct {
+	ID                 int64          `json:"id"`
+	CreatedAt          time.Time      `json:"createdAt"`
+	DoctorID           int64          `json:"doctorId"`
+	PatientID          int64          `json:"patientId"`
+	PreferredFrom      string         `json:"preferredFrom"`
+	PreferredTo        string         `json:"preferredTo"`
+	PreferredStartTime *string        `json:"preferredStartTime,omitempty"`
+	PreferredEndTime   *string        `json:"preferredEndTime,omitempty"`
+	Notes              string         `json:"notes"`
+	Status             string         `json:"status"`
+	Offer              *WaitlistOffer `json:"offer,omitempty"`
+}
+
+// WaitlistOffer is a freed time slot offered to a waitlisted patient until ExpiresAt.
+type WaitlistOffer struct {
+	ID            int64     `json:"id"`
+	CreatedAt     time.Time `json:"createdAt"`
+	EntryID       int64     `json:"entryId"`
+	DoctorID      int64     `json:"doctorId"`
+	PatientID     int64     `json:"patientId"`
+	Date          string    `json:"date"`
+	StartTime     string    `json:"startTime"`
+	EndTime       string    `json:"endTime"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	Status        string    `json:"status"`
+	AppointmentID *int64    `json:"appointmentId,omitempty"`
+}
+
+// OfferNotice holds what a message to the patient about an offer needs.
+type OfferNotice struct {
+	PatientName string
+	Email       string
+	DoctorName  string
+	Specialty   string
+}
+
+// offerColumns lists the columns of the offer o and its entry e in the order expected by
+// scanDest.
+const offerColumns = `o.id, o.created_at, o.entry_id, e.doctor_id, e.patient_id, to_char(o.date, 'YYYY-MM-DD'),
+	to_char(o.start_time, 'HH24:MI'), to_char(o.end_time, 'HH24:MI'), o.expires_at,
+	o.status, o.appointment_id`
+
+func (offer *WaitlistOffer) scanDest() []interface{} {
+	return []interface{}{
+		&offer.ID, &offer.CreatedAt, &offer.EntryID, &offer.DoctorID, &offer.PatientID, &offer.Date,
+		&offer.StartTime, &offer.EndTime, &offer.ExpiresAt, &offer.Status, &offer.AppointmentID,
+	}
+}
+
+// Appointment returns the requested appointment which accepting the offer books.
+func (offer *WaitlistOffer) Appointment() *Appointment {
+	return &Appointment{
+		PatientId: strconv.FormatInt(offer.PatientID, 10),
+		DoctorId:  strconv.FormatInt(offer.DoctorID, 10),
+		Date:      offer.Date,
+		StartTime: offer.StartTime,
+		EndTime:   offer.EndTime,
+		Status:    StatusRequested,
+	}
+}
+
+type WaitlistModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// ValidateWaitlistEntry runs validation checks on the WaitlistEntry type.
+func ValidateWaitlistEntry(v *validator.Validator, entry *WaitlistEntry) {
+	v.Check(entry.PatientID > 0, "patientId", "must be provided")
+	v.Check(len(entry.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+
+	from, errFrom := time.Parse(DateLayout, entry.PreferredFrom)
+	to, errTo := time.Parse(DateLayout, entry.PreferredTo)
+	v.Check(errFrom == nil, "preferredFrom", "must be a date in YYYY-MM-DD format")
+	v.Check(errTo == nil, "preferredTo", "must be a date in YYYY-MM-DD format")
+	if errFrom == nil && errTo == nil {
+		v.Check(!to.Before(from), "preferredTo", "must not be before preferredFrom")
+	}
+
+	if entry.PreferredStartTime != nil {
+		_, err := time.Parse(ClockLayout, *entry.PreferredStartTime)
+		v.Check(err == nil, "preferredStartTime", "must be a time in HH:MM format")
+	}
+	if entry.PreferredEndTime != nil {
+		_, err := time.Parse(ClockLayout, *entry.PreferredEndTime)
+		v.Check(err == nil, "preferredEndTime", "must be a time in HH:MM format")
+	}
+	if entry.PreferredStartTime != nil && entry.PreferredEndTime != nil && v.Valid() {
+		validateTimeRange(v, *entry.PreferredStartTime, *entry.PreferredEndTime)
+	}
+}
+
+func (m WaitlistModel) Insert(entry *WaitlistEntry) error {
+	query := `
+		INSERT INTO waitlist_entries (doctor_id, patient_id, preferred_from, preferred_to,
+			preferred_start_time, preferred_end_time, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, status
+		`
+	args := []interface{}{
+		entry.DoctorID,
+		entry.PatientID,
+		entry.PreferredFrom,
+		entry.PreferredTo,
+		entry.PreferredStartTime,
+		entry.PreferredEndTime,
+		entry.Notes,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt, &entry.Status)
+}
+
+// GetAllForDoctor returns the patients still waiting for the doctor, first come first, along
+// with the offer they are currently holding, if any.
+func (m WaitlistModel) GetAllForDoctor(doctorID int64) ([]*WaitlistEntry, error) {
+	query := `
+		SELECT e.id, e.created_at, e.doctor_id, e.patient_id,
+			to_char(e.preferred_from, 'YYYY-MM-DD'), to_char(e.preferred_to, 'YYYY-MM-DD'),
+			to_char(e.preferred_start_time, 'HH24:MI'), to_char(e.preferred_end_time, 'HH24:MI'),
+			e.notes, e.status,
+			o.id, o.created_at, to_char(o.date, 'YYYY-MM-DD'),
+			to_char(o.start_time, 'HH24:MI'), to_char(o.end_time, 'HH24:MI'), o.expires_at
+		FROM waitlist_entries e
+		LEFT JOIN waitlist_offers o
+			ON o.entry_id = e.id AND o.status = 'pending' AND o.expires_at > now()
+		WHERE e.doctor_id = $1 AND e.status = 'waiting'
+		ORDER BY e.created_at, e.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	entries := []*WaitlistEntry{}
+	for rows.Next() {
+		var entry WaitlistEntry
+		var offer struct {
+			id                   *int64
+			createdAt, expiresAt *time.Time
+			date, start, end     *string
+		}
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.DoctorID,
+			&entry.PatientID,
+			&entry.PreferredFrom,
+			&entry.PreferredTo,
+			&entry.PreferredStartTime,
+			&entry.PreferredEndTime,
+			&entry.Notes,
+			&entry.Status,
+			&offer.id,
+			&offer.createdAt,
+			&offer.date,
+			&offer.start,
+			&offer.end,
+			&offer.expiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if offer.id != nil {
+			entry.Offer = &WaitlistOffer{
+				ID:        *offer.id,
+				CreatedAt: *offer.createdAt,
+				EntryID:   entry.ID,
+				DoctorID:  entry.DoctorID,
+				PatientID: entry.PatientID,
+				Date:      *offer.date,
+				StartTime: *offer.start,
+				EndTime:   *offer.end,
+				ExpiresAt: *offer.expiresAt,
+				Status:    OfferPending,
+			}
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetEntry returns a single entry from the waitlist of a doctor.
+func (m WaitlistModel) GetEntry(doctorID, id int64) (*WaitlistEntry, error) {
+	query := `
+		SELECT id, created_at, doctor_id, patient_id,
+			to_char(preferred_from, 'YYYY-MM-DD'), to_char(preferred_to, 'YYYY-MM-DD'),
+			to_char(preferred_start_time, 'HH24:MI'), to_char(preferred_end_time, 'HH24:MI'),
+			notes, status
+		FROM waitlist_entries
+		WHERE id = $1 AND doctor_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entry WaitlistEntry
+
+	err := m.DB.QueryRowContext(ctx, query, id, doctorID).Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.DoctorID,
+		&entry.PatientID,
+		&entry.PreferredFrom,
+		&entry.PreferredTo,
+		&entry.PreferredStartTime,
+		&entry.PreferredEndTime,
+		&entry.Notes,
+		&entry.Status,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+// Delete removes a patient from the waitlist of a doctor.
+func (m WaitlistModel) Delete(doctorID, id int64) error {
+	query := `
+		DELETE FROM waitlist_entries
+		WHERE id = $1 AND doctor_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, doctorID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// OfferSlot offers the freed time slot of an appointment to the first patient on the doctor's
+// waitlist whose preferences match it, who isn't already holding another offer and who hasn't
+// been offered the same slot before. The offer stays open for ttl. ErrRecordNotFound is
+// returned when nobody on the waitlist matches, or when the slot has already started.
+func (m WaitlistModel) OfferSlot(appointment *Appointment, ttl time.Duration) (*WaitlistOffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets two slots freed at the same time go to two different patients.
+	query := `
+		SELECT e.id, e.doctor_id, e.patient_id
+		FROM waitlist_entries e
+		WHERE e.doctor_id::TEXT = $1
+		AND e.status = 'waiting'
+		AND $2::DATE BETWEEN e.preferred_from AND e.preferred_to
+		AND (e.preferred_start_time IS NULL OR e.preferred_start_time <= $3::TIME)
+		AND (e.preferred_end_time IS NULL OR e.preferred_end_time >= $4::TIME)
+		AND ` + clinicTime("$2::DATE", "$3::TIME", "e.doctor_id") + ` > now()
+		AND NOT EXISTS (
+			SELECT 1 FROM waitlist_offers o
+			WHERE o.entry_id = e.id
+			AND ((o.status = 'pending' AND o.expires_at > now())
+				OR (o.date = $2::DATE AND o.start_time = $3::TIME))
+		)
+		ORDER BY e.created_at, e.id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+		`
+	args := []interface{}{appointment.DoctorId, appointment.Date, appointment.StartTime, appointment.EndTime}
+
+	offer := &WaitlistOffer{
+		Date:      appointment.Date,
+		StartTime: appointment.StartTime,
+		EndTime:   appointment.EndTime,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&offer.EntryID, &offer.DoctorID, &offer.PatientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		INSERT INTO waitlist_offers (entry_id, date, start_time, end_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, status
+		`
+	args = []interface{}{offer.EntryID, offer.Date, offer.StartTime, offer.EndTime, offer.ExpiresAt}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&offer.ID, &offer.CreatedAt, &offer.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return offer, nil
+}
+
+// GetOffer returns a waitlist offer together with the doctor and patient of its entry.
+func (m WaitlistModel) GetOffer(id int64) (*WaitlistOffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getOffer(ctx, m.DB, id, false)
+}
+
+// getOffer reads an offer, optionally locking it for the rest of the transaction.
+func getOffer(ctx context.Context, q querier, id int64, forUpdate bool) (*WaitlistOffer, error) {
+	query := `
+		SELECT ` + offerColumns + `
+		FROM waitlist_offers o
+		INNER JOIN waitlist_entries e ON e.id = o.entry_id
+		WHERE o.id = $1
+		`
+	if forUpdate {
+		query += " FOR UPDATE OF o"
+	}
+
+	var offer WaitlistOffer
+
+	err := q.QueryRowContext(ctx, query, id).Scan(offer.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &offer, nil
+}
+
+// GetOfferNotice returns what a message to the patient of the offer needs. ErrRecordNotFound is
+// returned for patients without a user account, as there is nowhere to send the message to.
+func (m WaitlistModel) GetOfferNotice(id int64) (*OfferNotice, error) {
+	query := `
+		SELECT p.name, u.email, d.name, d.specialty
+		FROM waitlist_offers o
+		INNER JOIN waitlist_entries e ON e.id = o.entry_id
+		INNER JOIN patients p ON p.id = e.patient_id
+		INNER JOIN users u ON u.id = p.user_id
+		INNER JOIN doctors d ON d.id = e.doctor_id
+		WHERE o.id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var notice OfferNotice
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&notice.PatientName, &notice.Email, &notice.DoctorName, &notice.Specialty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &notice, nil
+}
+
+// ExpireOffers closes the pending offers which ran out unanswered, and returns them, so that
+// their slots can be offered to the next patients.
+func (m WaitlistModel) ExpireOffers() ([]*WaitlistOffer, error) {
+	query := `
+		UPDATE waitlist_offers o
+		SET status = 'expired'
+		FROM waitlist_entries e
+		WHERE e.id = o.entry_id AND o.status = 'pending' AND o.expires_at <= now()
+		RETURNING ` + offerColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	var offers []*WaitlistOffer
+	for rows.Next() {
+		var offer WaitlistOffer
+		if err := rows.Scan(offer.scanDest()...); err != nil {
+			return nil, err
+		}
+		offers = append(offers, &offer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return offers, nil
+}
+
+// AcceptOffer books the offered slot for the waitlisted patient and takes them off the
+// waitlist. It fails with ErrOfferExpired once the offer is no longer pending or past its
+// expiry, and with ErrAppointmentConflict if the slot was booked by someone else meanwhile.
+func (m WaitlistModel) AcceptOffer(id int64) (*WaitlistOffer, *Appointment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	offer, err := getOffer(ctx, tx, id, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if offer.Status != OfferPending || !offer.ExpiresAt.After(time.Now()) {
+		return nil, nil, ErrOfferExpired
+	}
+
+	appointment := offer.Appointment()
+
+	err = insertAppointment(ctx, tx, appointment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+		UPDATE waitlist_offers
+		SET status = 'accepted', appointment_id = $1
+		WHERE id = $2
+		RETURNING status, appointment_id
+		`
+	err = tx.QueryRowContext(ctx, query, appointment.Id, offer.ID).Scan(&offer.Status, &offer.AppointmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query = `
+		UPDATE waitlist_entries
+		SET status = 'booked'
+		WHERE id = $1
+		`
+	_, err = tx.ExecContext(ctx, query, offer.EntryID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return offer, appointment, nil
+}
+
+// DeclineOffer closes a pending offer. The patient stays on the waitlist for the next slot.
+func (m WaitlistModel) DeclineOffer(id int64) (*WaitlistOffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	offer, err := getOffer(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if offer.Status != OfferPending || !offer.ExpiresAt.After(time.Now()) {
+		return nil, ErrOfferExpired
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE waitlist_offers SET status = 'declined' WHERE id = $1`, offer.ID)
+	if err != nil {
+		return nil, err
+	}
+	offer.Status = OfferDeclined
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return offer, nil
+}
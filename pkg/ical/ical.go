@@ -0,0 +1,162 @@
+// Package ical writes RFC 5545 iCalendar feeds. Only the parts the clinic needs are supported:
+// a VCALENDAR holding VEVENTs, with all times written in UTC.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event statuses, as defined for the STATUS property of a VEVENT.
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+const (
+	utcLayout = "20060102T150405Z"
+
+	// maxLineLength is the number of octets after which content lines are folded.
+	maxLineLength = 75
+)
+
+// Event is a single VEVENT. UID must stay the same for as long as the event exists, and
+// Sequence must grow with every significant change, so that calendar clients update the
+// event they already have instead of adding a new one.
+type Event struct {
+	UID         string
+	Sequence    int
+	Created     time.Time
+	Modified    time.Time
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	Status      string
+}
+
+// Calendar is a VCALENDAR with its events.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// WriteTo writes the calendar to w, with CRLF line endings and long lines folded.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	lw := &lineWriter{w: bufio.NewWriter(w)}
+
+	lw.line("BEGIN", "VCALENDAR")
+	lw.line("VERSION", "2.0")
+	lw.line("PRODID", c.ProdID)
+	lw.line("CALSCALE", "GREGORIAN")
+	lw.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	stamp := time.Now().UTC().Format(utcLayout)
+
+	for _, e := range c.Events {
+		lw.line("BEGIN", "VEVENT")
+		lw.line("UID", e.UID)
+		lw.line("SEQUENCE", strconv.Itoa(e.Sequence))
+		lw.line("DTSTAMP", stamp)
+		if !e.Created.IsZero() {
+			lw.line("CREATED", e.Created.UTC().Format(utcLayout))
+		}
+		if !e.Modified.IsZero() {
+			lw.line("LAST-MODIFIED", e.Modified.UTC().Format(utcLayout))
+		}
+		lw.line("DTSTART", e.Start.UTC().Format(utcLayout))
+		lw.line("DTEND", e.End.UTC().Format(utcLayout))
+		lw.line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			lw.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			lw.line("LOCATION", escape(e.Location))
+		}
+		if e.Status != "" {
+			lw.line("STATUS", e.Status)
+		}
+		lw.line("END", "VEVENT")
+	}
+
+	lw.line("END", "VCALENDAR")
+
+	if lw.err != nil {
+		return lw.n, lw.err
+	}
+	return lw.n, lw.w.Flush()
+}
+
+// escape escapes a TEXT value as described in RFC 5545 section 3.3.11.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// lineWriter writes content lines, and remembers the first error so that callers only need to
+// check it once at the end.
+type lineWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// line writes "name:value", folding it into lines of at most maxLineLength octets. Folds are
+// never placed inside a multi-byte UTF-8 sequence.
+func (lw *lineWriter) line(name, value string) {
+	s := name + ":" + value
+
+	for first := true; ; first = false {
+		limit := maxLineLength
+		if !first {
+			// Continuation lines start with a space, which counts towards the limit.
+			limit--
+		}
+
+		cut := len(s)
+		if cut > limit {
+			cut = limit
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			// Invalid UTF-8 may have no start of a sequence to fold at.
+			if cut == 0 {
+				cut = limit
+			}
+		}
+
+		if !first {
+			lw.write(" ")
+		}
+		lw.write(s[:cut])
+		lw.write("\r\n")
+
+		s = s[cut:]
+		if s == "" {
+			return
+		}
+	}
+}
+
+func (lw *lineWriter) write(s string) {
+	if lw.err != nil {
+		return
+	}
+	n, err := lw.w.WriteString(s)
+	lw.n += int64(n)
+	lw.err = err
+}
@@ -0,0 +1,141 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// writeLine returns the content line written for name and value.
+func writeLine(t *testing.T, name, value string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	lw := &lineWriter{w: bufio.NewWriter(&buf)}
+	lw.line(name, value)
+	if err := lw.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{`back\slash`, `back\\slash`},
+		{"semi;colon", `semi\;colon`},
+		{"com,ma", `com\,ma`},
+		{"two\nlines", `two\nlines`},
+		{"crlf\r\nline", `crlf\nline`},
+		{`all\;,` + "\n", `all\\\;\,\n`},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		lines int
+		valid bool
+	}{
+		{"short", "hello", 1, true},
+		{"exactly the limit", strings.Repeat("a", maxLineLength-len("SUMMARY:")), 1, true},
+		{"one over the limit", strings.Repeat("a", maxLineLength-len("SUMMARY:")+1), 2, true},
+		{"long", strings.Repeat("a", 500), 7, true},
+		{"multi-byte", strings.Repeat("ж", 100), 3, true},
+		{"four-byte", strings.Repeat("😀", 50), 3, true},
+		{"continuation bytes only", strings.Repeat("\x80", 200), 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := writeLine(t, "SUMMARY", tt.value)
+
+			if !strings.HasSuffix(got, "\r\n") {
+				t.Fatalf("line %q does not end with CRLF", got)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+			if len(lines) != tt.lines {
+				t.Errorf("got %d lines, want %d", len(lines), tt.lines)
+			}
+
+			for i, line := range lines {
+				if len(line) > maxLineLength {
+					t.Errorf("line %d is %d octets long", i, len(line))
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d does not start with a space", i)
+				}
+				if tt.valid && !utf8.ValidString(line) {
+					t.Errorf("line %d splits a UTF-8 sequence", i)
+				}
+			}
+
+			if unfolded := strings.ReplaceAll(got, "\r\n ", ""); unfolded != "SUMMARY:"+tt.value+"\r\n" {
+				t.Errorf("unfolded line = %q, want %q", unfolded, "SUMMARY:"+tt.value+"\r\n")
+			}
+		})
+	}
+}
+
+func TestCalendarWriteTo(t *testing.T) {
+	start := time.Date(2024, 5, 14, 10, 0, 0, 0, time.FixedZone("ALMT", 5*60*60))
+
+	c := &Calendar{
+		ProdID: "-//Clinic//Calendar//EN",
+		Name:   "Dr. House, cardiology",
+		Events: []Event{{
+			UID:      "appointment-1@clinic",
+			Sequence: 2,
+			Start:    start,
+			End:      start.Add(30 * time.Minute),
+			Summary:  "Check-up; bring results",
+			Status:   StatusConfirmed,
+		}},
+	}
+
+	var buf bytes.Buffer
+	n, err := c.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Dr. House\\, cardiology\r\n",
+		"UID:appointment-1@clinic\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTART:20240514T050000Z\r\n",
+		"DTEND:20240514T053000Z\r\n",
+		"SUMMARY:Check-up\\; bring results\r\n",
+		"STATUS:CONFIRMED\r\n",
+		"END:VEVENT\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("calendar does not contain %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Errorf("calendar does not end with END:VCALENDAR")
+	}
+	if strings.Contains(out, "DESCRIPTION") || strings.Contains(out, "LOCATION") {
+		t.Errorf("calendar contains empty optional properties:\n%s", out)
+	}
+}
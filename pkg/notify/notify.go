@@ -0,0 +1,98 @@
+// Package notify sends messages to the users of the clinic. The Notifier interface lets the
+// API deliver them by email in production, and write them to a file or to stdout when running
+// locally.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a single notification for one recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages. Implementations must be safe for concurrent use.
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// SMTP sends messages as plain text emails through an SMTP server.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	// from is the sender as given, with its display name, for the From header; envelope is only
+	// its address, which is what SMTP servers accept in MAIL FROM.
+	from     string
+	envelope string
+}
+
+// NewSMTP returns a Notifier which sends emails from sender, such as
+// "Medical Clinic <no-reply@clinic.local>", through the server at host:port. PLAIN authentication
+// is used when a username is given.
+func NewSMTP(host string, port int, username, password, sender string) (*SMTP, error) {
+	address, err := mail.ParseAddress(sender)
+	if err != nil {
+		return nil, fmt.Errorf("notify: invalid sender %q: %w", sender, err)
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTP{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		auth:     auth,
+		from:     address.String(),
+		envelope: address.Address,
+	}, nil
+}
+
+func (s *SMTP) Notify(msg Message) error {
+	if msg.To == "" {
+		return errors.New("notify: message has no recipient")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(s.addr, s.auth, s.envelope, []string{msg.To}, []byte(b.String()))
+}
+
+// Writer writes messages to an io.Writer, such as os.Stdout or a file, instead of sending them.
+type Writer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewWriter returns a Notifier which writes every message to out.
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out}
+}
+
+func (w *Writer) Notify(msg Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := fmt.Fprintf(w.out, "To: %s\nSubject: %s\n\n%s\n\n", msg.To, msg.Subject, msg.Body)
+	return err
+}
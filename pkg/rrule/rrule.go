@@ -0,0 +1,276 @@
+// Package rrule implements the subset of RFC 5545 recurrence rules that the clinic uses for
+// appointment series: FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL, BYDAY (plain weekdays only),
+// COUNT and UNTIL. Rules work on calendar dates, the time of day is kept by the caller.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences caps the number of dates a single rule may expand to.
+const MaxOccurrences = 200
+
+// maxYears stops the expansion of rules which would otherwise search for matching dates
+// forever, e.g. FREQ=DAILY;INTERVAL=7;BYDAY=TU;COUNT=3 starting on a Monday.
+const maxYears = 5
+
+// Supported values of the FREQ rule part.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    *time.Time
+}
+
+// Parse parses a recurrence rule such as "FREQ=WEEKLY;INTERVAL=1;BYDAY=MO,WE;COUNT=10". An
+// optional "RRULE:" prefix is accepted. Either COUNT or UNTIL must be present, so that every
+// rule expands to a finite number of dates.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("rule must not be empty")
+	}
+
+	rule := &Rule{Interval: 1}
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+
+		name = strings.ToUpper(name)
+		if seen[name] {
+			return nil, fmt.Errorf("%s must not be repeated", name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			value = strings.ToUpper(value)
+			if value != Daily && value != Weekly && value != Monthly {
+				return nil, fmt.Errorf("FREQ must be one of %s, %s or %s", Daily, Weekly, Monthly)
+			}
+			rule.Freq = value
+
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return nil, errors.New("INTERVAL must be a positive integer")
+			}
+			rule.Interval = interval
+
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("BYDAY contains unsupported day %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return nil, errors.New("COUNT must be a positive integer")
+			}
+			if count > MaxOccurrences {
+				return nil, fmt.Errorf("COUNT must not be more than %d", MaxOccurrences)
+			}
+			rule.Count = count
+
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", name)
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return nil, errors.New("FREQ must be provided")
+	case rule.Count == 0 && rule.Until == nil:
+		return nil, errors.New("either COUNT or UNTIL must be provided")
+	case rule.Count != 0 && rule.Until != nil:
+		return nil, errors.New("COUNT and UNTIL must not both be provided")
+	case rule.Freq == Monthly && len(rule.ByDay) > 0:
+		return nil, errors.New("BYDAY is not supported with FREQ=MONTHLY")
+	}
+
+	return rule, nil
+}
+
+// parseUntil accepts both the DATE (20240131) and the DATE-TIME (20240131T235959Z) form of
+// UNTIL, and keeps only the date.
+func parseUntil(value string) (time.Time, error) {
+	date, _, _ := strings.Cut(value, "T")
+
+	until, err := time.Parse("20060102", date)
+	if err != nil {
+		return time.Time{}, errors.New("UNTIL must be a date in YYYYMMDD format")
+	}
+
+	return until, nil
+}
+
+// String formats the rule back to its RFC 5545 form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			for name, day := range weekdays {
+				if day == weekday {
+					days[i] = name
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Matches reports whether the weekday of date is allowed by BYDAY. Rules without BYDAY match
+// every date.
+func (r *Rule) Matches(date time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+
+	for _, weekday := range r.ByDay {
+		if date.Weekday() == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the dates of the series starting at dtstart, in chronological order. Like in
+// RFC 5545, dtstart itself is the first occurrence, so callers should check it with Matches
+// first. The result never holds more than MaxOccurrences dates.
+func (r *Rule) Expand(dtstart time.Time) []time.Time {
+	dtstart = time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, time.UTC)
+
+	limit := MaxOccurrences
+	if r.Count > 0 {
+		limit = r.Count
+	}
+
+	end := dtstart.AddDate(maxYears, 0, 0)
+	if r.Until != nil && r.Until.Before(end) {
+		end = *r.Until
+	}
+
+	var dates []time.Time
+
+	// add appends date to the result, and reports whether the expansion has to stop.
+	add := func(date time.Time) bool {
+		dates = append(dates, date)
+		return len(dates) >= limit
+	}
+
+	switch r.Freq {
+	case Daily:
+		for date := dtstart; !date.After(end); date = date.AddDate(0, 0, r.Interval) {
+			if r.Matches(date) && add(date) {
+				return dates
+			}
+		}
+
+	case Weekly:
+		byDay := r.ByDay
+		if len(byDay) == 0 {
+			byDay = []time.Weekday{dtstart.Weekday()}
+		}
+
+		// Weeks start on Monday, the RFC 5545 default for WKST.
+		weekStart := dtstart.AddDate(0, 0, -((int(dtstart.Weekday()) + 6) % 7))
+		for ; !weekStart.After(end); weekStart = weekStart.AddDate(0, 0, 7*r.Interval) {
+			for offset := 0; offset < 7; offset++ {
+				date := weekStart.AddDate(0, 0, offset)
+				if date.After(end) {
+					return dates
+				}
+				if date.Before(dtstart) || !containsWeekday(byDay, date.Weekday()) {
+					continue
+				}
+				if add(date) {
+					return dates
+				}
+			}
+		}
+
+	case Monthly:
+		for month := 0; ; month += r.Interval {
+			first := time.Date(dtstart.Year(), dtstart.Month()+time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+			if first.After(end) {
+				return dates
+			}
+
+			// Months which don't have the day (e.g. the 31st) are skipped, as RFC 5545 requires.
+			date := first.AddDate(0, 0, dtstart.Day()-1)
+			if date.Month() != first.Month() {
+				continue
+			}
+			if date.After(end) {
+				return dates
+			}
+			if add(date) {
+				return dates
+			}
+		}
+	}
+
+	return dates
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
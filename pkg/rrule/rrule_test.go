@@ -0,0 +1,222 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+)
+
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		want string
+	}{
+		{"weekly", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10"},
+		{"prefix and lowercase", "RRULE:freq=daily;interval=2;count=5", "FREQ=DAILY;INTERVAL=2;COUNT=5"},
+		{"interval of one is dropped", "FREQ=MONTHLY;INTERVAL=1;COUNT=3", "FREQ=MONTHLY;COUNT=3"},
+		{"until date", "FREQ=DAILY;UNTIL=20240131", "FREQ=DAILY;UNTIL=20240131"},
+		{"until date-time", "FREQ=DAILY;UNTIL=20240131T235959Z", "FREQ=DAILY;UNTIL=20240131"},
+		{"count at the cap", "FREQ=DAILY;COUNT=200", "FREQ=DAILY;COUNT=200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error %v", tt.rule, err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("Parse(%q).String() = %q, want %q", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"empty", ""},
+		{"malformed part", "FREQ=DAILY;COUNT"},
+		{"missing FREQ", "COUNT=3"},
+		{"unsupported FREQ", "FREQ=YEARLY;COUNT=3"},
+		{"neither COUNT nor UNTIL", "FREQ=DAILY"},
+		{"both COUNT and UNTIL", "FREQ=DAILY;COUNT=3;UNTIL=20240131"},
+		{"COUNT over the cap", "FREQ=DAILY;COUNT=201"},
+		{"zero COUNT", "FREQ=DAILY;COUNT=0"},
+		{"zero INTERVAL", "FREQ=DAILY;INTERVAL=0;COUNT=3"},
+		{"unknown day", "FREQ=WEEKLY;BYDAY=XX;COUNT=3"},
+		{"ordinal day", "FREQ=WEEKLY;BYDAY=1MO;COUNT=3"},
+		{"BYDAY with MONTHLY", "FREQ=MONTHLY;BYDAY=MO;COUNT=3"},
+		{"repeated part", "FREQ=DAILY;FREQ=WEEKLY;COUNT=3"},
+		{"malformed UNTIL", "FREQ=DAILY;UNTIL=2024-01-31"},
+		{"unsupported part", "FREQ=DAILY;COUNT=3;BYMONTH=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.rule); err == nil {
+				t.Errorf("Parse(%q) returned no error", tt.rule)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart string
+		want    []string
+	}{
+		{
+			name:    "daily",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: "2024-01-01",
+			want:    []string{"2024-01-01", "2024-01-02", "2024-01-03"},
+		},
+		{
+			name:    "daily with interval",
+			rule:    "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			dtstart: "2024-01-01",
+			want:    []string{"2024-01-01", "2024-01-03", "2024-01-05"},
+		},
+		{
+			name:    "daily with BYDAY",
+			rule:    "FREQ=DAILY;BYDAY=SA,SU;COUNT=3",
+			dtstart: "2024-01-06",
+			want:    []string{"2024-01-06", "2024-01-07", "2024-01-13"},
+		},
+		{
+			name:    "weekly with BYDAY",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			dtstart: "2024-01-01",
+			want:    []string{"2024-01-01", "2024-01-03", "2024-01-08", "2024-01-10"},
+		},
+		{
+			name:    "weekly skips BYDAY days before dtstart",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3",
+			dtstart: "2024-01-03",
+			want:    []string{"2024-01-03", "2024-01-08", "2024-01-10"},
+		},
+		{
+			name:    "weekly with interval",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;COUNT=3",
+			dtstart: "2024-01-02",
+			want:    []string{"2024-01-02", "2024-01-16", "2024-01-30"},
+		},
+		{
+			name:    "weekly until",
+			rule:    "FREQ=WEEKLY;UNTIL=20240115",
+			dtstart: "2024-01-01",
+			want:    []string{"2024-01-01", "2024-01-08", "2024-01-15"},
+		},
+		{
+			name:    "monthly until",
+			rule:    "FREQ=MONTHLY;UNTIL=20240430",
+			dtstart: "2024-01-15",
+			want:    []string{"2024-01-15", "2024-02-15", "2024-03-15", "2024-04-15"},
+		},
+		{
+			name:    "monthly skips months without the day",
+			rule:    "FREQ=MONTHLY;COUNT=4",
+			dtstart: "2024-01-31",
+			want:    []string{"2024-01-31", "2024-03-31", "2024-05-31", "2024-07-31"},
+		},
+		{
+			name:    "monthly on a leap day",
+			rule:    "FREQ=MONTHLY;INTERVAL=12;COUNT=2",
+			dtstart: "2024-02-29",
+			want:    []string{"2024-02-29", "2028-02-29"},
+		},
+		{
+			name:    "no matching date within the year cap",
+			rule:    "FREQ=DAILY;INTERVAL=7;BYDAY=TU;COUNT=3",
+			dtstart: "2024-01-01",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error %v", tt.rule, err)
+			}
+
+			got := rule.Expand(date(t, tt.dtstart))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expand returned %d dates %v, want %v", len(got), got, tt.want)
+			}
+			for i := range got {
+				if got[i].Format("2006-01-02") != tt.want[i] {
+					t.Errorf("date %d = %s, want %s", i, got[i].Format("2006-01-02"), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExpandCaps(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart string
+		count   int
+		last    string
+	}{
+		{"occurrence cap", "FREQ=DAILY;UNTIL=20301231", "2024-01-01", MaxOccurrences, "2024-07-18"},
+		{"year cap", "FREQ=MONTHLY;UNTIL=20991231", "2024-01-01", 61, "2029-01-01"},
+		{"year cap with BYDAY", "FREQ=WEEKLY;INTERVAL=4;UNTIL=20991231", "2024-01-01", 66, "2028-12-25"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error %v", tt.rule, err)
+			}
+
+			got := rule.Expand(date(t, tt.dtstart))
+			if len(got) != tt.count {
+				t.Fatalf("Expand returned %d dates, want %d", len(got), tt.count)
+			}
+			if last := got[len(got)-1].Format("2006-01-02"); last != tt.last {
+				t.Errorf("last date = %s, want %s", last, tt.last)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	rule, err := Parse("FREQ=WEEKLY;BYDAY=TU,TH;COUNT=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rule.Matches(date(t, "2024-01-02")) {
+		t.Error("Matches(Tuesday) = false, want true")
+	}
+	if rule.Matches(date(t, "2024-01-01")) {
+		t.Error("Matches(Monday) = true, want false")
+	}
+
+	rule, err = Parse("FREQ=DAILY;COUNT=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rule.Matches(date(t, "2024-01-01")) {
+		t.Error("Matches without BYDAY = false, want true")
+	}
+}